@@ -10,12 +10,68 @@ type Statement struct {
 	SelectStatement      *SelectStatement
 	CreateTableStatement *CreateTableStatement
 	InsertStatement      *InsertStatement
+	CreateViewStatement  *CreateViewStatement
+	DropViewStatement    *DropViewStatement
+	RefreshViewStatement *RefreshViewStatement
+	AlterTableStatement  *AlterTableStatement
+	SavepointStatement   *SavepointStatement
+	BeginStatement       *BeginStatement
+	SetStatement         *SetStatement
 	Kind                 AstKind
 }
 
+// ? With SetOperations, OrderBy, Limit and Offset apply to the combined result
 type SelectStatement struct {
-	Items *[]*Expression
-	From  lex.Token
+	With          *WithClause
+	Distinct      bool
+	Items         *[]*SelectItem
+	From          *FromItem
+	Where         *Expression
+	GroupBy       *[]*Expression
+	SetOperations *[]*SetOperation
+	OrderBy       *[]*OrderByItem
+	Limit         *Expression
+	Offset        *Expression
+}
+
+// ? Combines the rows so far with those of Select, which has no ORDER BY or
+// ? LIMIT of its own
+type SetOperation struct {
+	Kind   SetOperationKind
+	All    bool
+	Select *SelectStatement
+}
+
+// ? WITH [RECURSIVE] name [(columns)] AS (select), ...
+type WithClause struct {
+	Recursive bool
+	Tables    *[]*CommonTableExpression
+}
+
+type CommonTableExpression struct {
+	Name    lex.Token
+	Columns *[]*lex.Token
+	Select  *SelectStatement
+}
+
+// ? exp [AS alias], or * for every column of the FROM item
+type SelectItem struct {
+	Exp      *Expression
+	Alias    *lex.Token
+	Asterisk bool
+}
+
+// ? A table by name or a parenthesised select, Alias is required for the latter
+type FromItem struct {
+	Table    *lex.Token
+	Subquery *SelectStatement
+	Alias    *lex.Token
+	Kind     FromKind
+}
+
+type OrderByItem struct {
+	Exp  *Expression
+	Desc bool
 }
 
 type CreateTableStatement struct {
@@ -32,3 +88,52 @@ type InsertStatement struct {
 	Table  lex.Token
 	Values *[]*Expression
 }
+
+type CreateViewStatement struct {
+	Name    lex.Token
+	Columns *[]*lex.Token
+	Select  *SelectStatement
+	// ? The select as SQL text, which is what a view is stored as
+	Query        string
+	Materialized bool
+}
+
+type DropViewStatement struct {
+	Name         lex.Token
+	Materialized bool
+}
+
+type RefreshViewStatement struct {
+	Name lex.Token
+}
+
+// ? ALTER TABLE Table followed by
+// ? ADD [COLUMN] Column [DEFAULT Default],
+// ? DROP [COLUMN] Name,
+// ? RENAME [COLUMN] Name TO NewName or
+// ? RENAME TO NewName
+type AlterTableStatement struct {
+	Table   lex.Token
+	Kind    AlterKind
+	Column  *ColumnDefinition
+	Default *Expression
+	Name    *lex.Token
+	NewName *lex.Token
+}
+
+// ? BEGIN [TRANSACTION] [ISOLATION LEVEL level]
+type BeginStatement struct {
+	Isolation IsolationLevel
+}
+
+// ? SAVEPOINT, RELEASE SAVEPOINT or ROLLBACK TO SAVEPOINT, told apart by the
+// ? kind of the statement
+type SavepointStatement struct {
+	Name lex.Token
+}
+
+// ? SET name {= | TO} value, where value is a number, a string or DEFAULT
+type SetStatement struct {
+	Name  lex.Token
+	Value lex.Token
+}
@@ -6,10 +6,74 @@ const (
 	SelectKind AstKind = iota
 	CreateTableKind
 	InsertKind
+	CreateViewKind
+	DropViewKind
+	RefreshViewKind
+	AlterTableKind
+	BeginKind
+	CommitKind
+	RollbackKind
+	SavepointKind
+	ReleaseKind
+	RollbackToKind
+	SetKind
+)
+
+type AlterKind uint
+
+const (
+	AddColumnKind AlterKind = iota
+	DropColumnKind
+	RenameColumnKind
+	RenameTableKind
+)
+
+// ? READ COMMITTED and READ UNCOMMITTED are parsed as REPEATABLE READ, which
+// ? is stricter than both
+type IsolationLevel uint
+
+const (
+	RepeatableReadLevel IsolationLevel = iota
+	SerializableLevel
 )
 
 type ExpressKind uint
 
 const (
 	LiteralKind ExpressKind = iota
+	CastKind
+	BinaryKind
+	UnaryKind
+	CallKind
+	CaseKind
+	InKind
+	BetweenKind
+	LikeKind
+	SubqueryKind
+	ExistsKind
+)
+
+type FromKind uint
+
+const (
+	TableFromKind FromKind = iota
+	SubqueryFromKind
+)
+
+type SetOperationKind uint
+
+const (
+	UnionKind SetOperationKind = iota
+	IntersectKind
+	ExceptKind
+)
+
+type FrameBoundKind uint
+
+const (
+	UnboundedPrecedingKind FrameBoundKind = iota
+	PrecedingKind
+	CurrentRowKind
+	FollowingKind
+	UnboundedFollowingKind
 )
@@ -4,5 +4,100 @@ import "github.com/jameslahm/gosql/lex"
 
 type Expression struct {
 	Literal *lex.Token
-	Kind    ExpressKind
+	// ? Table or alias qualifying an identifier literal, as in t.id
+	Qualifier *lex.Token
+	Cast      *CastExpression
+	Binary    *BinaryExpression
+	Unary     *UnaryExpression
+	Call      *CallExpression
+	Case      *CaseExpression
+	In        *InExpression
+	Between   *BetweenExpression
+	Like      *LikeExpression
+	// ? Scalar subquery for SubqueryKind, the checked select for ExistsKind
+	Subquery *SelectStatement
+	Kind     ExpressKind
+}
+
+// ? CAST(exp AS type) or exp::type
+type CastExpression struct {
+	Exp  *Expression
+	Type lex.Token
+}
+
+type BinaryExpression struct {
+	A  *Expression
+	B  *Expression
+	Op lex.Token
+}
+
+type UnaryExpression struct {
+	Exp *Expression
+	Op  lex.Token
+}
+
+// ? name([DISTINCT] args) [OVER (...)], DISTINCT is only valid for
+// ? aggregates and Over makes the call a window function
+type CallExpression struct {
+	Name     lex.Token
+	Args     *[]*Expression
+	Distinct bool
+	Over     *WindowDefinition
+}
+
+// ? OVER ([PARTITION BY ...] [ORDER BY ...] [ROWS ...])
+type WindowDefinition struct {
+	PartitionBy *[]*Expression
+	OrderBy     *[]*OrderByItem
+	Frame       *WindowFrame
+}
+
+// ? ROWS BETWEEN Start AND End, ROWS Start alone ends at the current row
+type WindowFrame struct {
+	Start *FrameBound
+	End   *FrameBound
+}
+
+// ? Offset is set for n PRECEDING and n FOLLOWING
+type FrameBound struct {
+	Kind   FrameBoundKind
+	Offset *lex.Token
+}
+
+// ? CASE [operand] WHEN ... THEN ... [ELSE ...] END, without an operand
+// ? each WHEN is a condition
+type CaseExpression struct {
+	Operand *Expression
+	Whens   *[]*WhenClause
+	Else    *Expression
+}
+
+type WhenClause struct {
+	Condition *Expression
+	Result    *Expression
+}
+
+// ? exp [NOT] IN (list) or exp [NOT] IN (SELECT ...)
+type InExpression struct {
+	Exp      *Expression
+	List     *[]*Expression
+	Subquery *SelectStatement
+	Not      bool
+}
+
+// ? exp [NOT] BETWEEN low AND high
+type BetweenExpression struct {
+	Exp  *Expression
+	Low  *Expression
+	High *Expression
+	Not  bool
+}
+
+// ? exp [NOT] LIKE|ILIKE pattern [ESCAPE escape]
+type LikeExpression struct {
+	Exp             *Expression
+	Pattern         *Expression
+	Escape          *Expression
+	Not             bool
+	CaseInsensitive bool
 }
@@ -17,6 +17,10 @@ func isSymbol(token *lex.Token, symbol lex.Symbol) bool {
 }
 
 func helpMessage(tokens []*lex.Token, cursor uint, msg string) {
+	if uint(len(tokens)) <= cursor {
+		fmt.Printf("%s, Got end of input\n", msg)
+		return
+	}
 	c := tokens[int(cursor)]
 	fmt.Printf("[%d %d]: %s, Got %s\n", c.Loc.Line, c.Loc.Col, msg, c.Value)
 }
@@ -38,28 +42,390 @@ func expectSymbol(tokens []*lex.Token, cursor uint, symbol lex.Symbol) bool {
 }
 
 func parseSelectStatement(tokens []*lex.Token, cursor uint, delimiter string) (*SelectStatement, uint, bool) {
+	with, newCursor, ok := parseWithClause(tokens, cursor)
+	if !ok {
+		return nil, cursor, false
+	}
+
+	var slct *SelectStatement
+	slct, newCursor, ok = parseSelectCore(tokens, newCursor)
+	if !ok {
+		if with != nil {
+			helpMessage(tokens, newCursor, "Expected select")
+		}
+		return nil, cursor, false
+	}
+	slct.With = with
+
+	var setOperations []*SetOperation
+	setOperations, newCursor, ok = parseSetOperations(tokens, newCursor, false)
+	if !ok {
+		return nil, cursor, false
+	}
+	if setOperations != nil {
+		slct.SetOperations = &setOperations
+	}
+
+	if expectKeyword(tokens, newCursor, lex.OrderKeyword) {
+		newCursor++
+		if !expectKeyword(tokens, newCursor, lex.ByKeyword) {
+			helpMessage(tokens, newCursor, "Expected by")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		var orderBy []*OrderByItem
+		orderBy, newCursor, ok = parseOrderByItems(tokens, newCursor)
+		if !ok {
+			return nil, cursor, false
+		}
+		slct.OrderBy = &orderBy
+	}
+
+	if expectKeyword(tokens, newCursor, lex.LimitKeyword) {
+		slct.Limit, newCursor, ok = parseExpression(tokens, newCursor+1)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected limit")
+			return nil, cursor, false
+		}
+	}
+
+	if expectKeyword(tokens, newCursor, lex.OffsetKeyword) {
+		slct.Offset, newCursor, ok = parseExpression(tokens, newCursor+1)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected offset")
+			return nil, cursor, false
+		}
+	}
+	return slct, newCursor, true
+}
+
+// ? Optional WITH [RECURSIVE] name [(columns)] AS (select), ..., nil when there is none
+func parseWithClause(tokens []*lex.Token, cursor uint) (*WithClause, uint, bool) {
+	newCursor := cursor
+	if !expectKeyword(tokens, newCursor, lex.WithKeyword) {
+		return nil, cursor, true
+	}
+	newCursor++
+
+	with := &WithClause{}
+	if expectKeyword(tokens, newCursor, lex.RecursiveKeyword) {
+		with.Recursive = true
+		newCursor++
+	}
+
+	var tables []*CommonTableExpression
+	for {
+		name, nextCursor, ok := parseIdentifier(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected table name")
+			return nil, cursor, false
+		}
+		newCursor = nextCursor
+		table := &CommonTableExpression{Name: *name}
+
+		table.Columns, newCursor, ok = parseColumnNames(tokens, newCursor)
+		if !ok {
+			return nil, cursor, false
+		}
+
+		if !expectKeyword(tokens, newCursor, lex.AsKeyword) {
+			helpMessage(tokens, newCursor, "Expected as")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		table.Select, newCursor, ok = parseSubquery(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected subquery")
+			return nil, cursor, false
+		}
+		tables = append(tables, table)
+
+		if !expectSymbol(tokens, newCursor, lex.CommaSymbol) {
+			break
+		}
+		newCursor++
+	}
+	with.Tables = &tables
+	return with, newCursor, true
+}
+
+// ? Optional (name, name, ...), nil when there is none
+func parseColumnNames(tokens []*lex.Token, cursor uint) (*[]*lex.Token, uint, bool) {
+	newCursor := cursor
+	if !expectSymbol(tokens, newCursor, lex.LeftParenSymbol) {
+		return nil, cursor, true
+	}
+	newCursor++
+
+	var columns []*lex.Token
+	for {
+		column, nextCursor, ok := parseIdentifier(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected column name")
+			return nil, cursor, false
+		}
+		newCursor = nextCursor
+		columns = append(columns, column)
+
+		if !expectSymbol(tokens, newCursor, lex.CommaSymbol) {
+			break
+		}
+		newCursor++
+	}
+	if !expectSymbol(tokens, newCursor, lex.RightParenSymbol) {
+		helpMessage(tokens, newCursor, "Expected )")
+		return nil, cursor, false
+	}
+	return &columns, newCursor + 1, true
+}
+
+// ? SELECT ... [FROM ...] [WHERE ...] [GROUP BY ...]
+func parseSelectCore(tokens []*lex.Token, cursor uint) (*SelectStatement, uint, bool) {
 	newCursor := cursor
 	if !expectKeyword(tokens, newCursor, lex.SelectKeyword) {
 		return nil, cursor, false
 	}
 	newCursor++
 	slct := &SelectStatement{}
-	var exps []*Expression
+	if expectKeyword(tokens, newCursor, lex.DistinctKeyword) {
+		slct.Distinct = true
+		newCursor++
+	}
+
+	var items []*SelectItem
 	var ok bool
-	exps, newCursor, ok = parseExpressions(tokens, newCursor, []string{"from", delimiter})
+	items, newCursor, ok = parseSelectItems(tokens, newCursor)
 	if !ok {
 		return nil, cursor, false
 	}
-	slct.Items = &exps
-	if !expectKeyword(tokens, newCursor, lex.FromKeyword) {
-		helpMessage(tokens, cursor, "Expected from")
-		return nil, cursor, false
+	slct.Items = &items
+
+	if expectKeyword(tokens, newCursor, lex.FromKeyword) {
+		slct.From, newCursor, ok = parseFromItem(tokens, newCursor+1)
+		if !ok {
+			return nil, cursor, false
+		}
 	}
-	newCursor++
-	slct.From = *tokens[newCursor]
-	newCursor++
+
+	if expectKeyword(tokens, newCursor, lex.WhereKeyword) {
+		slct.Where, newCursor, ok = parseExpression(tokens, newCursor+1)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected where condition")
+			return nil, cursor, false
+		}
+	}
+
+	if expectKeyword(tokens, newCursor, lex.GroupKeyword) {
+		newCursor++
+		if !expectKeyword(tokens, newCursor, lex.ByKeyword) {
+			helpMessage(tokens, newCursor, "Expected by")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		var groupBy []*Expression
+		groupBy, newCursor, ok = parseExpressionList(tokens, newCursor)
+		if !ok {
+			return nil, cursor, false
+		}
+		slct.GroupBy = &groupBy
+	}
+
 	return slct, newCursor, true
+}
+
+// ? UNION [ALL] select, INTERSECT [ALL] select, EXCEPT [ALL] select, ...
+// ? evaluated from left to right, except that INTERSECT binds tighter: the
+// ? right operand of UNION or EXCEPT takes the INTERSECTs following it
+func parseSetOperations(tokens []*lex.Token, cursor uint, intersectOnly bool) ([]*SetOperation, uint, bool) {
+	newCursor := cursor
+	var operations []*SetOperation
+	for {
+		operation := &SetOperation{}
+		if expectKeyword(tokens, newCursor, lex.IntersectKeyword) {
+			operation.Kind = IntersectKind
+		} else if !intersectOnly && expectKeyword(tokens, newCursor, lex.UnionKeyword) {
+			operation.Kind = UnionKind
+		} else if !intersectOnly && expectKeyword(tokens, newCursor, lex.ExceptKeyword) {
+			operation.Kind = ExceptKind
+		} else {
+			return operations, newCursor, true
+		}
+		newCursor++
+
+		if expectKeyword(tokens, newCursor, lex.AllKeyword) {
+			operation.All = true
+			newCursor++
+		}
+
+		var ok bool
+		operation.Select, newCursor, ok = parseSelectCore(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected select")
+			return nil, cursor, false
+		}
+
+		if operation.Kind != IntersectKind {
+			var intersections []*SetOperation
+			intersections, newCursor, ok = parseSetOperations(tokens, newCursor, true)
+			if !ok {
+				return nil, cursor, false
+			}
+			if intersections != nil {
+				operation.Select.SetOperations = &intersections
+			}
+		}
+		operations = append(operations, operation)
+	}
+}
+
+func parseSelectItems(tokens []*lex.Token, cursor uint) ([]*SelectItem, uint, bool) {
+	newCursor := cursor
+	var items []*SelectItem
+	for {
+		if expectSymbol(tokens, newCursor, lex.AsteriskSymbol) {
+			items = append(items, &SelectItem{Asterisk: true})
+			newCursor++
+		} else {
+			exp, nextCursor, ok := parseExpression(tokens, newCursor)
+			if !ok {
+				helpMessage(tokens, newCursor, "Expected expression")
+				return nil, cursor, false
+			}
+			newCursor = nextCursor
+
+			item := &SelectItem{Exp: exp}
+			item.Alias, newCursor, ok = parseAlias(tokens, newCursor)
+			if !ok {
+				return nil, cursor, false
+			}
+			items = append(items, item)
+		}
+
+		if !expectSymbol(tokens, newCursor, lex.CommaSymbol) {
+			return items, newCursor, true
+		}
+		newCursor++
+	}
+}
+
+// ? Optional [AS] name, nil when there is none
+func parseAlias(tokens []*lex.Token, cursor uint) (*lex.Token, uint, bool) {
+	newCursor := cursor
+	hasAs := expectKeyword(tokens, newCursor, lex.AsKeyword)
+	if hasAs {
+		newCursor++
+	}
+
+	alias, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok && hasAs {
+		helpMessage(tokens, newCursor, "Expected alias")
+		return nil, cursor, false
+	}
+	return alias, newCursor, true
+}
+
+func parseFromItem(tokens []*lex.Token, cursor uint) (*FromItem, uint, bool) {
+	newCursor := cursor
+	from := &FromItem{}
+
+	if expectSymbol(tokens, newCursor, lex.LeftParenSymbol) {
+		var ok bool
+		from.Subquery, newCursor, ok = parseSubquery(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected subquery")
+			return nil, cursor, false
+		}
+		from.Kind = SubqueryFromKind
+	} else {
+		table, nextCursor, ok := parseIdentifier(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected table name")
+			return nil, cursor, false
+		}
+		from.Table = table
+		from.Kind = TableFromKind
+		newCursor = nextCursor
+	}
+
+	var ok bool
+	from.Alias, newCursor, ok = parseAlias(tokens, newCursor)
+	if !ok {
+		return nil, cursor, false
+	}
+	if from.Kind == SubqueryFromKind && from.Alias == nil {
+		helpMessage(tokens, newCursor, "Expected alias for subquery")
+		return nil, cursor, false
+	}
+	return from, newCursor, true
+}
+
+// ? (SELECT ...)
+func parseSubquery(tokens []*lex.Token, cursor uint) (*SelectStatement, uint, bool) {
+	if !expectSymbol(tokens, cursor, lex.LeftParenSymbol) ||
+		!(expectKeyword(tokens, cursor+1, lex.SelectKeyword) || expectKeyword(tokens, cursor+1, lex.WithKeyword)) {
+		return nil, cursor, false
+	}
+
+	slct, newCursor, ok := parseSelectStatement(tokens, cursor+1, ")")
+	if !ok {
+		return nil, cursor, false
+	}
+
+	if !expectSymbol(tokens, newCursor, lex.RightParenSymbol) {
+		helpMessage(tokens, newCursor, "Expected )")
+		return nil, cursor, false
+	}
+	return slct, newCursor + 1, true
+}
+
+// ? exp, exp, ... without a closing delimiter
+func parseExpressionList(tokens []*lex.Token, cursor uint) ([]*Expression, uint, bool) {
+	newCursor := cursor
+	var exps []*Expression
+	for {
+		exp, nextCursor, ok := parseExpression(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+		newCursor = nextCursor
+		exps = append(exps, exp)
+
+		if !expectSymbol(tokens, newCursor, lex.CommaSymbol) {
+			return exps, newCursor, true
+		}
+		newCursor++
+	}
+}
+
+func parseOrderByItems(tokens []*lex.Token, cursor uint) ([]*OrderByItem, uint, bool) {
+	newCursor := cursor
+	var items []*OrderByItem
+	for {
+		exp, nextCursor, ok := parseExpression(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+		newCursor = nextCursor
 
+		item := &OrderByItem{Exp: exp}
+		if expectKeyword(tokens, newCursor, lex.DescKeyword) {
+			item.Desc = true
+			newCursor++
+		} else if expectKeyword(tokens, newCursor, lex.AscKeyword) {
+			newCursor++
+		}
+		items = append(items, item)
+
+		if !expectSymbol(tokens, newCursor, lex.CommaSymbol) {
+			return items, newCursor, true
+		}
+		newCursor++
+	}
 }
 
 func parseExpressions(tokens []*lex.Token, cursor uint, delimiters []string) ([]*Expression, uint, bool) {
@@ -72,10 +438,11 @@ func parseExpressions(tokens []*lex.Token, cursor uint, delimiters []string) ([]
 
 		// ? Look for delimiters
 		token := tokens[newCursor]
+		isDelimiterKind := token.Kind == lex.KeywordKind || token.Kind == lex.SymbolKind
 
 		var breakFlag = false
 		for _, delimiter := range delimiters {
-			if delimiter == token.Value {
+			if isDelimiterKind && delimiter == token.Value {
 				breakFlag = true
 				break
 			}
@@ -93,32 +460,626 @@ func parseExpressions(tokens []*lex.Token, cursor uint, delimiters []string) ([]
 			newCursor++
 		}
 
-		// ? Add Expressions
-		var exp *Expression
-		var ok bool
-		exp, newCursor, ok = parseExpression(tokens, newCursor)
+		// ? Add Expressions
+		var exp *Expression
+		var ok bool
+		exp, newCursor, ok = parseExpression(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, cursor, "Expected expression")
+			return nil, cursor, false
+		}
+
+		exps = append(exps, exp)
+	}
+	return exps, newCursor, true
+}
+
+func parseExpression(tokens []*lex.Token, cursor uint) (*Expression, uint, bool) {
+	return parseBinaryExpression(tokens, cursor, 0)
+}
+
+// ? Binding power of NOT, it applies to comparisons and everything tighter
+const notBindingPower = 3
+
+// ? Binding power of comparisons, also used by IN, BETWEEN and LIKE
+const comparisonBindingPower = 4
+
+// ? Binding power of binary operators, 0 if the token is not one
+func bindingPower(token *lex.Token) uint {
+	if token.Kind == lex.KeywordKind {
+		switch lex.Keyword(token.Value) {
+		case lex.OrKeyword:
+			return 1
+		case lex.AndKeyword:
+			return 2
+		}
+		return 0
+	}
+	if token.Kind != lex.SymbolKind {
+		return 0
+	}
+	switch lex.Symbol(token.Value) {
+	case lex.EqualSymbol, lex.NotEqualSymbol, lex.BangEqualSymbol,
+		lex.LessSymbol, lex.LessEqualSymbol, lex.GreaterSymbol, lex.GreaterEqualSymbol:
+		return comparisonBindingPower
+	case lex.ConcatSymbol:
+		return 5
+	case lex.PlusSymbol, lex.MinusSymbol:
+		return 6
+	case lex.AsteriskSymbol, lex.SlashSymbol, lex.PercentSymbol:
+		return 7
+	}
+	return 0
+}
+
+func parseBinaryExpression(tokens []*lex.Token, cursor uint, minBp uint) (*Expression, uint, bool) {
+	exp, newCursor, ok := parseUnaryExpression(tokens, cursor)
+	if !ok {
+		return nil, cursor, false
+	}
+
+	for newCursor < uint(len(tokens)) {
+		if minBp < comparisonBindingPower {
+			if predicate, predicateCursor, ok := parsePredicate(tokens, newCursor, exp); ok {
+				exp = predicate
+				newCursor = predicateCursor
+				continue
+			}
+		}
+
+		op := tokens[newCursor]
+		bp := bindingPower(op)
+		// ? Stop on lower binding power so operators stay left associative
+		if bp == 0 || bp <= minBp {
+			break
+		}
+
+		var right *Expression
+		right, newCursor, ok = parseBinaryExpression(tokens, newCursor+1, bp)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected right operand")
+			return nil, cursor, false
+		}
+		exp = &Expression{
+			Binary: &BinaryExpression{
+				A:  exp,
+				B:  right,
+				Op: *op,
+			},
+			Kind: BinaryKind,
+		}
+	}
+	return exp, newCursor, true
+}
+
+// ? Postfix predicates on an already parsed operand: [NOT] IN, BETWEEN, LIKE and ILIKE
+func parsePredicate(tokens []*lex.Token, cursor uint, exp *Expression) (*Expression, uint, bool) {
+	newCursor := cursor
+	not := false
+	if expectKeyword(tokens, newCursor, lex.NotKeyword) {
+		not = true
+		newCursor++
+	}
+
+	var ok bool
+	switch {
+	case expectKeyword(tokens, newCursor, lex.InKeyword):
+		newCursor++
+		if subquery, subqueryCursor, ok := parseSubquery(tokens, newCursor); ok {
+			return &Expression{
+				In: &InExpression{
+					Exp:      exp,
+					Subquery: subquery,
+					Not:      not,
+				},
+				Kind: InKind,
+			}, subqueryCursor, true
+		}
+
+		if !expectSymbol(tokens, newCursor, lex.LeftParenSymbol) {
+			helpMessage(tokens, newCursor, "Expected (")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		var list []*Expression
+		list, newCursor, ok = parseExpressions(tokens, newCursor, []string{")"})
+		if !ok || len(list) == 0 {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		return &Expression{
+			In: &InExpression{
+				Exp:  exp,
+				List: &list,
+				Not:  not,
+			},
+			Kind: InKind,
+		}, newCursor, true
+
+	case expectKeyword(tokens, newCursor, lex.BetweenKeyword):
+		between := &BetweenExpression{Exp: exp, Not: not}
+		between.Low, newCursor, ok = parseBinaryExpression(tokens, newCursor+1, comparisonBindingPower)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+
+		if !expectKeyword(tokens, newCursor, lex.AndKeyword) {
+			helpMessage(tokens, newCursor, "Expected and")
+			return nil, cursor, false
+		}
+
+		between.High, newCursor, ok = parseBinaryExpression(tokens, newCursor+1, comparisonBindingPower)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+		return &Expression{
+			Between: between,
+			Kind:    BetweenKind,
+		}, newCursor, true
+
+	case expectKeyword(tokens, newCursor, lex.LikeKeyword), expectKeyword(tokens, newCursor, lex.IlikeKeyword):
+		like := &LikeExpression{
+			Exp:             exp,
+			Not:             not,
+			CaseInsensitive: isKeyword(tokens[newCursor], lex.IlikeKeyword),
+		}
+		like.Pattern, newCursor, ok = parseBinaryExpression(tokens, newCursor+1, comparisonBindingPower)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected pattern")
+			return nil, cursor, false
+		}
+
+		if expectKeyword(tokens, newCursor, lex.EscapeKeyword) {
+			like.Escape, newCursor, ok = parseBinaryExpression(tokens, newCursor+1, comparisonBindingPower)
+			if !ok {
+				helpMessage(tokens, newCursor, "Expected escape character")
+				return nil, cursor, false
+			}
+		}
+		return &Expression{
+			Like: like,
+			Kind: LikeKind,
+		}, newCursor, true
+	}
+	return nil, cursor, false
+}
+
+func parseUnaryExpression(tokens []*lex.Token, cursor uint) (*Expression, uint, bool) {
+	if expectKeyword(tokens, cursor, lex.NotKeyword) {
+		exp, newCursor, ok := parseBinaryExpression(tokens, cursor+1, notBindingPower)
+		if !ok {
+			return nil, cursor, false
+		}
+		return &Expression{
+			Unary: &UnaryExpression{
+				Exp: exp,
+				Op:  *tokens[cursor],
+			},
+			Kind: UnaryKind,
+		}, newCursor, true
+	}
+
+	if !expectSymbol(tokens, cursor, lex.MinusSymbol) {
+		return parsePostfixExpression(tokens, cursor)
+	}
+
+	// ? Fold negative numbers into the literal so the most negative bigint can be written
+	if number, newCursor, ok := parseToken(tokens, cursor+1, lex.NumberKind); ok {
+		literal := lex.NewToken(lex.NumberKind, tokens[cursor].Loc, "-"+number.Value)
+		return parsePostfixCasts(tokens, newCursor, &Expression{
+			Literal: literal,
+			Kind:    LiteralKind,
+		})
+	}
+
+	exp, newCursor, ok := parseUnaryExpression(tokens, cursor+1)
+	if !ok {
+		return nil, cursor, false
+	}
+	return &Expression{
+		Unary: &UnaryExpression{
+			Exp: exp,
+			Op:  *tokens[cursor],
+		},
+		Kind: UnaryKind,
+	}, newCursor, true
+}
+
+func parsePostfixExpression(tokens []*lex.Token, cursor uint) (*Expression, uint, bool) {
+	exp, newCursor, ok := parsePrimaryExpression(tokens, cursor)
+	if !ok {
+		return nil, cursor, false
+	}
+	return parsePostfixCasts(tokens, newCursor, exp)
+}
+
+// ? Postfix casts, exp::type
+func parsePostfixCasts(tokens []*lex.Token, cursor uint, exp *Expression) (*Expression, uint, bool) {
+	newCursor := cursor
+	for expectSymbol(tokens, newCursor, lex.DoubleColonSymbol) {
+		var dataType *lex.Token
+		var ok bool
+		dataType, newCursor, ok = parseToken(tokens, newCursor+1, lex.KeywordKind)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected data type")
+			return nil, cursor, false
+		}
+		exp = &Expression{
+			Cast: &CastExpression{
+				Exp:  exp,
+				Type: *dataType,
+			},
+			Kind: CastKind,
+		}
+	}
+	return exp, newCursor, true
+}
+
+func parsePrimaryExpression(tokens []*lex.Token, cursor uint) (*Expression, uint, bool) {
+	if cast, newCursor, ok := parseCastExpression(tokens, cursor); ok {
+		return &Expression{
+			Cast: cast,
+			Kind: CastKind,
+		}, newCursor, true
+	}
+
+	if subquery, newCursor, ok := parseSubquery(tokens, cursor); ok {
+		return &Expression{
+			Subquery: subquery,
+			Kind:     SubqueryKind,
+		}, newCursor, true
+	}
+
+	if expectKeyword(tokens, cursor, lex.ExistsKeyword) {
+		subquery, newCursor, ok := parseSubquery(tokens, cursor+1)
+		if !ok {
+			helpMessage(tokens, cursor+1, "Expected subquery")
+			return nil, cursor, false
+		}
+		return &Expression{
+			Subquery: subquery,
+			Kind:     ExistsKind,
+		}, newCursor, true
+	}
+
+	if expectSymbol(tokens, cursor, lex.LeftParenSymbol) {
+		exp, newCursor, ok := parseExpression(tokens, cursor+1)
+		if !ok {
+			return nil, cursor, false
+		}
+		if !expectSymbol(tokens, newCursor, lex.RightParenSymbol) {
+			helpMessage(tokens, newCursor, "Expected )")
+			return nil, cursor, false
+		}
+		return exp, newCursor + 1, true
+	}
+
+	if call, newCursor, ok := parseCallExpression(tokens, cursor); ok {
+		return &Expression{
+			Call: call,
+			Kind: CallKind,
+		}, newCursor, true
+	}
+
+	if caseExp, newCursor, ok := parseCaseExpression(tokens, cursor); ok {
+		return &Expression{
+			Case: caseExp,
+			Kind: CaseKind,
+		}, newCursor, true
+	}
+
+	if expectKeyword(tokens, cursor, lex.NullKeyword) || expectKeyword(tokens, cursor, lex.TrueKeyword) || expectKeyword(tokens, cursor, lex.FalseKeyword) {
+		return &Expression{
+			Literal: tokens[cursor],
+			Kind:    LiteralKind,
+		}, cursor + 1, true
+	}
+
+	// ? Qualified column, table.column
+	if qualifier, newCursor, ok := parseIdentifier(tokens, cursor); ok && expectSymbol(tokens, newCursor, lex.DotSymbol) {
+		column, newCursor, ok := parseIdentifier(tokens, newCursor+1)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected column name")
+			return nil, cursor, false
+		}
+		return &Expression{
+			Literal:   column,
+			Qualifier: qualifier,
+			Kind:      LiteralKind,
+		}, newCursor, true
+	}
+
+	kinds := []lex.TokenKind{lex.NumberKind, lex.StringKind}
+	for _, kind := range kinds {
+		if token, newCursor, ok := parseToken(tokens, cursor, kind); ok {
+			return &Expression{
+				Literal: token,
+				Kind:    LiteralKind,
+			}, newCursor, true
+		}
+	}
+	if token, newCursor, ok := parseIdentifier(tokens, cursor); ok {
+		return &Expression{
+			Literal: token,
+			Kind:    LiteralKind,
+		}, newCursor, true
+	}
+	return nil, cursor, false
+}
+
+func parseCallExpression(tokens []*lex.Token, cursor uint) (*CallExpression, uint, bool) {
+	newCursor := cursor
+	name, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok || !expectSymbol(tokens, newCursor, lex.LeftParenSymbol) {
+		return nil, cursor, false
+	}
+	newCursor++
+
+	distinct := expectKeyword(tokens, newCursor, lex.DistinctKeyword)
+	if distinct {
+		newCursor++
+	}
+
+	// ? count(*) is parsed as a call without arguments
+	var args []*Expression
+	if !distinct && expectSymbol(tokens, newCursor, lex.AsteriskSymbol) && expectSymbol(tokens, newCursor+1, lex.RightParenSymbol) {
+		newCursor++
+	} else {
+		args, newCursor, ok = parseExpressions(tokens, newCursor, []string{")"})
+		if !ok {
+			return nil, cursor, false
+		}
+	}
+
+	if !expectSymbol(tokens, newCursor, lex.RightParenSymbol) {
+		helpMessage(tokens, newCursor, "Expected )")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	call := &CallExpression{
+		Name:     *name,
+		Args:     &args,
+		Distinct: distinct,
+	}
+	if expectKeyword(tokens, newCursor, lex.OverKeyword) {
+		call.Over, newCursor, ok = parseWindowDefinition(tokens, newCursor+1)
+		if !ok {
+			return nil, cursor, false
+		}
+	}
+	return call, newCursor, true
+}
+
+func parseWindowDefinition(tokens []*lex.Token, cursor uint) (*WindowDefinition, uint, bool) {
+	newCursor := cursor
+	if !expectSymbol(tokens, newCursor, lex.LeftParenSymbol) {
+		helpMessage(tokens, newCursor, "Expected (")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	window := &WindowDefinition{}
+	var ok bool
+	if expectKeyword(tokens, newCursor, lex.PartitionKeyword) {
+		newCursor++
+		if !expectKeyword(tokens, newCursor, lex.ByKeyword) {
+			helpMessage(tokens, newCursor, "Expected by")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		var partitionBy []*Expression
+		partitionBy, newCursor, ok = parseExpressionList(tokens, newCursor)
+		if !ok {
+			return nil, cursor, false
+		}
+		window.PartitionBy = &partitionBy
+	}
+
+	if expectKeyword(tokens, newCursor, lex.OrderKeyword) {
+		newCursor++
+		if !expectKeyword(tokens, newCursor, lex.ByKeyword) {
+			helpMessage(tokens, newCursor, "Expected by")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		var orderBy []*OrderByItem
+		orderBy, newCursor, ok = parseOrderByItems(tokens, newCursor)
+		if !ok {
+			return nil, cursor, false
+		}
+		window.OrderBy = &orderBy
+	}
+
+	if expectKeyword(tokens, newCursor, lex.RowsKeyword) {
+		newCursor++
+		frame := &WindowFrame{}
+		if expectKeyword(tokens, newCursor, lex.BetweenKeyword) {
+			frame.Start, newCursor, ok = parseFrameBound(tokens, newCursor+1)
+			if !ok {
+				return nil, cursor, false
+			}
+			if !expectKeyword(tokens, newCursor, lex.AndKeyword) {
+				helpMessage(tokens, newCursor, "Expected and")
+				return nil, cursor, false
+			}
+			frame.End, newCursor, ok = parseFrameBound(tokens, newCursor+1)
+			if !ok {
+				return nil, cursor, false
+			}
+		} else {
+			frame.Start, newCursor, ok = parseFrameBound(tokens, newCursor)
+			if !ok {
+				return nil, cursor, false
+			}
+			frame.End = &FrameBound{Kind: CurrentRowKind}
+		}
+		window.Frame = frame
+	}
+
+	if !expectSymbol(tokens, newCursor, lex.RightParenSymbol) {
+		helpMessage(tokens, newCursor, "Expected )")
+		return nil, cursor, false
+	}
+	return window, newCursor + 1, true
+}
+
+// ? UNBOUNDED PRECEDING, n PRECEDING, CURRENT ROW, n FOLLOWING or UNBOUNDED FOLLOWING
+func parseFrameBound(tokens []*lex.Token, cursor uint) (*FrameBound, uint, bool) {
+	newCursor := cursor
+	bound := &FrameBound{}
+	if expectKeyword(tokens, newCursor, lex.CurrentKeyword) {
+		if !expectKeyword(tokens, newCursor+1, lex.RowKeyword) {
+			helpMessage(tokens, newCursor+1, "Expected row")
+			return nil, cursor, false
+		}
+		bound.Kind = CurrentRowKind
+		return bound, newCursor + 2, true
+	}
+
+	unbounded := expectKeyword(tokens, newCursor, lex.UnboundedKeyword)
+	if unbounded {
+		newCursor++
+	} else {
+		offset, nextCursor, ok := parseToken(tokens, newCursor, lex.NumberKind)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected frame bound")
+			return nil, cursor, false
+		}
+		bound.Offset = offset
+		newCursor = nextCursor
+	}
+
+	switch {
+	case expectKeyword(tokens, newCursor, lex.PrecedingKeyword) && unbounded:
+		bound.Kind = UnboundedPrecedingKind
+	case expectKeyword(tokens, newCursor, lex.PrecedingKeyword):
+		bound.Kind = PrecedingKind
+	case expectKeyword(tokens, newCursor, lex.FollowingKeyword) && unbounded:
+		bound.Kind = UnboundedFollowingKind
+	case expectKeyword(tokens, newCursor, lex.FollowingKeyword):
+		bound.Kind = FollowingKind
+	default:
+		helpMessage(tokens, newCursor, "Expected preceding or following")
+		return nil, cursor, false
+	}
+	return bound, newCursor + 1, true
+}
+
+func parseCaseExpression(tokens []*lex.Token, cursor uint) (*CaseExpression, uint, bool) {
+	newCursor := cursor
+	if !expectKeyword(tokens, newCursor, lex.CaseKeyword) {
+		return nil, cursor, false
+	}
+	newCursor++
+
+	caseExp := &CaseExpression{}
+	var ok bool
+	if !expectKeyword(tokens, newCursor, lex.WhenKeyword) {
+		caseExp.Operand, newCursor, ok = parseExpression(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+	}
+
+	var whens []*WhenClause
+	for expectKeyword(tokens, newCursor, lex.WhenKeyword) {
+		newCursor++
+		when := &WhenClause{}
+		when.Condition, newCursor, ok = parseExpression(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+
+		if !expectKeyword(tokens, newCursor, lex.ThenKeyword) {
+			helpMessage(tokens, newCursor, "Expected then")
+			return nil, cursor, false
+		}
+		newCursor++
+
+		when.Result, newCursor, ok = parseExpression(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected expression")
+			return nil, cursor, false
+		}
+		whens = append(whens, when)
+	}
+	if len(whens) == 0 {
+		helpMessage(tokens, newCursor, "Expected when")
+		return nil, cursor, false
+	}
+	caseExp.Whens = &whens
+
+	if expectKeyword(tokens, newCursor, lex.ElseKeyword) {
+		caseExp.Else, newCursor, ok = parseExpression(tokens, newCursor+1)
 		if !ok {
-			helpMessage(tokens, cursor, "Expected expression")
+			helpMessage(tokens, newCursor, "Expected expression")
 			return nil, cursor, false
 		}
+	}
 
-		exps = append(exps, exp)
+	if !expectKeyword(tokens, newCursor, lex.EndKeyword) {
+		helpMessage(tokens, newCursor, "Expected end")
+		return nil, cursor, false
 	}
-	return exps, newCursor, true
+	newCursor++
+
+	return caseExp, newCursor, true
 }
 
-func parseExpression(tokens []*lex.Token, cursor uint) (*Expression, uint, bool) {
+func parseCastExpression(tokens []*lex.Token, cursor uint) (*CastExpression, uint, bool) {
 	newCursor := cursor
-	kinds := []lex.TokenKind{lex.NumberKind, lex.StringKind, lex.IdentifierKind}
-	for _, kind := range kinds {
-		if token, newCursor, ok := parseToken(tokens, newCursor, kind); ok {
-			return &Expression{
-				Literal: token,
-				Kind:    LiteralKind,
-			}, newCursor, true
-		}
+	if !expectKeyword(tokens, newCursor, lex.CastKeyword) {
+		return nil, cursor, false
 	}
-	return nil, cursor, false
+	newCursor++
+
+	if !expectSymbol(tokens, newCursor, lex.LeftParenSymbol) {
+		helpMessage(tokens, newCursor, "Expected (")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	var exp *Expression
+	var ok bool
+	exp, newCursor, ok = parseExpression(tokens, newCursor)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected expression")
+		return nil, cursor, false
+	}
+
+	if !expectKeyword(tokens, newCursor, lex.AsKeyword) {
+		helpMessage(tokens, newCursor, "Expected as")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	var dataType *lex.Token
+	dataType, newCursor, ok = parseToken(tokens, newCursor, lex.KeywordKind)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected data type")
+		return nil, cursor, false
+	}
+
+	if !expectSymbol(tokens, newCursor, lex.RightParenSymbol) {
+		helpMessage(tokens, newCursor, "Expected )")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	return &CastExpression{
+		Exp:  exp,
+		Type: *dataType,
+	}, newCursor, true
 }
 
 func parseToken(tokens []*lex.Token, cursor uint, kind lex.TokenKind) (*lex.Token, uint, bool) {
@@ -131,6 +1092,22 @@ func parseToken(tokens []*lex.Token, cursor uint, kind lex.TokenKind) (*lex.Toke
 	}
 }
 
+// ? A name: an identifier, or a keyword that is not reserved, as an
+// ? identifier
+func parseIdentifier(tokens []*lex.Token, cursor uint) (*lex.Token, uint, bool) {
+	if uint(len(tokens)) <= cursor {
+		return nil, cursor, false
+	}
+	token := tokens[cursor]
+	switch {
+	case token.Kind == lex.IdentifierKind:
+		return token, cursor + 1, true
+	case token.Kind == lex.KeywordKind && !lex.Keyword(token.Value).IsReserved():
+		return lex.NewToken(lex.IdentifierKind, token.Loc, token.Value), cursor + 1, true
+	}
+	return nil, cursor, false
+}
+
 func parseInsertStatement(tokens []*lex.Token, cursor uint, delimiter string) (*InsertStatement, uint, bool) {
 	newCursor := cursor
 
@@ -146,7 +1123,7 @@ func parseInsertStatement(tokens []*lex.Token, cursor uint, delimiter string) (*
 
 	var table *lex.Token
 	var ok bool
-	if table, newCursor, ok = parseToken(tokens, newCursor, lex.IdentifierKind); !ok {
+	if table, newCursor, ok = parseIdentifier(tokens, newCursor); !ok {
 		helpMessage(tokens, newCursor, "Expected table name")
 		return nil, cursor, false
 	}
@@ -193,7 +1170,7 @@ func parseCreateStatement(tokens []*lex.Token, cursor uint, delimiters string) (
 
 	var table *lex.Token
 	var ok bool
-	if table, newCursor, ok = parseToken(tokens, newCursor, lex.IdentifierKind); !ok {
+	if table, newCursor, ok = parseIdentifier(tokens, newCursor); !ok {
 		helpMessage(tokens, newCursor, "Expected table name")
 		return nil, cursor, false
 	}
@@ -222,6 +1199,339 @@ func parseCreateStatement(tokens []*lex.Token, cursor uint, delimiters string) (
 	}, newCursor, true
 }
 
+// ? CREATE [MATERIALIZED] VIEW name [(columns)] AS select
+func parseCreateViewStatement(tokens []*lex.Token, cursor uint) (*CreateViewStatement, uint, bool) {
+	newCursor := cursor
+	if !expectKeyword(tokens, newCursor, lex.CreateKeyword) {
+		return nil, cursor, false
+	}
+	newCursor++
+
+	materialized, newCursor := parseMaterialized(tokens, newCursor)
+	if !expectKeyword(tokens, newCursor, lex.ViewKeyword) {
+		return nil, cursor, false
+	}
+	newCursor++
+
+	name, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected view name")
+		return nil, cursor, false
+	}
+
+	view := &CreateViewStatement{Name: *name, Materialized: materialized}
+	view.Columns, newCursor, ok = parseColumnNames(tokens, newCursor)
+	if !ok {
+		return nil, cursor, false
+	}
+
+	if !expectKeyword(tokens, newCursor, lex.AsKeyword) {
+		helpMessage(tokens, newCursor, "Expected as")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	start := newCursor
+	view.Select, newCursor, ok = parseSelectStatement(tokens, newCursor, ";")
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected select")
+		return nil, cursor, false
+	}
+	view.Query = lex.Join(tokens[start:newCursor])
+	return view, newCursor, true
+}
+
+// ? DROP [MATERIALIZED] VIEW name
+func parseDropViewStatement(tokens []*lex.Token, cursor uint) (*DropViewStatement, uint, bool) {
+	newCursor := cursor
+	if !expectKeyword(tokens, newCursor, lex.DropKeyword) {
+		return nil, cursor, false
+	}
+	newCursor++
+
+	materialized, newCursor := parseMaterialized(tokens, newCursor)
+	if !expectKeyword(tokens, newCursor, lex.ViewKeyword) {
+		return nil, cursor, false
+	}
+	newCursor++
+
+	name, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected view name")
+		return nil, cursor, false
+	}
+	return &DropViewStatement{Name: *name, Materialized: materialized}, newCursor, true
+}
+
+// ? REFRESH MATERIALIZED VIEW name
+func parseRefreshViewStatement(tokens []*lex.Token, cursor uint) (*RefreshViewStatement, uint, bool) {
+	newCursor := cursor
+	if !expectKeyword(tokens, newCursor, lex.RefreshKeyword) {
+		return nil, cursor, false
+	}
+	newCursor++
+
+	if !expectKeyword(tokens, newCursor, lex.MaterializedKeyword) || !expectKeyword(tokens, newCursor+1, lex.ViewKeyword) {
+		helpMessage(tokens, newCursor, "Expected materialized view")
+		return nil, cursor, false
+	}
+	newCursor += 2
+
+	name, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected view name")
+		return nil, cursor, false
+	}
+	return &RefreshViewStatement{Name: *name}, newCursor, true
+}
+
+func parseMaterialized(tokens []*lex.Token, cursor uint) (bool, uint) {
+	if expectKeyword(tokens, cursor, lex.MaterializedKeyword) {
+		return true, cursor + 1
+	}
+	return false, cursor
+}
+
+func parseAlterTableStatement(tokens []*lex.Token, cursor uint) (*AlterTableStatement, uint, bool) {
+	newCursor := cursor
+	if !expectKeyword(tokens, newCursor, lex.AlterKeyword) || !expectKeyword(tokens, newCursor+1, lex.TableKeyword) {
+		return nil, cursor, false
+	}
+	newCursor += 2
+
+	table, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected table name")
+		return nil, cursor, false
+	}
+	alter := &AlterTableStatement{Table: *table}
+
+	switch {
+	case expectKeyword(tokens, newCursor, lex.AddKeyword):
+		alter.Kind = AddColumnKind
+		// ? The name is followed by its type
+		newCursor = skipColumnKeyword(tokens, newCursor+1, func(cursor uint) bool {
+			return cursor < uint(len(tokens)) && tokens[cursor].Kind == lex.KeywordKind
+		})
+
+		name, nextCursor, ok := parseIdentifier(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected col name")
+			return nil, cursor, false
+		}
+		dataType, nextCursor, ok := parseToken(tokens, nextCursor, lex.KeywordKind)
+		if !ok {
+			helpMessage(tokens, nextCursor, "Expected col data type")
+			return nil, cursor, false
+		}
+		newCursor = nextCursor
+		alter.Column = &ColumnDefinition{
+			Name:     *name,
+			DataType: *dataType,
+		}
+
+		if expectKeyword(tokens, newCursor, lex.DefaultKeyword) {
+			alter.Default, newCursor, ok = parseExpression(tokens, newCursor+1)
+			if !ok {
+				helpMessage(tokens, newCursor, "Expected default value")
+				return nil, cursor, false
+			}
+		}
+	case expectKeyword(tokens, newCursor, lex.DropKeyword):
+		alter.Kind = DropColumnKind
+		newCursor = skipColumnKeyword(tokens, newCursor+1, func(uint) bool { return true })
+
+		alter.Name, newCursor, ok = parseIdentifier(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected col name")
+			return nil, cursor, false
+		}
+	case expectKeyword(tokens, newCursor, lex.RenameKeyword):
+		newCursor++
+		alter.Kind = RenameTableKind
+		// ? RENAME to TO name renames the column to
+		isTo := func(cursor uint) bool {
+			return expectKeyword(tokens, cursor, lex.ToKeyword)
+		}
+		_, _, named := parseIdentifier(tokens, newCursor+2)
+		if !isTo(newCursor) || (isTo(newCursor+1) && named) {
+			alter.Kind = RenameColumnKind
+			newCursor = skipColumnKeyword(tokens, newCursor, isTo)
+
+			alter.Name, newCursor, ok = parseIdentifier(tokens, newCursor)
+			if !ok {
+				helpMessage(tokens, newCursor, "Expected col name")
+				return nil, cursor, false
+			}
+			if !expectKeyword(tokens, newCursor, lex.ToKeyword) {
+				helpMessage(tokens, newCursor, "Expected to")
+				return nil, cursor, false
+			}
+		}
+		newCursor++
+
+		alter.NewName, newCursor, ok = parseIdentifier(tokens, newCursor)
+		if !ok {
+			helpMessage(tokens, newCursor, "Expected new name")
+			return nil, cursor, false
+		}
+	default:
+		helpMessage(tokens, newCursor, "Expected add, drop or rename")
+		return nil, cursor, false
+	}
+	return alter, newCursor, true
+}
+
+// ? COLUMN is optional after ADD, DROP and RENAME, and can also be the name
+// ? of the column: it is the keyword when a name follows it and then what
+// ? follows the name, by afterName
+func skipColumnKeyword(tokens []*lex.Token, cursor uint, afterName func(cursor uint) bool) uint {
+	if !expectKeyword(tokens, cursor, lex.ColumnKeyword) {
+		return cursor
+	}
+	if _, nameCursor, ok := parseIdentifier(tokens, cursor+1); ok && afterName(nameCursor) {
+		return cursor + 1
+	}
+	return cursor
+}
+
+// ? BEGIN, COMMIT or ROLLBACK, each optionally followed by TRANSACTION, and
+// ? ROLLBACK [TRANSACTION] TO [SAVEPOINT] name
+func parseTransactionStatement(tokens []*lex.Token, cursor uint) (*Statement, uint, bool) {
+	stmt := &Statement{}
+	switch {
+	case expectKeyword(tokens, cursor, lex.BeginKeyword):
+		stmt.Kind = BeginKind
+	case expectKeyword(tokens, cursor, lex.CommitKeyword):
+		stmt.Kind = CommitKind
+	case expectKeyword(tokens, cursor, lex.RollbackKeyword):
+		stmt.Kind = RollbackKind
+	default:
+		return nil, cursor, false
+	}
+
+	newCursor := cursor + 1
+	if expectKeyword(tokens, newCursor, lex.TransactionKeyword) {
+		newCursor++
+	}
+
+	if stmt.Kind == BeginKind {
+		var ok bool
+		stmt.BeginStatement, newCursor, ok = parseIsolationLevel(tokens, newCursor)
+		if !ok {
+			return nil, cursor, false
+		}
+	}
+
+	if stmt.Kind == RollbackKind && expectKeyword(tokens, newCursor, lex.ToKeyword) {
+		var ok bool
+		stmt.SavepointStatement, newCursor, ok = parseSavepointName(tokens, newCursor+1, true)
+		if !ok {
+			return nil, cursor, false
+		}
+		stmt.Kind = RollbackToKind
+	}
+	return stmt, newCursor, true
+}
+
+// ? Optional ISOLATION LEVEL of a BEGIN
+func parseIsolationLevel(tokens []*lex.Token, cursor uint) (*BeginStatement, uint, bool) {
+	stmt := &BeginStatement{}
+	if !expectKeyword(tokens, cursor, lex.IsolationKeyword) {
+		return stmt, cursor, true
+	}
+
+	newCursor := cursor + 1
+	if !expectKeyword(tokens, newCursor, lex.LevelKeyword) {
+		helpMessage(tokens, newCursor, "Expected LEVEL")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	switch {
+	case expectKeyword(tokens, newCursor, lex.SerializableKeyword):
+		stmt.Isolation = SerializableLevel
+		newCursor++
+	case expectKeyword(tokens, newCursor, lex.RepeatableKeyword) && expectKeyword(tokens, newCursor+1, lex.ReadKeyword):
+		newCursor += 2
+	case expectKeyword(tokens, newCursor, lex.ReadKeyword) &&
+		(expectKeyword(tokens, newCursor+1, lex.CommittedKeyword) || expectKeyword(tokens, newCursor+1, lex.UncommittedKeyword)):
+		newCursor += 2
+	default:
+		helpMessage(tokens, newCursor, "Expected isolation level")
+		return nil, cursor, false
+	}
+	return stmt, newCursor, true
+}
+
+// ? SAVEPOINT name or RELEASE [SAVEPOINT] name
+func parseSavepointStatement(tokens []*lex.Token, cursor uint) (*Statement, uint, bool) {
+	stmt := &Statement{}
+	switch {
+	case expectKeyword(tokens, cursor, lex.SavepointKeyword):
+		stmt.Kind = SavepointKind
+	case expectKeyword(tokens, cursor, lex.ReleaseKeyword):
+		stmt.Kind = ReleaseKind
+	default:
+		return nil, cursor, false
+	}
+
+	var ok bool
+	stmt.SavepointStatement, cursor, ok = parseSavepointName(tokens, cursor+1, stmt.Kind == ReleaseKind)
+	if !ok {
+		return nil, cursor, false
+	}
+	return stmt, cursor, true
+}
+
+// ? [SAVEPOINT] name, the keyword is only optional where keywordOptional is
+// ? set, and then it is the name when no other follows it
+func parseSavepointName(tokens []*lex.Token, cursor uint, keywordOptional bool) (*SavepointStatement, uint, bool) {
+	newCursor := cursor
+	if _, _, named := parseIdentifier(tokens, newCursor+1); keywordOptional && named && expectKeyword(tokens, newCursor, lex.SavepointKeyword) {
+		newCursor++
+	}
+
+	name, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected savepoint name")
+		return nil, cursor, false
+	}
+	return &SavepointStatement{Name: *name}, newCursor, true
+}
+
+func parseSetStatement(tokens []*lex.Token, cursor uint) (*SetStatement, uint, bool) {
+	if !expectKeyword(tokens, cursor, lex.SetKeyword) {
+		return nil, cursor, false
+	}
+	newCursor := cursor + 1
+
+	name, newCursor, ok := parseIdentifier(tokens, newCursor)
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected setting name")
+		return nil, cursor, false
+	}
+
+	if !expectSymbol(tokens, newCursor, lex.EqualSymbol) && !expectKeyword(tokens, newCursor, lex.ToKeyword) {
+		helpMessage(tokens, newCursor, "Expected = or TO")
+		return nil, cursor, false
+	}
+	newCursor++
+
+	if expectKeyword(tokens, newCursor, lex.DefaultKeyword) {
+		return &SetStatement{Name: *name, Value: *tokens[newCursor]}, newCursor + 1, true
+	}
+	value, newCursor, ok := parseToken(tokens, newCursor, lex.NumberKind)
+	if !ok {
+		value, newCursor, ok = parseToken(tokens, newCursor, lex.StringKind)
+	}
+	if !ok {
+		helpMessage(tokens, newCursor, "Expected setting value")
+		return nil, cursor, false
+	}
+	return &SetStatement{Name: *name, Value: *value}, newCursor, true
+}
+
 func parseColumnDefinitions(tokens []*lex.Token, cursor uint, delimiters []string) ([]*ColumnDefinition, uint, bool) {
 	newCursor := cursor
 
@@ -254,7 +1564,7 @@ func parseColumnDefinitions(tokens []*lex.Token, cursor uint, delimiters []strin
 
 		var name *lex.Token
 		var ok bool
-		name, newCursor, ok = parseToken(tokens, newCursor, lex.IdentifierKind)
+		name, newCursor, ok = parseIdentifier(tokens, newCursor)
 		if !ok {
 			helpMessage(tokens, newCursor, "Expected col name")
 			return nil, cursor, false
@@ -306,6 +1616,62 @@ func parseStatement(tokens []*lex.Token, cursor uint, delimiter string) (*Statem
 		}, newCursor, true
 	}
 
+	var crvw *CreateViewStatement
+	crvw, newCursor, ok = parseCreateViewStatement(tokens, newCursor)
+	if ok {
+		return &Statement{
+			CreateViewStatement: crvw,
+			Kind:                CreateViewKind,
+		}, newCursor, true
+	}
+
+	var drvw *DropViewStatement
+	drvw, newCursor, ok = parseDropViewStatement(tokens, newCursor)
+	if ok {
+		return &Statement{
+			DropViewStatement: drvw,
+			Kind:              DropViewKind,
+		}, newCursor, true
+	}
+
+	var rfvw *RefreshViewStatement
+	rfvw, newCursor, ok = parseRefreshViewStatement(tokens, newCursor)
+	if ok {
+		return &Statement{
+			RefreshViewStatement: rfvw,
+			Kind:                 RefreshViewKind,
+		}, newCursor, true
+	}
+
+	var alter *AlterTableStatement
+	alter, newCursor, ok = parseAlterTableStatement(tokens, newCursor)
+	if ok {
+		return &Statement{
+			AlterTableStatement: alter,
+			Kind:                AlterTableKind,
+		}, newCursor, true
+	}
+
+	var stmt *Statement
+	stmt, newCursor, ok = parseTransactionStatement(tokens, newCursor)
+	if ok {
+		return stmt, newCursor, true
+	}
+
+	stmt, newCursor, ok = parseSavepointStatement(tokens, newCursor)
+	if ok {
+		return stmt, newCursor, true
+	}
+
+	var set *SetStatement
+	set, newCursor, ok = parseSetStatement(tokens, newCursor)
+	if ok {
+		return &Statement{
+			SetStatement: set,
+			Kind:         SetKind,
+		}, newCursor, true
+	}
+
 	return nil, cursor, false
 }
 
@@ -0,0 +1,132 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/jameslahm/gosql/lex"
+)
+
+func parse(t *testing.T, source string) *Ast {
+	t.Helper()
+	tokens, err := lex.Lex(source)
+	if err != nil {
+		t.Fatalf("%s: %v", source, err)
+	}
+	a, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("%s: %v", source, err)
+	}
+	return a
+}
+
+// ? Keywords that are not reserved still name tables, columns and aliases
+func TestNonReservedKeywordsAsNames(t *testing.T) {
+	a := parse(t, "CREATE TABLE current (id INT, rows INT, row TEXT, preceding INT);")
+	create := a.Statements[0].CreateTableStatement
+	if create.Name.Kind != lex.IdentifierKind || create.Name.Value != "current" {
+		t.Errorf("got table %v, want current", create.Name)
+	}
+	for i, want := range []string{"id", "rows", "row", "preceding"} {
+		name := (*create.Cols)[i].Name
+		if name.Kind != lex.IdentifierKind || name.Value != want {
+			t.Errorf("got column %v, want %s", name, want)
+		}
+	}
+
+	a = parse(t, "SELECT rows, current.row AS following, sum(rows) OVER (ORDER BY row ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) unbounded FROM current;")
+	slct := a.Statements[0].SelectStatement
+	items := *slct.Items
+	if exp := items[0].Exp; exp.Kind != LiteralKind || exp.Literal.Kind != lex.IdentifierKind || exp.Literal.Value != "rows" {
+		t.Errorf("got %v, want the column rows", exp.Literal)
+	}
+	if exp := items[1].Exp; exp.Qualifier == nil || exp.Qualifier.Value != "current" || exp.Literal.Value != "row" {
+		t.Errorf("got %v, want the column current.row", exp.Literal)
+	}
+	if items[1].Alias == nil || items[1].Alias.Value != "following" {
+		t.Errorf("got alias %v, want following", items[1].Alias)
+	}
+	if frame := items[2].Exp.Call.Over.Frame; frame == nil || frame.Start.Kind != UnboundedPrecedingKind || frame.End.Kind != CurrentRowKind {
+		t.Errorf("got frame %v, want rows between unbounded preceding and current row", frame)
+	}
+	if items[2].Alias == nil || items[2].Alias.Value != "unbounded" {
+		t.Errorf("got alias %v, want unbounded", items[2].Alias)
+	}
+	if slct.From.Table.Value != "current" {
+		t.Errorf("got table %v, want current", slct.From.Table)
+	}
+}
+
+func TestStatementKeywordsAsNames(t *testing.T) {
+	names := []string{
+		"level", "read", "committed", "set", "to", "add", "column", "view", "default",
+		"transaction", "release", "savepoint", "begin", "commit", "isolation",
+	}
+	for _, name := range names {
+		a := parse(t, "CREATE TABLE "+name+" (id INT, "+name+" INT); SELECT "+name+" AS "+name+" FROM "+name+" "+name+";")
+		if got := a.Statements[0].CreateTableStatement.Name.Value; got != name {
+			t.Errorf("got table %s, want %s", got, name)
+		}
+		if got := (*a.Statements[0].CreateTableStatement.Cols)[1].Name.Value; got != name {
+			t.Errorf("got column %s, want %s", got, name)
+		}
+		slct := a.Statements[1].SelectStatement
+		if got := (*slct.Items)[0]; got.Exp.Literal.Kind != lex.IdentifierKind || got.Exp.Literal.Value != name || got.Alias.Value != name {
+			t.Errorf("got %v AS %v, want %s AS %s", got.Exp.Literal, got.Alias, name, name)
+		}
+		if slct.From.Table.Value != name || slct.From.Alias.Value != name {
+			t.Errorf("got FROM %v %v, want %s %s", slct.From.Table, slct.From.Alias, name, name)
+		}
+	}
+
+	// ? The statements that use the keywords still parse
+	a := parse(t, "BEGIN TRANSACTION ISOLATION LEVEL SERIALIZABLE; SAVEPOINT savepoint; ROLLBACK TO SAVEPOINT savepoint; RELEASE savepoint; COMMIT; SET lock_timeout TO DEFAULT;")
+	for i, kind := range []AstKind{BeginKind, SavepointKind, RollbackToKind, ReleaseKind, CommitKind, SetKind} {
+		if a.Statements[i].Kind != kind {
+			t.Errorf("got statement %d of kind %d, want %d", i, a.Statements[i].Kind, kind)
+		}
+	}
+	for _, stmt := range a.Statements[1:4] {
+		if stmt.SavepointStatement.Name.Value != "savepoint" {
+			t.Errorf("got savepoint %v, want savepoint", stmt.SavepointStatement.Name)
+		}
+	}
+}
+
+// ? COLUMN and TO are keywords in ALTER TABLE, or names where they are one
+func TestAlterTableKeywordsAsNames(t *testing.T) {
+	for _, test := range []struct {
+		source  string
+		kind    AlterKind
+		name    string
+		newName string
+	}{
+		{"ALTER TABLE t ADD COLUMN column INT;", AddColumnKind, "column", ""},
+		{"ALTER TABLE t ADD column INT;", AddColumnKind, "column", ""},
+		{"ALTER TABLE t ADD COLUMN level INT DEFAULT 1;", AddColumnKind, "level", ""},
+		{"ALTER TABLE t DROP COLUMN column;", DropColumnKind, "column", ""},
+		{"ALTER TABLE t DROP column;", DropColumnKind, "column", ""},
+		{"ALTER TABLE t DROP level;", DropColumnKind, "level", ""},
+		{"ALTER TABLE t RENAME TO u;", RenameTableKind, "", "u"},
+		{"ALTER TABLE t RENAME TO to;", RenameTableKind, "", "to"},
+		{"ALTER TABLE t RENAME to TO u;", RenameColumnKind, "to", "u"},
+		{"ALTER TABLE t RENAME COLUMN to TO to;", RenameColumnKind, "to", "to"},
+		{"ALTER TABLE t RENAME column TO u;", RenameColumnKind, "column", "u"},
+		{"ALTER TABLE t RENAME COLUMN column TO u;", RenameColumnKind, "column", "u"},
+	} {
+		alter := parse(t, test.source).Statements[0].AlterTableStatement
+		name := ""
+		switch {
+		case alter.Column != nil:
+			name = alter.Column.Name.Value
+		case alter.Name != nil:
+			name = alter.Name.Value
+		}
+		newName := ""
+		if alter.NewName != nil {
+			newName = alter.NewName.Value
+		}
+		if alter.Kind != test.kind || name != test.name || newName != test.newName {
+			t.Errorf("%s: got kind %d, %q and %q, want kind %d, %q and %q", test.source, alter.Kind, name, newName, test.kind, test.name, test.newName)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package backend
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? Running state of one aggregate call for one group
+type aggregateState interface {
+	step(args []MemoryCell) error
+	final() (MemoryCell, error)
+}
+
+type aggregateFunction struct {
+	minArgs int
+	maxArgs int
+	args    []argKind
+	returns func(types []ColumnType) (ColumnType, error)
+	// ? Creates the state of a new group
+	newState func(types []ColumnType, result ColumnType) aggregateState
+}
+
+var aggregateFunctions = map[string]*aggregateFunction{
+	// ? count(*) is compiled as count()
+	"count": {
+		minArgs: 0, maxArgs: 1, args: []argKind{anyArg},
+		returns: returnsType(BigIntType),
+		newState: func(types []ColumnType, result ColumnType) aggregateState {
+			return &countState{star: len(types) == 0}
+		},
+	},
+	"sum": {
+		minArgs: 1, maxArgs: 1, args: []argKind{numericArg},
+		returns: returnsType(BigIntType),
+		newState: func(types []ColumnType, result ColumnType) aggregateState {
+			return &sumState{}
+		},
+	},
+	"min": {
+		minArgs: 1, maxArgs: 1, args: []argKind{anyArg},
+		returns: returnsArgumentType,
+		newState: func(types []ColumnType, result ColumnType) aggregateState {
+			return &extremumState{t: types[0], result: result, sign: -1}
+		},
+	},
+	"max": {
+		minArgs: 1, maxArgs: 1, args: []argKind{anyArg},
+		returns: returnsArgumentType,
+		newState: func(types []ColumnType, result ColumnType) aggregateState {
+			return &extremumState{t: types[0], result: result, sign: 1}
+		},
+	},
+}
+
+type countState struct {
+	star  bool
+	count int64
+}
+
+func (cs *countState) step(args []MemoryCell) error {
+	if cs.star || args[0] != nil {
+		cs.count++
+	}
+	return nil
+}
+
+func (cs *countState) final() (MemoryCell, error) {
+	return bigIntCell(cs.count), nil
+}
+
+type sumState struct {
+	seen bool
+	sum  int64
+}
+
+func (ss *sumState) step(args []MemoryCell) error {
+	if args[0] == nil {
+		return nil
+	}
+	sum, err := applyArithmetic("+", ss.sum, args[0].AsBigInt())
+	if err != nil {
+		return err
+	}
+	ss.sum = sum
+	ss.seen = true
+	return nil
+}
+
+func (ss *sumState) final() (MemoryCell, error) {
+	if !ss.seen {
+		return nil, nil
+	}
+	return bigIntCell(ss.sum), nil
+}
+
+// ? min when sign is -1, max when sign is 1
+type extremumState struct {
+	t      ColumnType
+	result ColumnType
+	sign   int
+	best   MemoryCell
+}
+
+func (es *extremumState) step(args []MemoryCell) error {
+	if args[0] == nil {
+		return nil
+	}
+	if es.best == nil || compareCells(args[0], es.t, es.best, es.t) == es.sign {
+		es.best = args[0]
+	}
+	return nil
+}
+
+func (es *extremumState) final() (MemoryCell, error) {
+	return castCell(es.best, es.t, es.result)
+}
+
+// ? Adapts an AggregateFunc registered from Go
+type goAggregateState struct {
+	name     string
+	agg      AggregateFunc
+	state    interface{}
+	types    []ColumnType
+	argTypes []ColumnType
+	result   ColumnType
+}
+
+func (gs *goAggregateState) step(args []MemoryCell) error {
+	values, err := cellsToValues(args, gs.types, gs.argTypes)
+	if err != nil {
+		return err
+	}
+	state, err := gs.agg.Step(gs.state, values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", gs.name, err)
+	}
+	gs.state = state
+	return nil
+}
+
+func (gs *goAggregateState) final() (MemoryCell, error) {
+	value, err := gs.agg.Final(gs.state)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", gs.name, err)
+	}
+	return valueToCell(value, gs.result)
+}
+
+// ? An aggregate call found in a select list, its result is appended to the
+// ? grouped row after the scope columns
+type aggregateCall struct {
+	fn     *aggregateFunction
+	args   []*compiledExpression
+	types  []ColumnType
+	result ColumnType
+	// ? Only the first occurrence of each argument list is stepped
+	distinct bool
+}
+
+func (mb *MemoryBackend) compileAggregate(name string, fn *aggregateFunction, call *ast.CallExpression, s *scope) (*compiledExpression, error) {
+	if s.aggregates == nil {
+		return nil, fmt.Errorf("%w: aggregate %s is not allowed here", ErrInvalidExpression, name)
+	}
+
+	// ? Arguments are evaluated per input row, aggregates can not be nested
+	args, types, err := mb.compileArguments(call, s.withoutAggregates())
+	if err != nil {
+		return nil, err
+	}
+	if call.Distinct && len(args) == 0 {
+		return nil, fmt.Errorf("%w: %s(DISTINCT) needs an argument", ErrInvalidArguments, name)
+	}
+	if err = checkArguments(name, fn.minArgs, fn.maxArgs, fn.args, types); err != nil {
+		return nil, err
+	}
+	resultType, err := fn.returns(types)
+	if err != nil {
+		return nil, fmt.Errorf("%w, in %s", err, name)
+	}
+
+	index := len(s.columns) + len(*s.aggregates)
+	*s.aggregates = append(*s.aggregates, &aggregateCall{
+		fn:       fn,
+		args:     args,
+		types:    types,
+		result:   resultType,
+		distinct: call.Distinct,
+	})
+
+	return &compiledExpression{
+		Name: name,
+		Type: resultType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			return row[index], nil
+		},
+	}, nil
+}
+
+// ? Collapses rows into one row per group as they are added, each made of
+// ? the first row of the group followed by the aggregate results. Compiling
+// ? checks that columns outside of aggregates are grouped on, so they have
+// ? the value of that first row in the whole group.
+type grouper struct {
+	keys       []*compiledExpression
+	keyTypes   []ColumnType
+	aggregates []*aggregateCall
+	groups     map[string]*group
+	ordered    []*group
+}
+
+type group struct {
+	row    []MemoryCell
+	states []aggregateState
+	// ? Argument lists already stepped, per DISTINCT aggregate
+	seen []map[string]bool
+}
+
+func newGrouper(keys []*compiledExpression, aggregates []*aggregateCall) *grouper {
+	g := &grouper{
+		keys:       keys,
+		aggregates: aggregates,
+		groups:     make(map[string]*group),
+	}
+	for _, key := range keys {
+		g.keyTypes = append(g.keyTypes, key.Type)
+	}
+	return g
+}
+
+func (g *grouper) newGroup(row []MemoryCell) *group {
+	grp := &group{row: row}
+	for _, agg := range g.aggregates {
+		grp.states = append(grp.states, agg.fn.newState(agg.types, agg.result))
+		var seen map[string]bool
+		if agg.distinct {
+			seen = make(map[string]bool)
+		}
+		grp.seen = append(grp.seen, seen)
+	}
+	return grp
+}
+
+func (g *grouper) add(row []MemoryCell) error {
+	keyCells := make([]MemoryCell, len(g.keys))
+	for i, key := range g.keys {
+		cell, err := key.eval(row)
+		if err != nil {
+			return err
+		}
+		keyCells[i] = cell
+	}
+
+	k := rowKey(keyCells, g.keyTypes)
+	grp, ok := g.groups[k]
+	if !ok {
+		grp = g.newGroup(row)
+		g.groups[k] = grp
+		g.ordered = append(g.ordered, grp)
+	}
+
+	for i, agg := range g.aggregates {
+		args := make([]MemoryCell, len(agg.args))
+		for j, arg := range agg.args {
+			cell, err := arg.eval(row)
+			if err != nil {
+				return err
+			}
+			args[j] = cell
+		}
+		if agg.distinct {
+			k := rowKey(args, agg.types)
+			if grp.seen[i][k] {
+				continue
+			}
+			grp.seen[i][k] = true
+		}
+		if err := grp.states[i].step(args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ? One row per group in the order the groups were first seen. Without
+// ? GROUP BY there is always exactly one group, emptyRow stands in for its
+// ? first row when no rows were added.
+func (g *grouper) rows(hasGroupBy bool, emptyRow []MemoryCell) ([][]MemoryCell, error) {
+	ordered := g.ordered
+	if len(ordered) == 0 && !hasGroupBy {
+		ordered = append(ordered, g.newGroup(emptyRow))
+	}
+
+	var grouped [][]MemoryCell
+	for _, grp := range ordered {
+		row := append([]MemoryCell{}, grp.row...)
+		for _, state := range grp.states {
+			cell, err := state.final()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, cell)
+		}
+		grouped = append(grouped, row)
+	}
+	return grouped, nil
+}
+
+// ? Encode cells of the given types into a map key. Values that compare
+// ? equal share a key whatever their storage, so an int and a bigint with the
+// ? same value match. NULLs and lengths are marked so distinct rows never
+// ? share a key.
+func rowKey(cells []MemoryCell, types []ColumnType) string {
+	var key []byte
+	for i, cell := range cells {
+		if cell == nil {
+			key = append(key, 0)
+			continue
+		}
+		key = append(key, 1)
+
+		if isNumeric(types[i]) {
+			var value [8]byte
+			binary.BigEndian.PutUint64(value[:], uint64(cell.AsBigInt()))
+			key = append(key, value[:]...)
+			continue
+		}
+		var length [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(length[:], uint64(len(cell)))
+		key = append(key, length[:n]...)
+		key = append(key, cell...)
+	}
+	return string(key)
+}
+
+func resultTypes(columns []ResultColumn) []ColumnType {
+	types := make([]ColumnType, len(columns))
+	for i, col := range columns {
+		types[i] = col.Type
+	}
+	return types
+}
+
+// ? Whether two expressions are written the same, wherever they are written
+func sameExpression(a, b *ast.Expression) bool {
+	return sameValue(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func sameValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return sameValue(a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if a.Type() == reflect.TypeOf(lex.Location{}) {
+			return true
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !sameValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return a.Interface() == b.Interface()
+}
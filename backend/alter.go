@@ -0,0 +1,216 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? Changes build a new Table, rows are not changed in place. Adding or
+// ? dropping a column does not copy them either, see alteredRows.
+func (mb *MemoryBackend) AlterTable(stmt *ast.AlterTableStatement) error {
+	return mb.exec(exclusiveLock, alterTableLocks(stmt), func() error {
+		return mb.alterTable(stmt)
+	})
+}
+
+func (mb *MemoryBackend) alterTable(stmt *ast.AlterTableStatement) error {
+	name := stmt.Table.Value
+	if view, ok := mb.Views[name]; ok {
+		return fmt.Errorf("%w: %s is a %s", ErrTableDoesNotExist, name, view.kind())
+	}
+	table, ok := mb.Tables[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableDoesNotExist, name)
+	}
+
+	var err error
+	switch stmt.Kind {
+	case ast.AddColumnKind:
+		err = mb.addColumn(name, table, stmt.Column, stmt.Default)
+	case ast.DropColumnKind:
+		err = mb.dropColumn(name, table, stmt.Name.Value)
+	case ast.RenameColumnKind:
+		err = mb.renameColumn(name, table, stmt.Name.Value, stmt.NewName.Value)
+	case ast.RenameTableKind:
+		newName := stmt.NewName.Value
+		if err := mb.checkNameIsFree(newName); err != nil {
+			return err
+		}
+		delete(mb.Tables, name)
+		mb.Tables[newName] = table
+	default:
+		return ErrInvalidExpression
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := mb.checkViews(name); err != nil {
+		if stmt.Kind == ast.RenameTableKind {
+			delete(mb.Tables, stmt.NewName.Value)
+		}
+		mb.Tables[name] = table
+		return err
+	}
+	return nil
+}
+
+// ? Views are compiled again each time they are used, so a change to what
+// ? one selects from would only make it fail then. Changes that keep a view
+// ? from compiling, or from having the columns it was created with, are
+// ? refused instead. That includes adding a column to a table a view selects
+// ? * from.
+func (mb *MemoryBackend) checkViews(changed string) error {
+	for name, view := range mb.Views {
+		slct, err := mb.compileSelect(view.Select, &scope{})
+		if err == nil && len(slct.columns) != len(view.Columns) {
+			err = fmt.Errorf("%w: it would have %d columns instead of %d", ErrInvalidSelectItem, len(slct.columns), len(view.Columns))
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s is used by %s %s, %v", ErrDependentView, changed, view.kind(), name, err)
+		}
+	}
+	return nil
+}
+
+// ? Existing rows get the default, or NULL without one
+func (mb *MemoryBackend) addColumn(name string, table *Table, col *ast.ColumnDefinition, def *ast.Expression) error {
+	column := col.Name.Value
+	if columnIndex(table, column) >= 0 {
+		return fmt.Errorf("%w: %s.%s", ErrColumnAlreadyExists, name, column)
+	}
+	columnType, err := columnTypeFromToken(col.DataType)
+	if err != nil {
+		return err
+	}
+
+	var cell MemoryCell
+	if def != nil {
+		exp, err := mb.compileExpression(def, &scope{})
+		if err != nil {
+			return err
+		}
+		cell, err = exp.eval(nil)
+		if err != nil {
+			return err
+		}
+		cell, err = coerceCell(cell, exp.Type, columnType, column)
+		if err != nil {
+			return err
+		}
+	}
+
+	from := make([]int, len(table.Columns)+1)
+	fills := make([]MemoryCell, len(from))
+	for i := range table.Columns {
+		from[i] = i
+	}
+	from[len(table.Columns)], fills[len(table.Columns)] = -1, cell
+	mb.Tables[name] = alteredTable(table,
+		append(append([]string{}, table.Columns...), column),
+		append(append([]ColumnType{}, table.ColumnTypes...), columnType),
+		from, fills)
+	return nil
+}
+
+func (mb *MemoryBackend) dropColumn(name string, table *Table, column string) error {
+	i := columnIndex(table, column)
+	if i < 0 {
+		return fmt.Errorf("%w: %s.%s", ErrColumnDoesNotExist, name, column)
+	}
+
+	var from []int
+	for j := range table.Columns {
+		if j != i {
+			from = append(from, j)
+		}
+	}
+	mb.Tables[name] = alteredTable(table,
+		append(append([]string{}, table.Columns[:i]...), table.Columns[i+1:]...),
+		append(append([]ColumnType{}, table.ColumnTypes[:i]...), table.ColumnTypes[i+1:]...),
+		from, make([]MemoryCell, len(from)))
+	return nil
+}
+
+func (mb *MemoryBackend) renameColumn(name string, table *Table, column, newColumn string) error {
+	i := columnIndex(table, column)
+	if i < 0 {
+		return fmt.Errorf("%w: %s.%s", ErrColumnDoesNotExist, name, column)
+	}
+	if columnIndex(table, newColumn) >= 0 {
+		return fmt.Errorf("%w: %s.%s", ErrColumnAlreadyExists, name, newColumn)
+	}
+
+	stored, rows := table.storage()
+	altered := &Table{
+		Columns:     append([]string{}, table.Columns...),
+		ColumnTypes: table.ColumnTypes,
+		rows:        rows,
+		stored:      stored,
+	}
+	altered.Columns[i] = newColumn
+	mb.Tables[name] = altered
+	return nil
+}
+
+// ? The rows of a table whose columns were added or dropped, made from the
+// ? rows of the table it was as they are read. A DiskBackend or LSMBackend
+// ? writes them out a row at a time, they are never all in memory at once.
+type alteredRows struct {
+	table *Table
+	// ? The column of table each column comes from, or -1 for its fill
+	from  []int
+	fills []MemoryCell
+}
+
+// ? A table with columns and the rows of table, with the cells from says.
+// ? Columns changed one after the other with no rows added in between are
+// ? read from the table they were first changed in.
+func alteredTable(table *Table, columns []string, types []ColumnType, from []int, fills []MemoryCell) *Table {
+	source, rows := table.storage()
+	altered := &alteredRows{table: &Table{rows: rows, stored: source}, from: from, fills: fills}
+	if ar, ok := source.(*alteredRows); ok && rows.count == 0 {
+		altered = &alteredRows{table: ar.table, from: make([]int, len(from)), fills: make([]MemoryCell, len(from))}
+		for i, j := range from {
+			if j < 0 {
+				altered.from[i], altered.fills[i] = -1, fills[i]
+				continue
+			}
+			altered.from[i], altered.fills[i] = ar.from[j], ar.fills[j]
+		}
+	}
+	return &Table{
+		Columns:     columns,
+		ColumnTypes: types,
+		rows:        rowTree{next: uint64(altered.len())},
+		stored:      altered,
+	}
+}
+
+func (ar *alteredRows) len() int {
+	return ar.table.len()
+}
+
+func (ar *alteredRows) each(from, to int, fn func(row []MemoryCell) error) error {
+	return ar.table.scan(uint64(from), uint64(to), func(id uint64, row []MemoryCell) error {
+		altered := make([]MemoryCell, len(ar.from))
+		for i, j := range ar.from {
+			if j < 0 {
+				altered[i] = ar.fills[i]
+			} else {
+				altered[i] = row[j]
+			}
+		}
+		return fn(altered)
+	})
+}
+
+func columnIndex(table *Table, column string) int {
+	for i, col := range table.Columns {
+		if col == column {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,172 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? ALTER TABLE and DROP VIEW are refused when a view would no longer work
+func TestAlterDependentViews(t *testing.T) {
+	mb := NewMemoryBackend()
+	mustExecute(t, mb, "CREATE TABLE t (a INT, b INT, c INT); INSERT INTO t VALUES (1, 2, 3);")
+	mustExecute(t, mb, "CREATE VIEW v AS SELECT a, b FROM t;")
+	mustExecute(t, mb, "CREATE VIEW w AS SELECT * FROM v;")
+
+	for _, sql := range []string{
+		"ALTER TABLE t DROP COLUMN a;",
+		"ALTER TABLE t RENAME COLUMN b TO d;",
+		"ALTER TABLE t RENAME TO u;",
+		"DROP VIEW v;",
+	} {
+		if _, err := execute(mb, sql); !errors.Is(err, ErrDependentView) {
+			t.Errorf("%s: got %v, want ErrDependentView", sql, err)
+		}
+	}
+	// ? Nothing changed
+	results, err := execute(mb, "SELECT * FROM w;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Columns) != 2 || len(results.Rows) != 1 || results.Rows[0][1].AsInt() != 2 {
+		t.Errorf("got %d columns and %d rows, want 2 and 1", len(results.Columns), len(results.Rows))
+	}
+
+	// ? Changes the views do not see are fine
+	mustExecute(t, mb, "ALTER TABLE t DROP COLUMN c;")
+	mustExecute(t, mb, "ALTER TABLE t ADD COLUMN c INT;")
+	mustExecute(t, mb, "ALTER TABLE t RENAME COLUMN c TO e;")
+
+	// ? A view selecting * from a table would change its columns
+	mustExecute(t, mb, "CREATE VIEW x AS SELECT * FROM t;")
+	if _, err := execute(mb, "ALTER TABLE t ADD COLUMN f INT;"); !errors.Is(err, ErrDependentView) {
+		t.Errorf("got %v adding a column, want ErrDependentView", err)
+	}
+	mustExecute(t, mb, "DROP VIEW x;")
+	mustExecute(t, mb, "ALTER TABLE t ADD COLUMN f INT;")
+
+	mustExecute(t, mb, "DROP VIEW w;")
+	mustExecute(t, mb, "DROP VIEW v;")
+	mustExecute(t, mb, "ALTER TABLE t RENAME TO u;")
+}
+
+// ? Added and dropped columns are read through the rows of the table they
+// ? were changed in, rows added in between included
+func TestAlterColumns(t *testing.T) {
+	mb := NewMemoryBackend()
+	mustExecute(t, mb, "CREATE TABLE t (a INT, b TEXT); INSERT INTO t VALUES (1, 'x');")
+	mustExecute(t, mb, "ALTER TABLE t ADD COLUMN c INT DEFAULT 3; ALTER TABLE t DROP COLUMN a;")
+	mustExecute(t, mb, "INSERT INTO t VALUES ('y', 4);")
+	mustExecute(t, mb, "ALTER TABLE t ADD COLUMN d TEXT DEFAULT 'z'; ALTER TABLE t DROP COLUMN c;")
+	mustExecute(t, mb, "INSERT INTO t VALUES ('w', 'v');")
+
+	want := "b d \nx z \ny z \nw v "
+	if got := dumpSelect(t, mb, "t"); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if n, err := count(mb, "SELECT sum(rowid) FROM t WHERE b <> 'x';"); err != nil || n != 3 {
+		t.Errorf("got row ids adding up to %d, want 3: %v", n, err)
+	}
+}
+
+// ? A DiskBackend writes the rows of a table whose columns changed to new
+// ? pages of its file, the log only gets where they are. They are read back
+// ? after a crash, and kept by the next checkpoint.
+func TestAlterWritesRowsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDiskBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.SetCacheSize(4); err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, db, "CREATE TABLE t (n INT, s TEXT);")
+	var inserts strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&inserts, "INSERT INTO t VALUES (%d, 'row %d');", i, i)
+	}
+	tx, err := db.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, tx, inserts.String())
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	size := walSize(t, path)
+	mustExecute(t, db, "ALTER TABLE t ADD COLUMN m INT DEFAULT 5; ALTER TABLE t DROP COLUMN s;")
+	if grown := walSize(t, path) - size; grown > 256 {
+		t.Errorf("the log grew by %d bytes, want only the columns and segments", grown)
+	}
+
+	check := func(db *DiskBackend, rows int64) {
+		t.Helper()
+		for _, test := range []struct {
+			sql  string
+			want int64
+		}{
+			{"SELECT count(*) FROM t;", rows},
+			{"SELECT sum(n) FROM t;", (rows - 1) * rows / 2},
+			{"SELECT sum(m) FROM t;", rows * 5},
+		} {
+			if n, err := count(db, test.sql); err != nil || n != test.want {
+				t.Errorf("%s got %d, want %d: %v", test.sql, n, test.want, err)
+			}
+		}
+		if got := dumpSelect(t, db, "t WHERE n = 7"); got != "n m \n7 5 " {
+			t.Errorf("got %q, want row 7 with m", got)
+		}
+	}
+	check(db, 2000)
+
+	// ? A crash, without a checkpoint
+	if err = db.close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = OpenDiskBackend(path); err != nil {
+		t.Fatal(err)
+	}
+	check(db, 2000)
+	mustExecute(t, db, "INSERT INTO t VALUES (2000, 5);")
+	if err = db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, db, "ALTER TABLE t ADD COLUMN o INT; ALTER TABLE t DROP COLUMN o;")
+	// ? The pages the rows were read from before are free once written
+	// ? again, and taken by other rows
+	if err = db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, db, "CREATE TABLE u (n INT, s TEXT);")
+	mustExecute(t, db, strings.Replace(inserts.String(), "INTO t", "INTO u", -1))
+	if err = db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	check(db, 2001)
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = OpenDiskBackend(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db, 2001)
+	free := make(map[pageID]bool)
+	for _, id := range db.pager.free {
+		free[id] = true
+	}
+	for _, seg := range db.stored["t"].rows.segments {
+		for _, id := range seg.pages {
+			if free[id] {
+				t.Fatalf("page %d of t is free", id)
+			}
+		}
+	}
+}
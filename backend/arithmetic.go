@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jameslahm/gosql/lex"
+)
+
+func compileArithmetic(op string, a, b *compiledExpression) (*compiledExpression, error) {
+	if !isNumericOrNull(a.Type) || !isNumericOrNull(b.Type) {
+		return nil, fmt.Errorf("%w: operator %s expects numeric operands, got %s and %s", ErrInvalidDataType, op, a.Type, b.Type)
+	}
+
+	// ? int operands widen to bigint when either side is a bigint
+	resultType := IntType
+	if a.Type == BigIntType || b.Type == BigIntType {
+		resultType = BigIntType
+	}
+
+	// ? NULL operands make the result NULL
+
+	return &compiledExpression{
+		Name: "?column?",
+		Type: resultType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			left, err := a.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			right, err := b.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if left == nil || right == nil {
+				return nil, nil
+			}
+			value, err := applyArithmetic(op, left.AsBigInt(), right.AsBigInt())
+			if err != nil {
+				return nil, err
+			}
+			return integerCell(value, resultType)
+		},
+	}, nil
+}
+
+func compileNegation(exp *compiledExpression) (*compiledExpression, error) {
+	if !isNumericOrNull(exp.Type) {
+		return nil, fmt.Errorf("%w: operator - expects a numeric operand, got %s", ErrInvalidDataType, exp.Type)
+	}
+
+	resultType := exp.Type
+	if resultType == NullType {
+		resultType = IntType
+	}
+
+	return &compiledExpression{
+		Name: "?column?",
+		Type: resultType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			cell, err := exp.eval(row)
+			if err != nil || cell == nil {
+				return nil, err
+			}
+			value, err := applyArithmetic(string(lex.MinusSymbol), 0, cell.AsBigInt())
+			if err != nil {
+				return nil, err
+			}
+			return integerCell(value, resultType)
+		},
+	}, nil
+}
+
+// ? text || text, numbers are converted to their text form
+func concatExpression(a, b *compiledExpression) *compiledExpression {
+	return &compiledExpression{
+		Name: "?column?",
+		Type: TextType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			left, err := a.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			right, err := b.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if left == nil || right == nil {
+				return nil, nil
+			}
+			return textCell(cellToString(left, a.Type) + cellToString(right, b.Type)), nil
+		},
+	}
+}
+
+func isNumericOrNull(t ColumnType) bool {
+	return isNumeric(t) || t == NullType
+}
+
+// ? 64-bit arithmetic that reports overflow instead of wrapping
+func applyArithmetic(op string, a, b int64) (int64, error) {
+	switch lex.Symbol(op) {
+	case lex.PlusSymbol:
+		if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+			return 0, fmt.Errorf("%w: %d + %d", ErrIntegerOutOfRange, a, b)
+		}
+		return a + b, nil
+	case lex.MinusSymbol:
+		if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+			return 0, fmt.Errorf("%w: %d - %d", ErrIntegerOutOfRange, a, b)
+		}
+		return a - b, nil
+	case lex.AsteriskSymbol:
+		if a == 0 || b == 0 {
+			return 0, nil
+		}
+		result := a * b
+		if result/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return 0, fmt.Errorf("%w: %d * %d", ErrIntegerOutOfRange, a, b)
+		}
+		return result, nil
+	case lex.SlashSymbol:
+		if b == 0 {
+			return 0, ErrDivisionByZero
+		}
+		if a == math.MinInt64 && b == -1 {
+			return 0, fmt.Errorf("%w: %d / %d", ErrIntegerOutOfRange, a, b)
+		}
+		return a / b, nil
+	case lex.PercentSymbol:
+		if b == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return a % b, nil
+	}
+	return 0, fmt.Errorf("%w: unknown operator %s", ErrInvalidExpression, op)
+}
+
+// ? Store an integer as the given type, failing if it does not fit
+func integerCell(value int64, t ColumnType) (MemoryCell, error) {
+	if t == BigIntType {
+		return bigIntCell(value), nil
+	}
+	if value < math.MinInt32 || value > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: %d does not fit in %s", ErrIntegerOutOfRange, value, t)
+	}
+	return intCell(int32(value)), nil
+}
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/jameslahm/gosql/ast"
 )
@@ -11,11 +12,34 @@ type ColumnType uint
 const (
 	TextType ColumnType = iota
 	IntType
+	BigIntType
+	BoolType
+	// ? Type of a bare NULL, it unifies with every other type
+	NullType
 )
 
+func (ct ColumnType) String() string {
+	switch ct {
+	case TextType:
+		return "text"
+	case IntType:
+		return "int"
+	case BigIntType:
+		return "bigint"
+	case BoolType:
+		return "bool"
+	case NullType:
+		return "null"
+	}
+	return fmt.Sprintf("ColumnType(%d)", uint(ct))
+}
+
 type Cell interface {
 	AsText() string
 	AsInt() int32
+	AsBigInt() int64
+	AsBool() bool
+	IsNull() bool
 }
 
 type ResultColumn struct {
@@ -29,15 +53,67 @@ type Results struct {
 }
 
 var (
-	ErrTableDoesNotExist  = errors.New("Table does not exits")
-	ErrColumnDoesNotExist = errors.New("Column does not exist")
-	ErrInvalidSelectItem  = errors.New("Select item is not valid")
-	ErrInvalidDataType    = errors.New("Invalid datatype")
-	ErrMissingValues      = errors.New("Missing values")
+	ErrTableDoesNotExist     = errors.New("Table does not exits")
+	ErrColumnDoesNotExist    = errors.New("Column does not exist")
+	ErrInvalidSelectItem     = errors.New("Select item is not valid")
+	ErrInvalidDataType       = errors.New("Invalid datatype")
+	ErrMissingValues         = errors.New("Missing values")
+	ErrInvalidExpression     = errors.New("Expression is not valid")
+	ErrIntegerOutOfRange     = errors.New("Integer out of range")
+	ErrDivisionByZero        = errors.New("Division by zero")
+	ErrFunctionDoesNotExist  = errors.New("Function does not exist")
+	ErrInvalidArguments      = errors.New("Invalid function arguments")
+	ErrFunctionAlreadyExists = errors.New("Function already exists")
+	ErrSubqueryMultipleRows  = errors.New("More than one row returned by a subquery used as an expression")
+	ErrRecursionLimit        = errors.New("Recursion limit exceeded")
+	ErrTableAlreadyExists    = errors.New("Table already exists")
+	ErrViewDoesNotExist      = errors.New("View does not exist")
+	ErrViewAlreadyExists     = errors.New("View already exists")
+	ErrColumnAlreadyExists   = errors.New("Column already exists")
+	ErrTransactionDone       = errors.New("Transaction has already been committed or rolled back")
+	ErrNoTransaction         = errors.New("No transaction is in progress")
+	ErrTransactionInProgress = errors.New("A transaction is already in progress")
+	ErrSavepointDoesNotExist = errors.New("Savepoint does not exist")
+	ErrSerializationFailure  = errors.New("Could not serialize access due to a concurrent update")
+	ErrDeadlock              = errors.New("Deadlock detected")
+	ErrLockTimeout           = errors.New("Lock timeout")
+	ErrCorruptDatabase       = errors.New("Database file is corrupt")
+	ErrSettingDoesNotExist   = errors.New("Setting does not exist")
+	ErrDependentView         = errors.New("Cannot change what a view depends on")
+	ErrLogRecordTooLarge     = errors.New("Change is too large to log")
 )
 
-type Backend interface {
+// ? Runs statements, either on its own where each statement is applied
+// ? immediately or as part of a transaction
+type Executor interface {
 	CreateTable(*ast.CreateTableStatement) error
 	Insert(*ast.InsertStatement) error
 	Select(*ast.SelectStatement) (*Results, error)
+	CreateView(*ast.CreateViewStatement) error
+	DropView(*ast.DropViewStatement) error
+	RefreshView(*ast.RefreshViewStatement) error
+	AlterTable(*ast.AlterTableStatement) error
+}
+
+// ? Statements of a transaction see each other's changes, which are applied
+// ? all together by Commit or dropped by Rollback. Either ends it.
+// ? Savepoints mark a point RollbackToSavepoint can go back to without ending
+// ? the transaction, ReleaseSavepoint forgets the mark and keeps the changes.
+type Transaction interface {
+	Executor
+	Commit() error
+	Rollback() error
+	Savepoint(name string) error
+	ReleaseSavepoint(name string) error
+	RollbackToSavepoint(name string) error
+}
+
+// ? Commit fails with ErrSerializationFailure when the transaction conflicts
+// ? with one committed before it, running it again from the start can succeed.
+// ? Set changes a setting for every statement run from then on, whether in a
+// ? transaction or not.
+type Backend interface {
+	Executor
+	Begin(*ast.BeginStatement) (Transaction, error)
+	Set(*ast.SetStatement) error
 }
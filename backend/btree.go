@@ -0,0 +1,253 @@
+package backend
+
+import "sort"
+
+// ? Most ids a node of a rowTree holds
+const btreeNodeSize = 64
+
+// ? Rows keyed by row id in a B+tree. Leaves hold the rows, inner nodes hold
+// ? the smallest id under each of their children. Nodes are never changed
+// ? once built: adding a row copies the nodes on the path to its leaf, so
+// ? every version of a table has a tree of its own that shares all other
+// ? nodes with the version it came from. The zero value has no rows.
+// ?
+// ? The tree only holds rows in memory. Rows a DiskBackend wrote to its file
+// ? are in storedRows and those of an LSMBackend in lsmRows, both of which
+// ? seek to a row id too. Rows are never deleted, since no statement does
+// ? that, and tables have no other index.
+type rowTree struct {
+	root  *btreeNode
+	count int
+	// ? The id the next row appended gets
+	next uint64
+}
+
+type btreeNode struct {
+	ids []uint64
+	// ? Set in leaves
+	rows [][]MemoryCell
+	// ? Set in inner nodes
+	children []*btreeNode
+}
+
+// ? A tree of rows numbered from first, built a level at a time with full
+// ? nodes
+func buildRowTree(first uint64, rows [][]MemoryCell) rowTree {
+	b := rowTreeBuilder{first: first}
+	for _, row := range rows {
+		b.add(row)
+	}
+	return b.tree()
+}
+
+// ? Builds the tree of rows added one at a time, numbered from first. Leaves
+// ? are filled as rows come in, the levels above them when the tree is done.
+type rowTreeBuilder struct {
+	first  uint64
+	count  int
+	leaves []*btreeNode
+}
+
+func (b *rowTreeBuilder) add(row []MemoryCell) {
+	if len(b.leaves) == 0 || len(b.leaves[len(b.leaves)-1].ids) == btreeNodeSize {
+		b.leaves = append(b.leaves, &btreeNode{
+			ids:  make([]uint64, 0, btreeNodeSize),
+			rows: make([][]MemoryCell, 0, btreeNodeSize),
+		})
+	}
+	leaf := b.leaves[len(b.leaves)-1]
+	leaf.ids = append(leaf.ids, b.first+uint64(b.count))
+	leaf.rows = append(leaf.rows, row)
+	b.count++
+}
+
+func (b *rowTreeBuilder) tree() rowTree {
+	t := rowTree{count: b.count, next: b.first + uint64(b.count)}
+	if b.count == 0 {
+		return t
+	}
+
+	level := b.leaves
+	for len(level) > 1 {
+		var parents []*btreeNode
+		for i := 0; i < len(level); i += btreeNodeSize {
+			end := i + btreeNodeSize
+			if end > len(level) {
+				end = len(level)
+			}
+			parent := &btreeNode{children: level[i:end:end]}
+			for _, child := range parent.children {
+				parent.ids = append(parent.ids, child.ids[0])
+			}
+			parents = append(parents, parent)
+		}
+		level = parents
+	}
+	t.root = level[0]
+	return t
+}
+
+// ? The tree with row added under the next id
+func (t rowTree) append(row []MemoryCell) rowTree {
+	appended := t.insert(t.next, row)
+	appended.next = t.next + 1
+	return appended
+}
+
+// ? The tree with row under id, in place of the row already there if any
+func (t rowTree) insert(id uint64, row []MemoryCell) rowTree {
+	if t.root == nil {
+		t.root = &btreeNode{ids: []uint64{id}, rows: [][]MemoryCell{row}}
+		t.count = 1
+		return t
+	}
+
+	left, right, added := t.root.insert(id, row)
+	t.root = left
+	if right != nil {
+		t.root = &btreeNode{
+			ids:      []uint64{left.ids[0], right.ids[0]},
+			children: []*btreeNode{left, right},
+		}
+	}
+	if added {
+		t.count++
+	}
+	return t
+}
+
+// ? A copy of n with row under id, split in two when that makes it too
+// ? large. Whether the row is new to the tree is returned as well.
+func (n *btreeNode) insert(id uint64, row []MemoryCell) (*btreeNode, *btreeNode, bool) {
+	copied := &btreeNode{}
+	var i int
+	added := true
+	if n.children == nil {
+		i = sort.Search(len(n.ids), func(i int) bool { return n.ids[i] >= id })
+		if i < len(n.ids) && n.ids[i] == id {
+			copied.ids = n.ids
+			copied.rows = append([][]MemoryCell{}, n.rows...)
+			copied.rows[i] = row
+			return copied, nil, false
+		}
+		copied.ids = insertID(n.ids, i, id)
+		copied.rows = insertRow(n.rows, i, row)
+	} else {
+		i = n.child(id)
+		var left, right *btreeNode
+		left, right, added = n.children[i].insert(id, row)
+		copied.ids = append([]uint64{}, n.ids...)
+		copied.ids[i] = left.ids[0]
+		copied.children = append([]*btreeNode{}, n.children...)
+		copied.children[i] = left
+		if right == nil {
+			return copied, nil, added
+		}
+		i++
+		copied.ids = insertID(copied.ids, i, right.ids[0])
+		copied.children = insertNode(copied.children, i, right)
+	}
+	if len(copied.ids) <= btreeNodeSize {
+		return copied, nil, added
+	}
+
+	// ? Appending splits off only the new entry, so a table that only grows
+	// ? is made of full nodes
+	at := len(copied.ids) / 2
+	if i == len(copied.ids)-1 {
+		at = len(copied.ids) - 1
+	}
+	right := &btreeNode{ids: copied.ids[at:]}
+	copied.ids = copied.ids[:at:at]
+	if copied.children == nil {
+		right.rows = copied.rows[at:]
+		copied.rows = copied.rows[:at:at]
+	} else {
+		right.children = copied.children[at:]
+		copied.children = copied.children[:at:at]
+	}
+	return copied, right, added
+}
+
+// ? The index of the child of an inner node that id belongs under
+func (n *btreeNode) child(id uint64) int {
+	i := sort.Search(len(n.ids), func(i int) bool { return n.ids[i] > id }) - 1
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+func insertID(ids []uint64, i int, id uint64) []uint64 {
+	inserted := make([]uint64, 0, len(ids)+1)
+	inserted = append(inserted, ids[:i]...)
+	inserted = append(inserted, id)
+	return append(inserted, ids[i:]...)
+}
+
+func insertRow(rows [][]MemoryCell, i int, row []MemoryCell) [][]MemoryCell {
+	inserted := make([][]MemoryCell, 0, len(rows)+1)
+	inserted = append(inserted, rows[:i]...)
+	inserted = append(inserted, row)
+	return append(inserted, rows[i:]...)
+}
+
+func insertNode(nodes []*btreeNode, i int, node *btreeNode) []*btreeNode {
+	inserted := make([]*btreeNode, 0, len(nodes)+1)
+	inserted = append(inserted, nodes[:i]...)
+	inserted = append(inserted, node)
+	return append(inserted, nodes[i:]...)
+}
+
+// ? The row under id
+func (t rowTree) get(id uint64) ([]MemoryCell, bool) {
+	n := t.root
+	if n == nil {
+		return nil, false
+	}
+	for n.children != nil {
+		n = n.children[n.child(id)]
+	}
+	i := sort.Search(len(n.ids), func(i int) bool { return n.ids[i] >= id })
+	if i < len(n.ids) && n.ids[i] == id {
+		return n.rows[i], true
+	}
+	return nil, false
+}
+
+// ? Call fn with the rows from id from on in the order of their ids, going
+// ? through the leaves from the one from is in, until fn returns false
+func (t rowTree) ascend(from uint64, fn func(id uint64, row []MemoryCell) bool) {
+	if t.root != nil {
+		t.root.ascend(from, fn)
+	}
+}
+
+func (n *btreeNode) ascend(from uint64, fn func(id uint64, row []MemoryCell) bool) bool {
+	if n.children == nil {
+		i := sort.Search(len(n.ids), func(i int) bool { return n.ids[i] >= from })
+		for ; i < len(n.ids); i++ {
+			if !fn(n.ids[i], n.rows[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := n.child(from); i < len(n.children); i++ {
+		if !n.children[i].ascend(from, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// ? The rows from id from on
+func (t rowTree) slice(from uint64) [][]MemoryCell {
+	var rows [][]MemoryCell
+	t.ascend(from, func(id uint64, row []MemoryCell) bool {
+		rows = append(rows, row)
+		return true
+	})
+	return rows
+}
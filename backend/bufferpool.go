@@ -0,0 +1,242 @@
+package backend
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+const defaultCachePages = 1024
+
+type CacheStats struct {
+	// ? Pages found in the pool and pages read from the file
+	Hits   uint64
+	Misses uint64
+	// ? Pages dropped to make room, and dirty pages written back
+	Evictions uint64
+	Writes    uint64
+	Pages     int
+	Capacity  int
+}
+
+type frame struct {
+	id         pageID
+	data       []byte
+	pins       int
+	dirty      bool
+	referenced bool
+}
+
+// ? Keeps up to capacity pages of a file in memory. A pinned page stays
+// ? until it is unpinned, the others are evicted by the CLOCK policy: the
+// ? hand goes round the frames and takes the first one that was not used
+// ? since it last passed. Dirty pages are written back when evicted or
+// ? flushed.
+type bufferPool struct {
+	mu sync.Mutex
+	// ? Signalled when a page is unpinned, for those waiting for a frame
+	unpinned *sync.Cond
+	file     *os.File
+	capacity int
+	frames   []*frame
+	pages    map[pageID]*frame
+	hand     int
+	stats    CacheStats
+}
+
+func newBufferPool(file *os.File, capacity int) *bufferPool {
+	bp := &bufferPool{
+		file:     file,
+		capacity: capacity,
+		pages:    make(map[pageID]*frame),
+	}
+	bp.unpinned = sync.NewCond(&bp.mu)
+	return bp
+}
+
+// ? Pin page id, reading it from the file unless it is in the pool. Pages
+// ? past the end of the file read as zeros.
+func (bp *bufferPool) pin(id pageID) (*frame, error) {
+	return bp.pinPage(id, true)
+}
+
+// ? Pin page id to overwrite all of it, without reading it
+func (bp *bufferPool) pinNew(id pageID) (*frame, error) {
+	return bp.pinPage(id, false)
+}
+
+func (bp *bufferPool) pinPage(id pageID, read bool) (*frame, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if f, ok := bp.pages[id]; ok {
+		bp.stats.Hits++
+		f.pins++
+		f.referenced = true
+		return f, nil
+	}
+
+	f, err := bp.free()
+	if err != nil {
+		return nil, err
+	}
+	// ? Another caller may have read the page while free waited
+	if loaded, ok := bp.pages[id]; ok {
+		bp.release(f)
+		bp.stats.Hits++
+		loaded.pins++
+		loaded.referenced = true
+		return loaded, nil
+	}
+	if read {
+		bp.stats.Misses++
+		n, err := bp.file.ReadAt(f.data, int64(id)*pageSize)
+		switch {
+		case err == io.EOF:
+			for i := n; i < len(f.data); i++ {
+				f.data[i] = 0
+			}
+		case err != nil:
+			bp.release(f)
+			return nil, err
+		}
+	} else {
+		for i := range f.data {
+			f.data[i] = 0
+		}
+	}
+
+	f.id, f.pins, f.dirty, f.referenced = id, 1, false, true
+	bp.pages[id] = f
+	return f, nil
+}
+
+// ? A frame holding no page, evicting one when the pool is full and
+// ? waiting for one to be unpinned when every page is. It is pinned, so no
+// ? one else takes it before it is used or released.
+func (bp *bufferPool) free() (*frame, error) {
+	for {
+		if len(bp.frames) < bp.capacity {
+			f := &frame{data: make([]byte, pageSize), pins: 1}
+			bp.frames = append(bp.frames, f)
+			return f, nil
+		}
+
+		// ? Twice round clears every reference bit on the way
+		for i := 0; i < 2*len(bp.frames); i++ {
+			f := bp.frames[bp.hand]
+			bp.hand = (bp.hand + 1) % len(bp.frames)
+			if f.pins > 0 {
+				continue
+			}
+			if f.referenced && bp.holds(f) {
+				f.referenced = false
+				continue
+			}
+			if err := bp.evict(f); err != nil {
+				return nil, err
+			}
+			f.pins = 1
+			return f, nil
+		}
+		bp.unpinned.Wait()
+	}
+}
+
+// ? Give back a frame from free that was not used
+func (bp *bufferPool) release(f *frame) {
+	f.pins, f.referenced = 0, false
+	bp.unpinned.Broadcast()
+}
+
+// ? Whether f holds a page, rather than being free
+func (bp *bufferPool) holds(f *frame) bool {
+	return bp.pages[f.id] == f
+}
+
+func (bp *bufferPool) evict(f *frame) error {
+	if !bp.holds(f) {
+		return nil
+	}
+	if err := bp.writeBack(f); err != nil {
+		return err
+	}
+	delete(bp.pages, f.id)
+	bp.stats.Evictions++
+	return nil
+}
+
+func (bp *bufferPool) writeBack(f *frame) error {
+	if !f.dirty {
+		return nil
+	}
+	if _, err := bp.file.WriteAt(f.data, int64(f.id)*pageSize); err != nil {
+		return err
+	}
+	f.dirty = false
+	bp.stats.Writes++
+	return nil
+}
+
+func (bp *bufferPool) unpin(f *frame, dirty bool) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	f.pins--
+	f.dirty = f.dirty || dirty
+	if f.pins == 0 {
+		bp.unpinned.Broadcast()
+	}
+}
+
+// ? Write every dirty page back to the file
+func (bp *bufferPool) flush() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for _, f := range bp.frames {
+		if err := bp.writeBack(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ? Change how many pages the pool holds, evicting pages until it holds no
+// ? more than that
+func (bp *bufferPool) resize(capacity int) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	bp.capacity = capacity
+	for len(bp.frames) > capacity {
+		i := 0
+		for i < len(bp.frames) && bp.frames[i].pins > 0 {
+			i++
+		}
+		if i == len(bp.frames) {
+			bp.unpinned.Wait()
+			continue
+		}
+
+		f := bp.frames[i]
+		if err := bp.evict(f); err != nil {
+			return err
+		}
+		bp.frames = append(bp.frames[:i], bp.frames[i+1:]...)
+	}
+	if bp.hand >= len(bp.frames) {
+		bp.hand = 0
+	}
+	return nil
+}
+
+func (bp *bufferPool) getStats() CacheStats {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	stats := bp.stats
+	stats.Pages = len(bp.pages)
+	stats.Capacity = bp.capacity
+	return stats
+}
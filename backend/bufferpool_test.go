@@ -0,0 +1,271 @@
+package backend
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func openPool(t *testing.T, capacity int) *bufferPool {
+	t.Helper()
+	file, err := os.OpenFile(filepath.Join(t.TempDir(), "pages"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return newBufferPool(file, capacity)
+}
+
+func mustPin(t *testing.T, bp *bufferPool, id pageID) *frame {
+	t.Helper()
+	f, err := bp.pin(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// ? Pin a page and write its id to it
+func writePage(t *testing.T, bp *bufferPool, id pageID) {
+	t.Helper()
+	f := mustPin(t, bp, id)
+	f.data[0] = byte(id)
+	bp.unpin(f, true)
+}
+
+func pooledPages(bp *bufferPool) []pageID {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	var ids []pageID
+	for id := range bp.pages {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func filePage(t *testing.T, bp *bufferPool, id pageID) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(bp.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) < int64(id+1)*pageSize {
+		return nil
+	}
+	return data[int64(id)*pageSize : int64(id+1)*pageSize]
+}
+
+func TestBufferPoolPinAndUnpin(t *testing.T) {
+	bp := openPool(t, 4)
+
+	// ? Past the end of the file
+	f := mustPin(t, bp, 3)
+	if !bytes.Equal(f.data, make([]byte, pageSize)) {
+		t.Errorf("page past the end of the file is not zeros")
+	}
+	f.data[0] = 7
+	again := mustPin(t, bp, 3)
+	if again != f || again.pins != 2 {
+		t.Errorf("pinning a pooled page again got another frame or %d pins, want the same frame and 2", again.pins)
+	}
+	bp.unpin(f, true)
+	bp.unpin(again, false)
+	if f.pins != 0 || !f.dirty {
+		t.Errorf("got %d pins and dirty %v, want 0 and dirty", f.pins, f.dirty)
+	}
+	if f = mustPin(t, bp, 3); f.data[0] != 7 {
+		t.Errorf("got %d, want the 7 written before", f.data[0])
+	}
+	bp.unpin(f, false)
+
+	stats := bp.getStats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Pages != 1 || stats.Capacity != 4 {
+		t.Errorf("got %+v, want 2 hits, 1 miss and 1 of 4 pages", stats)
+	}
+}
+
+// ? The hand passes over referenced pages once, clearing their bit, and
+// ? takes the first page not used since
+func TestBufferPoolClockEviction(t *testing.T) {
+	bp := openPool(t, 3)
+	for id := pageID(1); id <= 3; id++ {
+		writePage(t, bp, id)
+	}
+
+	// ? Every page is referenced, so the hand goes round once and takes 1
+	writePage(t, bp, 4)
+	if got := pooledPages(bp); len(got) != 3 || got[0] != 2 {
+		t.Fatalf("got pages %v, want 2, 3 and 4", got)
+	}
+	// ? 2 is used again, so 3 goes next even though the hand reaches 2 first
+	bp.unpin(mustPin(t, bp, 2), false)
+	writePage(t, bp, 5)
+	if got := pooledPages(bp); len(got) != 3 || got[0] != 2 || got[1] != 4 || got[2] != 5 {
+		t.Fatalf("got pages %v, want 2, 4 and 5", got)
+	}
+
+	// ? Pinned pages are passed over however long they were not used
+	pinned := mustPin(t, bp, 2)
+	for id := pageID(6); id <= 9; id++ {
+		writePage(t, bp, id)
+	}
+	if got := pooledPages(bp); got[0] != 2 {
+		t.Errorf("got pages %v, want pinned page 2 among them", got)
+	}
+	bp.unpin(pinned, false)
+
+	stats := bp.getStats()
+	if stats.Evictions != 6 || stats.Misses != 9 {
+		t.Errorf("got %+v, want 6 evictions and 9 misses", stats)
+	}
+}
+
+// ? Dirty pages reach the file when evicted or flushed, clean ones are not
+// ? written
+func TestBufferPoolWriteBack(t *testing.T) {
+	bp := openPool(t, 2)
+	writePage(t, bp, 1)
+	bp.unpin(mustPin(t, bp, 2), false)
+	if page := filePage(t, bp, 1); page != nil {
+		t.Fatalf("page 1 was written before it was evicted")
+	}
+
+	writePage(t, bp, 3)
+	writePage(t, bp, 4)
+	if page := filePage(t, bp, 1); page == nil || page[0] != 1 {
+		t.Fatalf("evicted dirty page 1 is not in the file")
+	}
+	if stats := bp.getStats(); stats.Writes != 1 || stats.Evictions != 2 {
+		t.Errorf("got %+v, want 1 write and 2 evictions, clean page 2 is not written", stats)
+	}
+
+	if err := bp.flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []pageID{3, 4} {
+		if page := filePage(t, bp, id); page == nil || page[0] != byte(id) {
+			t.Errorf("flushed page %d is not in the file", id)
+		}
+	}
+	if err := bp.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := bp.getStats(); stats.Writes != 3 || stats.Pages != 2 {
+		t.Errorf("got %+v, want 3 writes and the 2 pages still pooled", stats)
+	}
+
+	// ? Read back from the file once evicted
+	writePage(t, bp, 5)
+	writePage(t, bp, 6)
+	if f := mustPin(t, bp, 1); f.data[0] != 1 {
+		t.Errorf("got %d reading page 1 back, want 1", f.data[0])
+	}
+}
+
+func TestBufferPoolResize(t *testing.T) {
+	bp := openPool(t, 4)
+	for id := pageID(1); id <= 4; id++ {
+		writePage(t, bp, id)
+	}
+	pinned := mustPin(t, bp, 1)
+
+	if err := bp.resize(2); err != nil {
+		t.Fatal(err)
+	}
+	got := pooledPages(bp)
+	if len(got) != 2 || got[0] != 1 {
+		t.Fatalf("got pages %v, want 2 pages with pinned page 1", got)
+	}
+	for _, id := range []pageID{2, 3, 4} {
+		if page := filePage(t, bp, id); (page == nil || page[0] != byte(id)) && id != got[1] {
+			t.Errorf("page %d was dropped without being written back", id)
+		}
+	}
+
+	// ? Shrinking below the pinned pages waits for them
+	resized := make(chan error)
+	go func() {
+		resized <- bp.resize(0)
+	}()
+	bp.unpin(pinned, false)
+	if err := <-resized; err != nil {
+		t.Fatal(err)
+	}
+	if stats := bp.getStats(); stats.Pages != 0 || stats.Capacity != 0 || len(bp.frames) != 0 {
+		t.Errorf("got %+v and %d frames, want none", stats, len(bp.frames))
+	}
+
+	if err := bp.resize(2); err != nil {
+		t.Fatal(err)
+	}
+	if f := mustPin(t, bp, 4); f.data[0] != 4 {
+		t.Errorf("got %d reading page 4 back, want 4", f.data[0])
+	}
+}
+
+// ? Callers waiting for a frame to read the same page into end up with the
+// ? one frame holding it
+func TestBufferPoolConcurrentMisses(t *testing.T) {
+	bp := openPool(t, 2)
+	first, second := mustPin(t, bp, 1), mustPin(t, bp, 2)
+
+	pinned := make(chan *frame)
+	for i := 0; i < 2; i++ {
+		go func() {
+			f, err := bp.pin(3)
+			if err != nil {
+				t.Error(err)
+			}
+			pinned <- f
+		}()
+	}
+	bp.unpin(first, false)
+	a := <-pinned
+	bp.unpin(second, false)
+	b := <-pinned
+	if a != b || a.pins != 2 {
+		t.Fatalf("got frames %p and %p with %d pins, want the same frame pinned twice", a, b, a.pins)
+	}
+	bp.unpin(a, false)
+	bp.unpin(b, false)
+
+	// ? A frame given back holds no page and no pins, so it is used for the
+	// ? next page
+	for _, f := range bp.frames {
+		if f.pins != 0 {
+			t.Errorf("frame of page %d still has %d pins", f.id, f.pins)
+		}
+	}
+	writePage(t, bp, 4)
+	if got := pooledPages(bp); len(got) != 2 || got[1] != 4 {
+		t.Errorf("got pages %v, want 4 and one other", got)
+	}
+}
+
+// ? Failing to read a page is an error, not a page of zeros
+func TestBufferPoolReadError(t *testing.T) {
+	bp := openPool(t, 2)
+	writePage(t, bp, 1)
+	if err := bp.flush(); err != nil {
+		t.Fatal(err)
+	}
+	bp.file.Close()
+
+	if _, err := bp.pin(2); err == nil {
+		t.Fatal("pinned a page of a closed file")
+	}
+	if _, err := bp.pin(2); err == nil {
+		t.Fatal("pinned a page of a closed file the second time")
+	}
+	if got := pooledPages(bp); len(got) != 1 || got[0] != 1 {
+		t.Errorf("got pages %v, want only page 1", got)
+	}
+	if f := mustPin(t, bp, 1); f.data[0] != 1 {
+		t.Errorf("got %d from pooled page 1, want 1", f.data[0])
+	}
+}
@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? Combine the rows of left and right, column names come from left and
+// ? each column takes the common type of both sides
+func compileSetOperation(operation *ast.SetOperation, left, right *compiledSelect) (*compiledSelect, error) {
+	name := setOperationName(operation)
+	if len(left.columns) != len(right.columns) {
+		return nil, fmt.Errorf("%w: each %s query must have the same number of columns, got %d and %d", ErrInvalidSelectItem, name, len(left.columns), len(right.columns))
+	}
+
+	var columns []ResultColumn
+	for i := range left.columns {
+		t, ok := unifyTypes([]ColumnType{left.columns[i].Type, right.columns[i].Type})
+		if !ok {
+			return nil, fmt.Errorf("%w: %s column %d cannot combine %s with %s", ErrInvalidDataType, name, i+1, left.columns[i].Type, right.columns[i].Type)
+		}
+		columns = append(columns, ResultColumn{
+			Name: left.columns[i].Name,
+			Type: t,
+		})
+	}
+
+	return &compiledSelect{
+		columns: columns,
+		run: func(outer []MemoryCell) ([][]MemoryCell, error) {
+			leftRows, err := left.run(outer)
+			if err != nil {
+				return nil, err
+			}
+			leftRows, err = castRows(leftRows, left.columns, columns)
+			if err != nil {
+				return nil, err
+			}
+			rightRows, err := right.run(outer)
+			if err != nil {
+				return nil, err
+			}
+			rightRows, err = castRows(rightRows, right.columns, columns)
+			if err != nil {
+				return nil, err
+			}
+			return combineRows(operation, resultTypes(columns), leftRows, rightRows), nil
+		},
+	}, nil
+}
+
+func setOperationName(operation *ast.SetOperation) string {
+	name := "UNION"
+	switch operation.Kind {
+	case ast.IntersectKind:
+		name = "INTERSECT"
+	case ast.ExceptKind:
+		name = "EXCEPT"
+	}
+	if operation.All {
+		name += " ALL"
+	}
+	return name
+}
+
+// ? Convert rows to the column types of the combined result, so equal values
+// ? are stored the same way on both sides
+func castRows(rows [][]MemoryCell, from, to []ResultColumn) ([][]MemoryCell, error) {
+	var casted [][]MemoryCell
+	for _, row := range rows {
+		castedRow := make([]MemoryCell, len(row))
+		for i, cell := range row {
+			var err error
+			castedRow[i], err = castCell(cell, from[i].Type, to[i].Type)
+			if err != nil {
+				return nil, err
+			}
+		}
+		casted = append(casted, castedRow)
+	}
+	return casted, nil
+}
+
+// ? Without ALL the result has no duplicate rows, with ALL a row that appears
+// ? m times on the left and n times on the right appears m+n times in UNION,
+// ? min(m, n) times in INTERSECT and max(m-n, 0) times in EXCEPT. Rows keep
+// ? the order they are first seen in.
+func combineRows(operation *ast.SetOperation, types []ColumnType, left, right [][]MemoryCell) [][]MemoryCell {
+	var rows [][]MemoryCell
+	seen := make(map[string]bool)
+	emit := func(row []MemoryCell) {
+		if operation.All {
+			rows = append(rows, row)
+			return
+		}
+		k := rowKey(row, types)
+		if !seen[k] {
+			seen[k] = true
+			rows = append(rows, row)
+		}
+	}
+
+	if operation.Kind == ast.UnionKind {
+		for _, row := range left {
+			emit(row)
+		}
+		for _, row := range right {
+			emit(row)
+		}
+		return rows
+	}
+
+	counts := make(map[string]int)
+	for _, row := range right {
+		counts[rowKey(row, types)]++
+	}
+	for _, row := range left {
+		k := rowKey(row, types)
+		inRight := counts[k] > 0
+		if operation.All && inRight {
+			counts[k]--
+		}
+		if inRight == (operation.Kind == ast.IntersectKind) {
+			emit(row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+type compiledWhen struct {
+	condition *compiledExpression
+	result    *compiledExpression
+}
+
+func (mb *MemoryBackend) compileCase(caseExp *ast.CaseExpression, s *scope) (*compiledExpression, error) {
+	var operand *compiledExpression
+	if caseExp.Operand != nil {
+		var err error
+		operand, err = mb.compileExpression(caseExp.Operand, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var whens []compiledWhen
+	var resultTypes []ColumnType
+	for _, when := range *caseExp.Whens {
+		condition, err := mb.compileExpression(when.Condition, s)
+		if err != nil {
+			return nil, err
+		}
+
+		// ? CASE x WHEN v is the same as CASE WHEN x = v
+		if operand != nil {
+			condition, err = compileComparison(string(lex.EqualSymbol), operand, condition)
+			if err != nil {
+				return nil, err
+			}
+		} else if !isBoolOrNull(condition.Type) {
+			return nil, fmt.Errorf("%w: WHEN expects a bool condition, got %s", ErrInvalidDataType, condition.Type)
+		}
+
+		result, err := mb.compileExpression(when.Result, s)
+		if err != nil {
+			return nil, err
+		}
+		whens = append(whens, compiledWhen{condition: condition, result: result})
+		resultTypes = append(resultTypes, result.Type)
+	}
+
+	var elseExp *compiledExpression
+	if caseExp.Else != nil {
+		var err error
+		elseExp, err = mb.compileExpression(caseExp.Else, s)
+		if err != nil {
+			return nil, err
+		}
+		resultTypes = append(resultTypes, elseExp.Type)
+	}
+
+	resultType, ok := unifyTypes(resultTypes)
+	if !ok {
+		return nil, fmt.Errorf("%w: CASE results of types %v cannot be matched", ErrInvalidDataType, resultTypes)
+	}
+
+	return &compiledExpression{
+		Name: "case",
+		Type: resultType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			for _, when := range whens {
+				matched, err := when.condition.eval(row)
+				if err != nil {
+					return nil, err
+				}
+				if matched == nil || !matched.AsBool() {
+					continue
+				}
+				cell, err := when.result.eval(row)
+				if err != nil {
+					return nil, err
+				}
+				return castCell(cell, when.result.Type, resultType)
+			}
+
+			if elseExp == nil {
+				return nil, nil
+			}
+			cell, err := elseExp.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			return castCell(cell, elseExp.Type, resultType)
+		},
+	}, nil
+}
@@ -0,0 +1,842 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? A Backend kept in a file. Statements run on a MemoryBackend, the changes
+// ? they make are recorded in a write-ahead log next to the file before they
+// ? return or anyone else sees them. When writing to the log fails the change
+// ? is undone. Checkpoints write the tables and views to the file and empty
+// ? the log.
+// ?
+// ? Rows added to a table are logged. A table that changed in any other way
+// ? has its rows written to new pages of the file instead, a page at a time,
+// ? and the log only gets where they are. Rows in the file are read through
+// ? a buffer pool of a fixed number of pages, only the rows added since they
+// ? were written are kept in memory.
+type DiskBackend struct {
+	persistentBackend
+	mu    sync.Mutex
+	pager *pager
+	log   *writeAheadLog
+	// ? The tables and views as they are in the file
+	stored       map[string]*storedTable
+	views        map[string]*View
+	catalogPages []pageID
+	// ? The tables and views as they are once the log is applied
+	logged *catalog
+	// ? Segments written for changes in the log since the last checkpoint
+	segments []*segment
+}
+
+const (
+	// ? The log is written to the file once it grows this large
+	checkpointLogSize = 4 << 20
+	// ? Rows added by a change are logged in records of about this size
+	logRowsSize = 1 << 20
+)
+
+type storedTable struct {
+	table *Table
+	rows  *storedRows
+}
+
+// ? Rows of a table in the file, in the segments written by successive
+// ? checkpoints. Versions of a table that grew from each other share them.
+// ? Segments are only ever appended to a table, not changed, so rather than
+// ? a tree in the file they are found by their counts and the row starting
+// ? in each page.
+type storedRows struct {
+	pager    *pager
+	width    int
+	count    int
+	segments []*segment
+}
+
+// ? Rows in a chain of pages. Every page but the last is full, so where a
+// ? row starts gives the page it starts in.
+type segment struct {
+	count int
+	// ? Bytes of rows in the chain of pages
+	size  int
+	pages []pageID
+	// ? The first row starting in each page that has one, in order
+	starts []rowStart
+}
+
+type rowStart struct {
+	row    int
+	offset int
+}
+
+// ? Open the database in the file at path, creating it when it does not
+// ? exist. Its log is kept in the file at path with -wal appended, changes
+// ? committed to it since the last checkpoint are applied again.
+func OpenDiskBackend(path string) (*DiskBackend, error) {
+	p, err := openPager(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DiskBackend{
+		pager:  p,
+		stored: make(map[string]*storedTable),
+		views:  make(map[string]*View),
+	}
+	db.persistentBackend = newPersistentBackend(db.persist)
+	used, err := db.load()
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+
+	log, changes, err := openLog(path+"-wal", p.checkpoint)
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	db.log = log
+	for _, records := range changes {
+		if err = db.apply(records, used); err != nil {
+			db.close()
+			return nil, err
+		}
+	}
+	p.setUsed(used)
+	db.logged = takeCatalog(db.Tables, db.Views)
+	return db, nil
+}
+
+// ? Read the catalog, returning the pages in use
+func (db *DiskBackend) load() (map[pageID]bool, error) {
+	used := make(map[pageID]bool)
+	if db.pager.root != 0 {
+		data, pages, err := db.pager.readChain(db.pager.root)
+		if err != nil {
+			return nil, err
+		}
+		db.catalogPages = pages
+		for _, id := range pages {
+			used[id] = true
+		}
+
+		tables, err := decodeCatalog(data, db.pager, db.views)
+		if err != nil {
+			return nil, err
+		}
+		for name, table := range tables {
+			rows := table.stored.(*storedRows)
+			table.rows = rowTree{next: uint64(rows.count)}
+			table.written.Store(table.stored)
+			db.stored[name] = &storedTable{table: table, rows: rows}
+			useSegments(used, rows)
+		}
+	}
+
+	for name, st := range db.stored {
+		db.Tables[name] = st.table
+	}
+	for name, view := range db.views {
+		db.Views[name] = view
+	}
+	return used, nil
+}
+
+func useSegments(used map[pageID]bool, rows *storedRows) {
+	for _, seg := range rows.segments {
+		for _, id := range seg.pages {
+			used[id] = true
+		}
+	}
+}
+
+// ? Apply the records of one change read back from the log, adding the
+// ? pages they point to to used
+func (db *DiskBackend) apply(records []*logRecord, used map[pageID]bool) error {
+	for _, record := range records {
+		name := record.name
+		switch record.kind {
+		case tableLogRecord:
+			d := &decoder{r: bytes.NewReader(record.data)}
+			table := decodeColumns(d)
+			rows := decodeSegments(d, db.pager, len(table.Columns))
+			if err := d.finish(); err != nil {
+				return err
+			}
+			table.stored = rows
+			table.rows = rowTree{next: uint64(rows.count)}
+			table.written.Store(rows)
+			db.Tables[name] = table
+			db.segments = append(db.segments, rows.segments...)
+			useSegments(used, rows)
+		case rowsLogRecord:
+			table, ok := db.Tables[name]
+			if !ok {
+				return fmt.Errorf("%w: log adds rows to missing table %s", ErrCorruptDatabase, name)
+			}
+			d := &decoder{r: bytes.NewReader(record.data)}
+			rows := decodeRows(d, len(table.Columns))
+			if err := d.finish(); err != nil {
+				return err
+			}
+			stored, tableRows := table.storage()
+			for _, row := range rows {
+				tableRows = tableRows.append(row)
+			}
+			db.Tables[name] = &Table{
+				Columns:     table.Columns,
+				ColumnTypes: table.ColumnTypes,
+				rows:        tableRows,
+				stored:      stored,
+			}
+		case dropTableLogRecord:
+			delete(db.Tables, name)
+		case viewLogRecord:
+			view, err := decodeView(record.data)
+			if err != nil {
+				return err
+			}
+			db.Views[name] = view
+		case dropViewLogRecord:
+			delete(db.Views, name)
+		default:
+			return fmt.Errorf("%w: unknown log record %d", ErrCorruptDatabase, record.kind)
+		}
+	}
+	return nil
+}
+
+// ? Write a checkpoint and close the files
+func (db *DiskBackend) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.checkpoint()
+	if closeErr := db.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (db *DiskBackend) close() error {
+	err := db.log.close()
+	if pagerErr := db.pager.close(); err == nil {
+		err = pagerErr
+	}
+	return err
+}
+
+// ? Record the tables and views that changed since they were last logged.
+// ? A table that only grew is logged as its new rows, any other table that
+// ? changed has its rows written to the file and is logged as its columns
+// ? and segments. Called with the MemoryBackend locked.
+// ?
+// ? The change is made once its records are durable. A checkpoint that fails
+// ? after that is tried again with the next change, the log still has
+// ? everything until one succeeds.
+func (db *DiskBackend) persist() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	current := takeCatalog(db.Tables, db.Views)
+
+	var records []*logRecord
+	written := make(map[*Table]*storedRows)
+	var segments []*segment
+	// ? Nothing else points to the segments written for a change that failed
+	fail := func(err error) error {
+		for _, seg := range segments {
+			db.pager.release(seg.pages)
+		}
+		return err
+	}
+	for name, table := range current.tables {
+		logged, ok := db.logged.tables[name]
+		if ok && logged == table {
+			continue
+		}
+		if rows, grew := appendedRows(logged, table); ok && grew {
+			records = append(records, rowsRecords(name, rows)...)
+			continue
+		}
+		rows, seg, err := db.writeRows(table)
+		if err != nil {
+			return fail(err)
+		}
+		if seg != nil {
+			segments = append(segments, seg)
+		}
+		var buf bytes.Buffer
+		putColumns(&buf, table)
+		putSegments(&buf, rows)
+		records = append(records, &logRecord{kind: tableLogRecord, name: name, data: buf.Bytes()})
+		written[table] = rows
+	}
+	for name := range db.logged.tables {
+		if _, ok := current.tables[name]; !ok {
+			records = append(records, &logRecord{kind: dropTableLogRecord, name: name})
+		}
+	}
+	for name, view := range current.views {
+		if db.logged.views[name] != view {
+			data, err := encodeView(view)
+			if err != nil {
+				return fail(err)
+			}
+			records = append(records, &logRecord{kind: viewLogRecord, name: name, data: data})
+		}
+	}
+	for name := range db.logged.views {
+		if _, ok := current.views[name]; !ok {
+			records = append(records, &logRecord{kind: dropViewLogRecord, name: name})
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	// ? The rows are in the file before the log points to them
+	if len(segments) > 0 {
+		if err := db.pager.sync(); err != nil {
+			return fail(err)
+		}
+	}
+	if err := db.log.append(records); err != nil {
+		return fail(err)
+	}
+	for table, rows := range written {
+		table.written.Store(rows)
+	}
+	db.segments = append(db.segments, segments...)
+	db.logged = current
+	if db.log.size >= checkpointLogSize {
+		db.checkpoint()
+	}
+	return nil
+}
+
+// ? Records of rows added to the table name, as many as it takes to keep
+// ? each about logRowsSize bytes. There is at least one.
+func rowsRecords(name string, rows [][]MemoryCell) []*logRecord {
+	var records []*logRecord
+	for start := 0; start == 0 || start < len(rows); {
+		var buf bytes.Buffer
+		end := start
+		for end < len(rows) && buf.Len() < logRowsSize {
+			putRow(&buf, rows[end])
+			end++
+		}
+		var data bytes.Buffer
+		putUvarint(&data, uint64(end-start))
+		data.Write(buf.Bytes())
+		records = append(records, &logRecord{kind: rowsLogRecord, name: name, data: data.Bytes()})
+		if end == len(rows) {
+			break
+		}
+		start = end
+	}
+	return records
+}
+
+// ? The rows table has after those of logged, when it only has more of them
+func appendedRows(logged, table *Table) ([][]MemoryCell, bool) {
+	if logged == nil || !sameColumns(logged, table) {
+		return nil, false
+	}
+	// ? Those a checkpoint wrote are all the rows of logged
+	if written, ok := logged.written.Load().(rowSource); ok && table.stored == written {
+		return table.rows.slice(0), true
+	}
+	if table.stored != logged.stored || table.rows.next < logged.rows.next {
+		return nil, false
+	}
+	// ? Rows are only ever added, a row is where it was added in every
+	// ? version that has it. So when table has the last row of logged in
+	// ? its place it grew from logged.
+	if logged.rows.count > 0 {
+		last := logged.rows.next - 1
+		row, _ := logged.rows.get(last)
+		other, ok := table.rows.get(last)
+		if !ok || len(row) != len(other) || len(row) > 0 && &row[0] != &other[0] {
+			return nil, false
+		}
+	}
+	return table.rows.slice(logged.rows.next), true
+}
+
+// ? Write everything in the log to the file, so the log can start over
+func (db *DiskBackend) Checkpoint() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.checkpoint()
+}
+
+// ? The new pages are made durable before the header points to them, so a
+// ? crash leaves the file as it was before the checkpoint or after it. In
+// ? both cases the header tells whether the log still needs to be applied.
+func (db *DiskBackend) checkpoint() error {
+	changed := len(db.logged.tables) != len(db.stored) || len(db.logged.views) != len(db.views)
+	stored := make(map[string]*storedTable)
+	var segments []*segment
+	fail := func(err error) error {
+		for _, seg := range segments {
+			db.pager.release(seg.pages)
+		}
+		return err
+	}
+	for name, table := range db.logged.tables {
+		if st, ok := db.stored[name]; ok && st.table == table {
+			stored[name] = st
+			continue
+		}
+		rows, seg, err := db.writeRows(table)
+		if err != nil {
+			return fail(err)
+		}
+		if seg != nil {
+			segments = append(segments, seg)
+		}
+		stored[name] = &storedTable{table: table, rows: rows}
+		changed = true
+	}
+	for name, view := range db.logged.views {
+		if db.views[name] != view {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	catalog, err := encodeCatalog(stored, db.logged.views)
+	if err != nil {
+		return fail(err)
+	}
+	catalogPages, err := db.pager.writeChain(catalog)
+	if err != nil {
+		return fail(err)
+	}
+	checkpoint := db.pager.checkpoint + 1
+	if err = db.pager.commit(catalogPages[0], checkpoint); err != nil {
+		return err
+	}
+
+	// ? Nothing reads the catalog once the file is open, but older versions
+	// ? of the tables can still be read from segments no longer in it.
+	// ? Segments are told apart by their first page, those read back from
+	// ? the log and from the catalog can be the same.
+	kept := make(map[pageID]bool)
+	for _, st := range stored {
+		st.table.written.Store(st.rows)
+		for _, seg := range st.rows.segments {
+			kept[seg.pages[0]] = true
+		}
+	}
+	var retired []pageID
+	retire := func(seg *segment) {
+		if !kept[seg.pages[0]] {
+			kept[seg.pages[0]] = true
+			retired = append(retired, seg.pages...)
+		}
+	}
+	for _, st := range db.stored {
+		for _, seg := range st.rows.segments {
+			retire(seg)
+		}
+	}
+	for _, seg := range db.segments {
+		retire(seg)
+	}
+	db.pager.release(db.catalogPages)
+	db.epochs.retire(func() { db.pager.release(retired) })
+	db.stored, db.views, db.catalogPages = stored, db.logged.views, catalogPages
+	db.segments = nil
+	return db.log.reset(checkpoint)
+}
+
+// ? The rows of table in the file. Those already there stay where they are,
+// ? the others are written to a new segment a row at a time, which is
+// ? returned too. Rows made from those of another table, as by ALTER TABLE,
+// ? are all written again.
+func (db *DiskBackend) writeRows(table *Table) (*storedRows, *segment, error) {
+	source, rows := table.storage()
+	stored, ok := source.(*storedRows)
+	if ok && rows.count == 0 {
+		return stored, nil, nil
+	}
+
+	written := &storedRows{pager: db.pager, width: len(table.Columns)}
+	if ok {
+		written.segments = append(written.segments, stored.segments...)
+		written.count = stored.count
+	}
+	unwritten := &Table{rows: rows, stored: source}
+	if unwritten.len() == written.count {
+		return written, nil, nil
+	}
+
+	w := newChainWriter(db.pager)
+	seg := &segment{}
+	var buf bytes.Buffer
+	err := unwritten.scan(uint64(written.count), math.MaxUint64, func(id uint64, row []MemoryCell) error {
+		last := len(seg.starts) - 1
+		if last < 0 || seg.starts[last].offset/chainDataSize != w.size/chainDataSize {
+			seg.starts = append(seg.starts, rowStart{row: seg.count, offset: w.size})
+		}
+		buf.Reset()
+		putRow(&buf, row)
+		seg.count++
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		db.pager.release(w.pages)
+		return nil, nil, err
+	}
+	if seg.pages, err = w.close(); err != nil {
+		return nil, nil, err
+	}
+	seg.size = w.size
+	written.segments = append(written.segments, seg)
+	written.count += seg.count
+	return written, seg, nil
+}
+
+func (sr *storedRows) len() int {
+	return sr.count
+}
+
+// ? Rows are decoded as the pages of their segment are read, a page at a
+// ? time. Segments before from are skipped without reading them, and so are
+// ? the pages of its segment before the one row from starts in.
+func (sr *storedRows) each(from, to int, fn func(row []MemoryCell) error) error {
+	first := 0
+	for _, seg := range sr.segments {
+		if first >= to {
+			break
+		}
+		if first+seg.count <= from {
+			first += seg.count
+			continue
+		}
+		d, i, err := seg.seek(sr.pager, from-first)
+		if err != nil {
+			return err
+		}
+		for ; i < seg.count && first+i < to; i++ {
+			row := decodeRow(d, sr.width)
+			if d.err != nil {
+				break
+			}
+			if first+i < from {
+				continue
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		// ? The rest of a segment left unread is not checked
+		if i < seg.count && d.err == nil {
+			break
+		}
+		if err := d.finish(); err != nil {
+			return err
+		}
+		first += seg.count
+	}
+	return nil
+}
+
+// ? A decoder reading the segment from the last row starting in a page
+// ? that is not after row, and the number of that row
+func (seg *segment) seek(p *pager, row int) (*decoder, int, error) {
+	i := sort.Search(len(seg.starts), func(i int) bool {
+		return seg.starts[i].row > row
+	}) - 1
+	if i < 0 {
+		return &decoder{r: &chainReader{pager: p, pages: seg.pages, left: seg.size}}, 0, nil
+	}
+
+	start := seg.starts[i]
+	page := start.offset / chainDataSize
+	if page >= len(seg.pages) || start.offset > seg.size {
+		return nil, 0, fmt.Errorf("%w: row %d starts past its segment", ErrCorruptDatabase, start.row)
+	}
+	r := &chainReader{pager: p, pages: seg.pages[page:], left: seg.size - page*chainDataSize}
+	if _, err := io.ReadFull(r, make([]byte, start.offset-page*chainDataSize)); err != nil {
+		return nil, 0, err
+	}
+	return &decoder{r: r}, start.row, nil
+}
+
+// ? How many pages of the file are kept in memory, at least one. Defaults
+// ? to 1024, which is 4 MiB.
+func (db *DiskBackend) SetCacheSize(pages int) error {
+	if pages < 1 {
+		pages = 1
+	}
+	return db.pager.pool.resize(pages)
+}
+
+func (db *DiskBackend) CacheStats() CacheStats {
+	return db.pager.pool.getStats()
+}
+
+func putColumns(buf *bytes.Buffer, table *Table) {
+	putUvarint(buf, uint64(len(table.Columns)))
+	for i, name := range table.Columns {
+		putBytes(buf, []byte(name))
+		putUvarint(buf, uint64(table.ColumnTypes[i]))
+	}
+}
+
+func putRow(buf *bytes.Buffer, row []MemoryCell) {
+	for _, cell := range row {
+		if cell == nil {
+			buf.WriteByte(0)
+			continue
+		}
+		buf.WriteByte(1)
+		putBytes(buf, cell)
+	}
+}
+
+func decodeColumns(d *decoder) *Table {
+	table := &Table{}
+	columns := d.uvarint()
+	for i := uint64(0); i < columns && d.err == nil; i++ {
+		table.Columns = append(table.Columns, string(d.bytes()))
+		table.ColumnTypes = append(table.ColumnTypes, ColumnType(d.uvarint()))
+	}
+	return table
+}
+
+func decodeRows(d *decoder, width int) [][]MemoryCell {
+	var rows [][]MemoryCell
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		rows = append(rows, decodeRow(d, width))
+	}
+	return rows
+}
+
+func decodeRow(d *decoder, width int) []MemoryCell {
+	row := make([]MemoryCell, width)
+	for j := range row {
+		if d.byte() == 1 {
+			row[j] = d.bytes()
+		}
+	}
+	return row
+}
+
+// ? The catalog is the columns of each table and the segments of its rows,
+// ? followed by the views
+func encodeCatalog(tables map[string]*storedTable, views map[string]*View) ([]byte, error) {
+	var buf bytes.Buffer
+	putUvarint(&buf, uint64(len(tables)))
+	for name, st := range tables {
+		putBytes(&buf, []byte(name))
+		putColumns(&buf, st.table)
+		putSegments(&buf, st.rows)
+	}
+
+	putUvarint(&buf, uint64(len(views)))
+	for name, view := range views {
+		data, err := encodeView(view)
+		if err != nil {
+			return nil, err
+		}
+		putBytes(&buf, []byte(name))
+		putBytes(&buf, data)
+	}
+	return buf.Bytes(), nil
+}
+
+func putSegments(buf *bytes.Buffer, rows *storedRows) {
+	putUvarint(buf, uint64(len(rows.segments)))
+	for _, seg := range rows.segments {
+		putUvarint(buf, uint64(seg.count))
+		putUvarint(buf, uint64(seg.size))
+		putUvarint(buf, uint64(len(seg.pages)))
+		for _, id := range seg.pages {
+			putUvarint(buf, uint64(id))
+		}
+		putUvarint(buf, uint64(len(seg.starts)))
+		previous := rowStart{}
+		for _, start := range seg.starts {
+			putUvarint(buf, uint64(start.row-previous.row))
+			putUvarint(buf, uint64(start.offset-previous.offset))
+			previous = start
+		}
+	}
+}
+
+// ? Every segment has at least one page
+func decodeSegments(d *decoder, p *pager, width int) *storedRows {
+	rows := &storedRows{pager: p, width: width}
+	segments := d.uvarint()
+	for i := uint64(0); i < segments && d.err == nil; i++ {
+		seg := &segment{count: int(d.uvarint()), size: int(d.uvarint())}
+		pages := d.uvarint()
+		for j := uint64(0); j < pages && d.err == nil; j++ {
+			seg.pages = append(seg.pages, pageID(d.uvarint()))
+		}
+		starts := d.uvarint()
+		previous := rowStart{}
+		for j := uint64(0); j < starts && d.err == nil; j++ {
+			previous.row += int(d.uvarint())
+			previous.offset += int(d.uvarint())
+			seg.starts = append(seg.starts, previous)
+		}
+		if len(seg.pages) == 0 && d.err == nil {
+			d.err = fmt.Errorf("%w: segment without pages", ErrCorruptDatabase)
+		}
+		rows.segments = append(rows.segments, seg)
+		rows.count += seg.count
+	}
+	return rows
+}
+
+func decodeCatalog(data []byte, p *pager, views map[string]*View) (map[string]*Table, error) {
+	d := &decoder{r: bytes.NewReader(data)}
+	tables := make(map[string]*Table)
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		name := string(d.bytes())
+		table := decodeColumns(d)
+		table.stored = decodeSegments(d, p, len(table.Columns))
+		tables[name] = table
+	}
+
+	count = d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		name := string(d.bytes())
+		view, err := decodeView(d.bytes())
+		if err != nil && d.err == nil {
+			d.err = err
+		}
+		views[name] = view
+	}
+	return tables, d.finish()
+}
+
+// ? Views are stored as the SQL text of their select, which is parsed again
+// ? when they are read back
+func encodeView(view *View) ([]byte, error) {
+	if view.Query == "" {
+		return nil, fmt.Errorf("%w: view has no query text to store", ErrInvalidSelectItem)
+	}
+	var buf bytes.Buffer
+	putUvarint(&buf, uint64(len(view.Columns)))
+	for _, name := range view.Columns {
+		putBytes(&buf, []byte(name))
+	}
+	materialized := byte(0)
+	if view.Materialized {
+		materialized = 1
+	}
+	buf.WriteByte(materialized)
+	putBytes(&buf, []byte(view.Query))
+	return buf.Bytes(), nil
+}
+
+func decodeView(data []byte) (*View, error) {
+	d := &decoder{r: bytes.NewReader(data)}
+	view := &View{}
+	columns := d.uvarint()
+	for i := uint64(0); i < columns && d.err == nil; i++ {
+		view.Columns = append(view.Columns, string(d.bytes()))
+	}
+	view.Materialized = d.byte() == 1
+	view.Query = string(d.bytes())
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+
+	tokens, err := lex.Lex(view.Query + ";")
+	if err != nil {
+		return nil, fmt.Errorf("%w: view query %q: %s", ErrCorruptDatabase, view.Query, err)
+	}
+	program, err := ast.Parse(tokens)
+	if err != nil || len(program.Statements) != 1 || program.Statements[0].Kind != ast.SelectKind {
+		return nil, fmt.Errorf("%w: view query %q is not a select", ErrCorruptDatabase, view.Query)
+	}
+	view.Select = program.Statements[0].SelectStatement
+	return view, nil
+}
+
+func putUvarint(buf *bytes.Buffer, n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], n)])
+}
+
+func putBytes(buf *bytes.Buffer, b []byte) {
+	putUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+// ? Reads what put functions wrote, the first error stops the reading and
+// ? every read after it returns zero values
+type decoder struct {
+	r interface {
+		io.Reader
+		io.ByteReader
+		// ? Bytes left to read
+		Len() int
+	}
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	d.err = err
+	return n
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.err = err
+	return b
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(d.r.Len()) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return b
+}
+
+func (d *decoder) finish() error {
+	if d.err == nil && d.r.Len() > 0 {
+		d.err = fmt.Errorf("%d bytes left over", d.r.Len())
+	}
+	if d.err != nil {
+		return fmt.Errorf("%w: %s", ErrCorruptDatabase, d.err)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? Columns an expression is allowed to refer to. A nested select sees its
+// ? own columns followed by the columns of the enclosing scope, and at run
+// ? time the enclosing row is appended to each of its rows.
+type scope struct {
+	columns []string
+	// ? Table name or alias each column can be qualified with
+	tables []string
+	types  []ColumnType
+	// ? Aggregate calls found while compiling, nil where aggregates are not allowed
+	aggregates *[]*aggregateCall
+	// ? Window calls found while compiling, nil where they are not allowed
+	windows *[]*windowCall
+	// ? WITH tables visible by name, they shadow tables of the backend
+	commonTables map[string]*commonTable
+	// ? Called with each column referenced, so a grouped select can check
+	// ? that it only uses its grouped columns outside of aggregates. nil when
+	// ? there is nothing to check.
+	reference func(index int)
+	// ? The same for columns referenced inside aggregates, where only the
+	// ? columns of enclosing selects are checked
+	outerReference func(index int)
+	// ? GROUP BY expressions, which can be used whole whatever columns they
+	// ? refer to
+	groupBy []*ast.Expression
+}
+
+// ? The same columns with aggregates and window functions disallowed
+func (s *scope) withoutAggregates() *scope {
+	return &scope{
+		columns:        s.columns,
+		tables:         s.tables,
+		types:          s.types,
+		commonTables:   s.commonTables,
+		reference:      s.outerReference,
+		outerReference: s.outerReference,
+	}
+}
+
+// ? The same columns with window functions disallowed
+func (s *scope) withoutWindows() *scope {
+	return &scope{
+		columns:        s.columns,
+		tables:         s.tables,
+		types:          s.types,
+		aggregates:     s.aggregates,
+		commonTables:   s.commonTables,
+		reference:      s.reference,
+		outerReference: s.outerReference,
+		groupBy:        s.groupBy,
+	}
+}
+
+// ? Index of a column, the innermost match wins
+func (s *scope) lookup(table *lex.Token, column string) (int, error) {
+	for i, col := range s.columns {
+		if col == column && (table == nil || s.tables[i] == table.Value) {
+			return i, nil
+		}
+	}
+	if table != nil {
+		return 0, fmt.Errorf("%w: %s.%s", ErrColumnDoesNotExist, table.Value, column)
+	}
+	return 0, fmt.Errorf("%w: %s", ErrColumnDoesNotExist, column)
+}
+
+type evaluator func(row []MemoryCell) (MemoryCell, error)
+
+// ? An expression resolved against a scope, ready to be evaluated per row
+type compiledExpression struct {
+	Name string
+	Type ColumnType
+	eval evaluator
+}
+
+func (mb *MemoryBackend) compileExpression(exp *ast.Expression, s *scope) (*compiledExpression, error) {
+	// ? A GROUP BY expression has the same value in every row of a group
+	for _, key := range s.groupBy {
+		if sameExpression(exp, key) {
+			s = s.withoutAggregates()
+			break
+		}
+	}
+
+	switch exp.Kind {
+	case ast.LiteralKind:
+		return mb.compileLiteral(exp, s)
+	case ast.CastKind:
+		return mb.compileCast(exp.Cast, s)
+	case ast.BinaryKind:
+		return mb.compileBinary(exp.Binary, s)
+	case ast.UnaryKind:
+		return mb.compileUnary(exp.Unary, s)
+	case ast.CallKind:
+		return mb.compileCall(exp.Call, s)
+	case ast.CaseKind:
+		return mb.compileCase(exp.Case, s)
+	case ast.InKind:
+		return mb.compileIn(exp.In, s)
+	case ast.BetweenKind:
+		return mb.compileBetween(exp.Between, s)
+	case ast.LikeKind:
+		return mb.compileLike(exp.Like, s)
+	case ast.SubqueryKind:
+		return mb.compileScalarSubquery(exp.Subquery, s)
+	case ast.ExistsKind:
+		return mb.compileExists(exp.Subquery, s)
+	}
+	return nil, ErrInvalidExpression
+}
+
+func (mb *MemoryBackend) compileLiteral(exp *ast.Expression, s *scope) (*compiledExpression, error) {
+	t := exp.Literal
+	if t.Kind == lex.IdentifierKind {
+		index, err := s.lookup(exp.Qualifier, t.Value)
+		if err != nil {
+			return nil, err
+		}
+		if s.reference != nil {
+			s.reference(index)
+		}
+		return &compiledExpression{
+			Name: t.Value,
+			Type: s.types[index],
+			eval: func(row []MemoryCell) (MemoryCell, error) {
+				return row[index], nil
+			},
+		}, nil
+	}
+
+	cell, columnType, err := mb.tokenToCell(t)
+	if err != nil {
+		return nil, err
+	}
+	return constantExpression(cell, columnType), nil
+}
+
+func (mb *MemoryBackend) compileCast(cast *ast.CastExpression, s *scope) (*compiledExpression, error) {
+	exp, err := mb.compileExpression(cast.Exp, s)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := columnTypeFromToken(cast.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	from := exp.Type
+	if from == to {
+		return exp, nil
+	}
+	if !canCast(from, to) {
+		return nil, fmt.Errorf("%w: cannot cast %s to %s", ErrInvalidDataType, from, to)
+	}
+
+	return &compiledExpression{
+		Name: exp.Name,
+		Type: to,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			cell, err := exp.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			return castCell(cell, from, to)
+		},
+	}, nil
+}
+
+func (mb *MemoryBackend) compileBinary(binary *ast.BinaryExpression, s *scope) (*compiledExpression, error) {
+	a, err := mb.compileExpression(binary.A, s)
+	if err != nil {
+		return nil, err
+	}
+	b, err := mb.compileExpression(binary.B, s)
+	if err != nil {
+		return nil, err
+	}
+
+	op := binary.Op.Value
+	switch op {
+	case string(lex.ConcatSymbol):
+		return concatExpression(a, b), nil
+	case string(lex.AndKeyword), string(lex.OrKeyword):
+		return compileLogical(op, a, b)
+	case string(lex.EqualSymbol), string(lex.NotEqualSymbol), string(lex.BangEqualSymbol),
+		string(lex.LessSymbol), string(lex.LessEqualSymbol), string(lex.GreaterSymbol), string(lex.GreaterEqualSymbol):
+		return compileComparison(op, a, b)
+	}
+	return compileArithmetic(op, a, b)
+}
+
+func (mb *MemoryBackend) compileUnary(unary *ast.UnaryExpression, s *scope) (*compiledExpression, error) {
+	exp, err := mb.compileExpression(unary.Exp, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch unary.Op.Value {
+	case string(lex.MinusSymbol):
+		return compileNegation(exp)
+	case string(lex.NotKeyword):
+		return compileNot(exp)
+	}
+	return nil, fmt.Errorf("%w: unknown operator %s", ErrInvalidExpression, unary.Op.Value)
+}
+
+func constantExpression(cell MemoryCell, t ColumnType) *compiledExpression {
+	return &compiledExpression{
+		Name: "?column?",
+		Type: t,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			return cell, nil
+		},
+	}
+}
+
+func isNumeric(t ColumnType) bool {
+	return t == IntType || t == BigIntType
+}
+
+// ? Conversions CAST accepts, the actual value may still be rejected
+func canCast(from, to ColumnType) bool {
+	switch {
+	case from == to, from == NullType:
+		return true
+	case isNumeric(from) && isNumeric(to):
+		return true
+	case isNumeric(from) && to == TextType:
+		return true
+	case from == TextType && isNumeric(to):
+		return true
+	case from == BoolType && to == TextType, from == TextType && to == BoolType:
+		return true
+	}
+	return false
+}
+
+// ? Implicit coercions applied when a value is stored into a column,
+// ? these are the same conversions an explicit CAST performs
+func canCoerce(from, to ColumnType) bool {
+	return canCast(from, to)
+}
+
+func castCell(cell MemoryCell, from, to ColumnType) (MemoryCell, error) {
+	switch {
+	case from == to, cell == nil:
+		return cell, nil
+	case isNumeric(from) && isNumeric(to):
+		return integerCell(cell.AsBigInt(), to)
+	case isNumeric(from) && to == TextType:
+		return textCell(strconv.FormatInt(cell.AsBigInt(), 10)), nil
+	case from == TextType && isNumeric(to):
+		value, err := strconv.ParseInt(strings.TrimSpace(cell.AsText()), 10, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("%w: '%s' does not fit in %s", ErrIntegerOutOfRange, cell.AsText(), to)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot convert text '%s' to %s", ErrInvalidDataType, cell.AsText(), to)
+		}
+		return integerCell(value, to)
+	case from == BoolType && to == TextType:
+		return textCell(cellToString(cell, from)), nil
+	case from == TextType && to == BoolType:
+		value, err := strconv.ParseBool(strings.TrimSpace(cell.AsText()))
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot convert text '%s' to %s", ErrInvalidDataType, cell.AsText(), to)
+		}
+		return boolCell(value), nil
+	}
+	return nil, fmt.Errorf("%w: cannot cast %s to %s", ErrInvalidDataType, from, to)
+}
+
+// ? The common type a set of values can be converted to, NULL fits anything
+// ? and int widens to bigint
+func unifyTypes(types []ColumnType) (ColumnType, bool) {
+	result := NullType
+	for _, t := range types {
+		switch {
+		case t == NullType || t == result:
+		case result == NullType:
+			result = t
+		case isNumeric(t) && isNumeric(result):
+			result = BigIntType
+		default:
+			return 0, false
+		}
+	}
+	return result, true
+}
+
+// ? Order two non-NULL cells of unifiable types, -1, 0 or 1
+func compareCells(a MemoryCell, aType ColumnType, b MemoryCell, bType ColumnType) int {
+	if isNumeric(aType) && isNumeric(bType) {
+		x, y := a.AsBigInt(), b.AsBigInt()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(cellToString(a, aType), cellToString(b, bType))
+}
@@ -0,0 +1,552 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? What a function argument is allowed to be, NULL is accepted everywhere
+type argKind uint
+
+const (
+	anyArg argKind = iota
+	textArg
+	numericArg
+	boolArg
+)
+
+type scalarFunction struct {
+	minArgs int
+	// ? -1 for variadic functions, the last argument kind then repeats
+	maxArgs int
+	args    []argKind
+	// ? Computes the result type from the argument types
+	returns func(types []ColumnType) (ColumnType, error)
+	// ? Strict functions return NULL as soon as one argument is NULL
+	strict bool
+	eval   func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error)
+}
+
+var scalarFunctions = map[string]*scalarFunction{
+	"length": {
+		minArgs: 1, maxArgs: 1, args: []argKind{textArg},
+		returns: returnsType(IntType), strict: true,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			return intCell(int32(utf8.RuneCount(args[0]))), nil
+		},
+	},
+	"lower": {
+		minArgs: 1, maxArgs: 1, args: []argKind{textArg},
+		returns: returnsType(TextType), strict: true,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			return textCell(strings.ToLower(args[0].AsText())), nil
+		},
+	},
+	"upper": {
+		minArgs: 1, maxArgs: 1, args: []argKind{textArg},
+		returns: returnsType(TextType), strict: true,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			return textCell(strings.ToUpper(args[0].AsText())), nil
+		},
+	},
+	"substr": {
+		minArgs: 2, maxArgs: 3, args: []argKind{textArg, numericArg, numericArg},
+		returns: returnsType(TextType), strict: true,
+		eval: evalSubstr,
+	},
+	"trim": {
+		minArgs: 1, maxArgs: 2, args: []argKind{textArg, textArg},
+		returns: returnsType(TextType), strict: true,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			if len(args) == 2 {
+				return textCell(strings.Trim(args[0].AsText(), args[1].AsText())), nil
+			}
+			return textCell(strings.TrimSpace(args[0].AsText())), nil
+		},
+	},
+	"replace": {
+		minArgs: 3, maxArgs: 3, args: []argKind{textArg, textArg, textArg},
+		returns: returnsType(TextType), strict: true,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			// ? As in PostgreSQL, an empty string is never replaced
+			if args[1].AsText() == "" {
+				return args[0], nil
+			}
+			return textCell(strings.ReplaceAll(args[0].AsText(), args[1].AsText(), args[2].AsText())), nil
+		},
+	},
+	"concat": {
+		minArgs: 1, maxArgs: -1, args: []argKind{anyArg},
+		returns: returnsType(TextType),
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			var b strings.Builder
+			for i, arg := range args {
+				if arg != nil {
+					b.WriteString(cellToString(arg, types[i]))
+				}
+			}
+			return textCell(b.String()), nil
+		},
+	},
+	"abs": {
+		minArgs: 1, maxArgs: 1, args: []argKind{numericArg},
+		returns: returnsArgumentType, strict: true,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			value := args[0].AsBigInt()
+			if value == math.MinInt64 {
+				return nil, fmt.Errorf("%w: abs(%d)", ErrIntegerOutOfRange, value)
+			}
+			if value < 0 {
+				value = -value
+			}
+			return integerCell(value, result)
+		},
+	},
+	"round": {
+		minArgs: 1, maxArgs: 2, args: []argKind{numericArg, numericArg},
+		returns: returnsArgumentType, strict: true,
+		eval: evalRound,
+	},
+	// ? Every numeric type is an integer so floor and ceil are the identity
+	"floor": {
+		minArgs: 1, maxArgs: 1, args: []argKind{numericArg},
+		returns: returnsArgumentType, strict: true,
+		eval: evalIdentity,
+	},
+	"ceil": {
+		minArgs: 1, maxArgs: 1, args: []argKind{numericArg},
+		returns: returnsArgumentType, strict: true,
+		eval: evalIdentity,
+	},
+	"mod": {
+		minArgs: 2, maxArgs: 2, args: []argKind{numericArg, numericArg},
+		returns: returnsUnifiedType, strict: true,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			value, err := applyArithmetic("%", args[0].AsBigInt(), args[1].AsBigInt())
+			if err != nil {
+				return nil, err
+			}
+			return integerCell(value, result)
+		},
+	},
+	"coalesce": {
+		minArgs: 1, maxArgs: -1, args: []argKind{anyArg},
+		returns: returnsUnifiedType,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			for i, arg := range args {
+				if arg != nil {
+					return castCell(arg, types[i], result)
+				}
+			}
+			return nil, nil
+		},
+	},
+	"ifnull": {
+		minArgs: 2, maxArgs: 2, args: []argKind{anyArg, anyArg},
+		returns: returnsUnifiedType,
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			if args[0] != nil {
+				return castCell(args[0], types[0], result)
+			}
+			return castCell(args[1], types[1], result)
+		},
+	},
+	"nullif": {
+		minArgs: 2, maxArgs: 2, args: []argKind{anyArg, anyArg},
+		returns: func(types []ColumnType) (ColumnType, error) {
+			if _, err := returnsUnifiedType(types); err != nil {
+				return 0, err
+			}
+			return types[0], nil
+		},
+		eval: func(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			if args[0] != nil && args[1] != nil && compareCells(args[0], types[0], args[1], types[1]) == 0 {
+				return nil, nil
+			}
+			return args[0], nil
+		},
+	},
+}
+
+func init() {
+	scalarFunctions["ceiling"] = scalarFunctions["ceil"]
+}
+
+func returnsType(t ColumnType) func([]ColumnType) (ColumnType, error) {
+	return func([]ColumnType) (ColumnType, error) {
+		return t, nil
+	}
+}
+
+func returnsArgumentType(types []ColumnType) (ColumnType, error) {
+	if types[0] == NullType {
+		return IntType, nil
+	}
+	return types[0], nil
+}
+
+func returnsUnifiedType(types []ColumnType) (ColumnType, error) {
+	t, ok := unifyTypes(types)
+	if !ok {
+		return 0, fmt.Errorf("%w: arguments of types %v cannot be matched", ErrInvalidDataType, types)
+	}
+	return t, nil
+}
+
+func evalIdentity(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+	return castCell(args[0], types[0], result)
+}
+
+// ? substr(text, start [, count]) with 1-based character positions
+func evalSubstr(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+	runes := []rune(args[0].AsText())
+	start := args[1].AsBigInt()
+	end := int64(math.MaxInt64)
+	if len(args) == 3 {
+		count := args[2].AsBigInt()
+		if count < 0 {
+			return nil, fmt.Errorf("%w: substr length must not be negative", ErrInvalidArguments)
+		}
+		if start <= math.MaxInt64-count {
+			end = start + count
+		}
+	}
+
+	if start < 1 {
+		start = 1
+	}
+	if end > int64(len(runes))+1 {
+		end = int64(len(runes)) + 1
+	}
+	if start >= end {
+		return textCell(""), nil
+	}
+	return textCell(string(runes[start-1 : end-1])), nil
+}
+
+// ? round(x [, digits]), negative digits round to tens, hundreds...
+func evalRound(args []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+	value := args[0].AsBigInt()
+	if len(args) == 1 || args[1].AsBigInt() >= 0 {
+		return integerCell(value, result)
+	}
+
+	digits := -args[1].AsBigInt()
+	if digits > 18 {
+		return integerCell(0, result)
+	}
+	power := int64(math.Pow10(int(digits)))
+	quotient, remainder := value/power, value%power
+	if remainder >= (power+1)/2 {
+		quotient++
+	} else if -remainder >= (power+1)/2 {
+		quotient--
+	}
+	rounded, err := applyArithmetic("*", quotient, power)
+	if err != nil {
+		return nil, err
+	}
+	return integerCell(rounded, result)
+}
+
+func checkArguments(name string, minArgs, maxArgs int, args []argKind, types []ColumnType) error {
+	if len(types) < minArgs || (maxArgs >= 0 && len(types) > maxArgs) {
+		expected := fmt.Sprintf("%d", minArgs)
+		if maxArgs < 0 {
+			expected = fmt.Sprintf("at least %d", minArgs)
+		} else if maxArgs != minArgs {
+			expected = fmt.Sprintf("%d to %d", minArgs, maxArgs)
+		}
+		return fmt.Errorf("%w: %s expects %s arguments, got %d", ErrInvalidArguments, name, expected, len(types))
+	}
+
+	for i, t := range types {
+		kind := args[len(args)-1]
+		if i < len(args) {
+			kind = args[i]
+		}
+		if t == NullType {
+			continue
+		}
+		if kind == textArg && t != TextType {
+			return fmt.Errorf("%w: %s expects text for argument %d, got %s", ErrInvalidDataType, name, i+1, t)
+		}
+		if kind == numericArg && !isNumeric(t) {
+			return fmt.Errorf("%w: %s expects a number for argument %d, got %s", ErrInvalidDataType, name, i+1, t)
+		}
+		if kind == boolArg && t != BoolType {
+			return fmt.Errorf("%w: %s expects a bool for argument %d, got %s", ErrInvalidDataType, name, i+1, t)
+		}
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) compileCall(call *ast.CallExpression, s *scope) (*compiledExpression, error) {
+	name := strings.ToLower(call.Name.Value)
+	if call.Over != nil {
+		return mb.compileWindow(name, call, s)
+	}
+	if _, ok := windowFunctions[name]; ok {
+		return nil, fmt.Errorf("%w: window function %s needs OVER", ErrInvalidExpression, name)
+	}
+	if agg, ok := mb.lookupAggregate(name); ok {
+		return mb.compileAggregate(name, agg, call, s)
+	}
+
+	fn, ok := mb.lookupFunction(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFunctionDoesNotExist, call.Name.Value)
+	}
+	if call.Distinct {
+		return nil, fmt.Errorf("%w: DISTINCT is only allowed in aggregates, not in %s", ErrInvalidArguments, name)
+	}
+
+	args, types, err := mb.compileArguments(call, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkArguments(name, fn.minArgs, fn.maxArgs, fn.args, types); err != nil {
+		return nil, err
+	}
+	resultType, err := fn.returns(types)
+	if err != nil {
+		return nil, fmt.Errorf("%w, in %s", err, name)
+	}
+
+	return &compiledExpression{
+		Name: name,
+		Type: resultType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			cells := make([]MemoryCell, len(args))
+			for i, arg := range args {
+				cell, err := arg.eval(row)
+				if err != nil {
+					return nil, err
+				}
+				if cell == nil && fn.strict {
+					return nil, nil
+				}
+				cells[i] = cell
+			}
+			return fn.eval(cells, types, resultType)
+		},
+	}, nil
+}
+
+func (mb *MemoryBackend) compileArguments(call *ast.CallExpression, s *scope) ([]*compiledExpression, []ColumnType, error) {
+	var args []*compiledExpression
+	var types []ColumnType
+	for _, arg := range *call.Args {
+		exp, err := mb.compileExpression(arg, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, exp)
+		types = append(types, exp.Type)
+	}
+	return args, types, nil
+}
+
+// ? Registered functions can never collide with built-ins, see checkRegistration
+func (mb *MemoryBackend) lookupFunction(name string) (*scalarFunction, bool) {
+	if fn, ok := mb.functions[name]; ok {
+		return fn, true
+	}
+	fn, ok := scalarFunctions[name]
+	return fn, ok
+}
+
+func (mb *MemoryBackend) lookupAggregate(name string) (*aggregateFunction, bool) {
+	if agg, ok := mb.aggregates[name]; ok {
+		return agg, true
+	}
+	agg, ok := aggregateFunctions[name]
+	return agg, ok
+}
+
+// ? Values exchanged with Go functions: int32 for int, int64 for bigint,
+// ? string for text, bool for bool and nil for NULL
+type Value interface{}
+
+type ScalarFunc func(args []Value) (Value, error)
+
+// ? A Go aggregate, Init creates the state of a group, Step folds one row
+// ? into it and Final turns it into the result. Used over a window Final can
+// ? be called again after more steps, so it must leave the state usable.
+type AggregateFunc struct {
+	Init  func() interface{}
+	Step  func(state interface{}, args []Value) (interface{}, error)
+	Final func(state interface{}) (Value, error)
+}
+
+// ? Make a Go function callable from SQL, arguments are converted to
+// ? argTypes before the call and NULLs are passed as nil
+func (mb *MemoryBackend) RegisterFunction(name string, argTypes []ColumnType, returnType ColumnType, fn ScalarFunc) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	name, args, err := mb.checkRegistration(name, argTypes, returnType)
+	if err != nil {
+		return err
+	}
+
+	// ? The map is replaced rather than changed, transactions keep the one
+	// ? they began with
+	functions := make(map[string]*scalarFunction)
+	for registered, f := range mb.functions {
+		functions[registered] = f
+	}
+	mb.functions = functions
+	functions[name] = &scalarFunction{
+		minArgs: len(argTypes),
+		maxArgs: len(argTypes),
+		args:    args,
+		returns: returnsType(returnType),
+		eval: func(cells []MemoryCell, types []ColumnType, result ColumnType) (MemoryCell, error) {
+			values, err := cellsToValues(cells, types, argTypes)
+			if err != nil {
+				return nil, err
+			}
+			value, err := fn(values)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return valueToCell(value, result)
+		},
+	}
+	return nil
+}
+
+// ? Make a Go aggregate callable from SQL, every row of a group is passed to
+// ? Step including rows where arguments are NULL
+func (mb *MemoryBackend) RegisterAggregate(name string, argTypes []ColumnType, returnType ColumnType, agg AggregateFunc) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	name, args, err := mb.checkRegistration(name, argTypes, returnType)
+	if err != nil {
+		return err
+	}
+	if agg.Init == nil || agg.Step == nil || agg.Final == nil {
+		return fmt.Errorf("%w: %s needs Init, Step and Final", ErrInvalidArguments, name)
+	}
+
+	aggregates := make(map[string]*aggregateFunction)
+	for registered, a := range mb.aggregates {
+		aggregates[registered] = a
+	}
+	mb.aggregates = aggregates
+	aggregates[name] = &aggregateFunction{
+		minArgs: len(argTypes),
+		maxArgs: len(argTypes),
+		args:    args,
+		returns: returnsType(returnType),
+		newState: func(types []ColumnType, result ColumnType) aggregateState {
+			return &goAggregateState{
+				name:     name,
+				agg:      agg,
+				state:    agg.Init(),
+				types:    types,
+				argTypes: argTypes,
+				result:   result,
+			}
+		},
+	}
+	return nil
+}
+
+func (mb *MemoryBackend) checkRegistration(name string, argTypes []ColumnType, returnType ColumnType) (string, []argKind, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("%w: function name must not be empty", ErrInvalidArguments)
+	}
+	if _, ok := mb.lookupFunction(name); ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrFunctionAlreadyExists, name)
+	}
+	if _, ok := mb.lookupAggregate(name); ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrFunctionAlreadyExists, name)
+	}
+	// ? Calls of these names are window functions, or fail without OVER
+	if _, ok := windowFunctions[name]; ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrFunctionAlreadyExists, name)
+	}
+
+	if returnType != TextType && returnType != BoolType && !isNumeric(returnType) {
+		return "", nil, fmt.Errorf("%w: %s cannot be returned from a function", ErrInvalidDataType, returnType)
+	}
+
+	var args []argKind
+	for _, t := range argTypes {
+		switch {
+		case t == TextType:
+			args = append(args, textArg)
+		case isNumeric(t):
+			args = append(args, numericArg)
+		case t == BoolType:
+			args = append(args, boolArg)
+		default:
+			return "", nil, fmt.Errorf("%w: %s cannot be used as an argument type", ErrInvalidDataType, t)
+		}
+	}
+	return name, args, nil
+}
+
+func cellsToValues(cells []MemoryCell, types []ColumnType, argTypes []ColumnType) ([]Value, error) {
+	values := make([]Value, len(cells))
+	for i, cell := range cells {
+		cell, err := castCell(cell, types[i], argTypes[i])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = cellToValue(cell, argTypes[i])
+	}
+	return values, nil
+}
+
+func cellToValue(cell MemoryCell, t ColumnType) Value {
+	if cell == nil {
+		return nil
+	}
+	switch t {
+	case IntType:
+		return cell.AsInt()
+	case BigIntType:
+		return cell.AsBigInt()
+	case BoolType:
+		return cell.AsBool()
+	}
+	return cell.AsText()
+}
+
+func valueToCell(value Value, t ColumnType) (MemoryCell, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case int32:
+		if isNumeric(t) {
+			return integerCell(int64(v), t)
+		}
+	case int64:
+		if isNumeric(t) {
+			return integerCell(v, t)
+		}
+	case int:
+		if isNumeric(t) {
+			return integerCell(int64(v), t)
+		}
+	case string:
+		if t == TextType {
+			return textCell(v), nil
+		}
+	case bool:
+		if t == BoolType {
+			return boolCell(v), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: function returned %T, expected %s", ErrInvalidDataType, value, t)
+}
@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegisterFunctionChecks(t *testing.T) {
+	mb := NewMemoryBackend()
+	fn := func(args []Value) (Value, error) { return nil, nil }
+	for _, test := range []struct {
+		name string
+		args []ColumnType
+		want error
+	}{
+		{"", nil, ErrInvalidArguments},
+		{"upper", []ColumnType{TextType}, ErrFunctionAlreadyExists},
+		{"SUM", []ColumnType{IntType}, ErrFunctionAlreadyExists},
+		{"rank", nil, ErrFunctionAlreadyExists},
+		{"Row_Number", nil, ErrFunctionAlreadyExists},
+		{"is_null", []ColumnType{NullType}, ErrInvalidDataType},
+	} {
+		if err := mb.RegisterFunction(test.name, test.args, IntType, fn); !errors.Is(err, test.want) {
+			t.Errorf("registering %q: got %v, want %v", test.name, err, test.want)
+		}
+		agg := AggregateFunc{
+			Init:  func() interface{} { return nil },
+			Step:  func(state interface{}, args []Value) (interface{}, error) { return nil, nil },
+			Final: func(state interface{}) (Value, error) { return nil, nil },
+		}
+		if err := mb.RegisterAggregate(test.name, test.args, IntType, agg); !errors.Is(err, test.want) {
+			t.Errorf("registering aggregate %q: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// ? Bools are passed to and returned from Go functions as bool
+func TestBoolFunctions(t *testing.T) {
+	mb := NewMemoryBackend()
+	err := mb.RegisterFunction("xor", []ColumnType{BoolType, BoolType}, BoolType, func(args []Value) (Value, error) {
+		if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return args[0].(bool) != args[1].(bool), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, mb, "CREATE TABLE t (a BOOL, b BOOL); INSERT INTO t VALUES (true, false); INSERT INTO t VALUES (true, true); INSERT INTO t VALUES (NULL, true);")
+
+	n, err := count(mb, "SELECT count(*) FROM t WHERE xor(a, b);")
+	if err != nil || n != 1 {
+		t.Errorf("got %d rows, want 1: %v", n, err)
+	}
+	n, err = count(mb, "SELECT count(xor(a, b)) FROM t;")
+	if err != nil || n != 2 {
+		t.Errorf("got %d results that are not NULL, want 2: %v", n, err)
+	}
+	if _, err := execute(mb, "SELECT xor(1, b) FROM t;"); !errors.Is(err, ErrInvalidDataType) {
+		t.Errorf("got %v passing a number as a bool, want ErrInvalidDataType", err)
+	}
+}
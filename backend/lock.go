@@ -0,0 +1,240 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? Inserts take rowExclusiveLock, which they share with each other.
+// ? Statements that replace a table or view, or claim a name, take
+// ? exclusiveLock. Selects read a snapshot and take no locks.
+type lockMode uint
+
+const (
+	rowExclusiveLock lockMode = iota
+	exclusiveLock
+)
+
+func (m lockMode) conflicts(other lockMode) bool {
+	return m == exclusiveLock || other == exclusiveLock
+}
+
+// ? A transaction, or a statement run on its own
+type lockOwner struct {
+	// ? Names it holds a lock on
+	names []string
+}
+
+type lockRequest struct {
+	name string
+	mode lockMode
+}
+
+type nameLock struct {
+	holders map[*lockOwner]lockMode
+	// ? Closed and replaced whenever a holder lets go, to wake up waiters
+	released chan struct{}
+}
+
+// ? Locks on table and view names, held until their owner ends. The zero
+// ? value has no locks.
+type lockManager struct {
+	mu    sync.Mutex
+	names map[string]*nameLock
+	// ? What each waiting owner waits for, the edges of the wait-for graph
+	waiting map[*lockOwner]lockRequest
+	// ? Called with mu held when an owner starts waiting, for tests to know
+	// ? it does
+	onWait func(name string)
+}
+
+// ? Wait until owner holds name in mode. Fails with ErrDeadlock when owner
+// ? waits for itself through other owners, since then it would wait forever,
+// ? and with ErrLockTimeout once timeout has passed if it is not 0.
+func (lm *lockManager) acquire(owner *lockOwner, name string, mode lockMode, timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if lm.names == nil {
+		lm.names = make(map[string]*nameLock)
+		lm.waiting = make(map[*lockOwner]lockRequest)
+	}
+
+	for {
+		lock, ok := lm.names[name]
+		if !ok {
+			lock = &nameLock{
+				holders:  make(map[*lockOwner]lockMode),
+				released: make(chan struct{}),
+			}
+			lm.names[name] = lock
+		}
+
+		if !lock.blocks(owner, mode) {
+			delete(lm.waiting, owner)
+			held, ok := lock.holders[owner]
+			if !ok {
+				owner.names = append(owner.names, name)
+			}
+			if !ok || mode > held {
+				lock.holders[owner] = mode
+			}
+			return nil
+		}
+
+		lm.waiting[owner] = lockRequest{name: name, mode: mode}
+		if lm.waitsFor(owner, owner, make(map[*lockOwner]bool)) {
+			delete(lm.waiting, owner)
+			return fmt.Errorf("%w: waiting for a lock on %s", ErrDeadlock, name)
+		}
+
+		if lm.onWait != nil {
+			lm.onWait(name)
+		}
+		released := lock.released
+		lm.mu.Unlock()
+		select {
+		case <-released:
+			lm.mu.Lock()
+		case <-expired:
+			lm.mu.Lock()
+			delete(lm.waiting, owner)
+			return fmt.Errorf("%w: waiting for a lock on %s", ErrLockTimeout, name)
+		}
+	}
+}
+
+// ? Whether another holder of the lock keeps owner from taking it in mode
+func (l *nameLock) blocks(owner *lockOwner, mode lockMode) bool {
+	for holder, held := range l.holders {
+		if holder != owner && held.conflicts(mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// ? Whether owner waits for target, directly or through other waiting owners
+func (lm *lockManager) waitsFor(owner, target *lockOwner, visited map[*lockOwner]bool) bool {
+	request, ok := lm.waiting[owner]
+	if !ok || visited[owner] {
+		return false
+	}
+	visited[owner] = true
+	// ? Released since, owner is about to wake up
+	lock, ok := lm.names[request.name]
+	if !ok {
+		return false
+	}
+
+	for holder, held := range lock.holders {
+		if holder == owner || !held.conflicts(request.mode) {
+			continue
+		}
+		if holder == target || lm.waitsFor(holder, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func (lm *lockManager) release(owner *lockOwner) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, name := range owner.names {
+		lock := lm.names[name]
+		delete(lock.holders, owner)
+		close(lock.released)
+		lock.released = make(chan struct{})
+		if len(lock.holders) == 0 {
+			delete(lm.names, name)
+		}
+	}
+	owner.names = nil
+}
+
+// ? Change a setting, DEFAULT sets it back to its default. The only one is
+// ? lock_timeout, see SetLockTimeout, in milliseconds or as a string such as
+// ? '2s' or '500ms'.
+func (mb *MemoryBackend) Set(stmt *ast.SetStatement) error {
+	name, value := stmt.Name.Value, stmt.Value
+	switch name {
+	case "lock_timeout":
+		var timeout time.Duration
+		var err error
+		switch value.Kind {
+		case lex.KeywordKind:
+		case lex.NumberKind:
+			var ms int64
+			ms, err = strconv.ParseInt(value.Value, 10, 64)
+			if err == nil && ms > math.MaxInt64/int64(time.Millisecond) {
+				err = ErrIntegerOutOfRange
+			}
+			timeout = time.Duration(ms) * time.Millisecond
+		default:
+			timeout, err = time.ParseDuration(value.Value)
+		}
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("%w: lock_timeout expects milliseconds or a duration such as '2s', got %s", ErrInvalidDataType, value.Value)
+		}
+		mb.SetLockTimeout(timeout)
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSettingDoesNotExist, name)
+}
+
+// ? How long a statement waits for a lock before it fails with
+// ? ErrLockTimeout, like lock_timeout in PostgreSQL. 0, the default, waits
+// ? as long as it takes.
+func (mb *MemoryBackend) SetLockTimeout(timeout time.Duration) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.lockTimeout = timeout
+}
+
+func (mb *MemoryBackend) getLockTimeout() time.Duration {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	return mb.lockTimeout
+}
+
+// ? Run a statement on its own. The locks are taken before the backend is,
+// ? so the statement does not hold it up while it waits.
+func (mb *MemoryBackend) exec(mode lockMode, names []string, run func() error) error {
+	owner := &lockOwner{}
+	defer mb.locks.release(owner)
+	timeout := mb.getLockTimeout()
+	for _, name := range names {
+		if err := mb.locks.acquire(owner, name, mode, timeout); err != nil {
+			return err
+		}
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.change(run)
+}
+
+// ? Renaming a table claims the new name as well
+func alterTableLocks(stmt *ast.AlterTableStatement) []string {
+	names := []string{stmt.Table.Value}
+	if stmt.Kind == ast.RenameTableKind {
+		names = append(names, stmt.NewName.Value)
+	}
+	return names
+}
@@ -0,0 +1,161 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? A channel that gets the name of each lock a statement starts waiting for
+func watchWaits(mb *MemoryBackend) <-chan string {
+	waits := make(chan string, 16)
+	mb.locks.mu.Lock()
+	defer mb.locks.mu.Unlock()
+
+	mb.locks.onWait = func(name string) {
+		waits <- name
+	}
+	return waits
+}
+
+func set(t *testing.T, mb *MemoryBackend, sql string) error {
+	t.Helper()
+	tokens, err := lex.Lex(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := ast.Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mb.Set(program.Statements[0].SetStatement)
+}
+
+func begin(t *testing.T, mb *MemoryBackend) Transaction {
+	t.Helper()
+	tx, err := mb.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// ? Of two transactions waiting for each other, the one whose wait would
+// ? close the cycle fails and is rolled back, and the other goes on
+func TestDeadlockVictim(t *testing.T) {
+	mb := NewMemoryBackend()
+	waits := watchWaits(mb)
+	mustExecute(t, mb, "CREATE TABLE a (n INT); CREATE TABLE b (n INT);")
+
+	first, second := begin(t, mb), begin(t, mb)
+	mustExecute(t, first, "ALTER TABLE a ADD COLUMN first INT;")
+	mustExecute(t, second, "ALTER TABLE b ADD COLUMN second INT;")
+
+	altered := make(chan error)
+	go func() {
+		_, err := execute(first, "ALTER TABLE b ADD COLUMN first INT;")
+		altered <- err
+	}()
+	if name := <-waits; name != "b" {
+		t.Fatalf("first waits for %s, want b", name)
+	}
+
+	_, err := execute(second, "ALTER TABLE a ADD COLUMN second INT;")
+	if !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("got %v, want ErrDeadlock", err)
+	}
+	if err := second.Commit(); !errors.Is(err, ErrTransactionDone) {
+		t.Errorf("got %v committing the victim, want ErrTransactionDone", err)
+	}
+
+	if err := <-altered; err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"a", "b"} {
+		results, err := execute(mb, "SELECT * FROM "+table+";")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results.Columns) != 2 || results.Columns[1].Name != "first" {
+			t.Errorf("got columns %v of %s, want n and first", results.Columns, table)
+		}
+	}
+}
+
+// ? A statement waiting for a lock longer than lock_timeout fails, and
+// ? without one it waits until the lock is released
+func TestLockTimeout(t *testing.T) {
+	mb := NewMemoryBackend()
+	waits := watchWaits(mb)
+	mustExecute(t, mb, "CREATE TABLE t (n INT);")
+
+	tx := begin(t, mb)
+	mustExecute(t, tx, "ALTER TABLE t ADD COLUMN m INT;")
+
+	if err := set(t, mb, "SET lock_timeout = 10;"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := execute(mb, "ALTER TABLE t ADD COLUMN o INT;")
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("got %v, want ErrLockTimeout", err)
+	}
+	<-waits
+
+	// ? The transaction holding the lock is not affected
+	mustExecute(t, tx, "INSERT INTO t VALUES (1, 2);")
+
+	if err := set(t, mb, "SET lock_timeout TO DEFAULT;"); err != nil {
+		t.Fatal(err)
+	}
+	altered := make(chan error)
+	go func() {
+		_, err := execute(mb, "ALTER TABLE t ADD COLUMN o INT;")
+		altered <- err
+	}()
+	<-waits
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-altered; err != nil {
+		t.Fatal(err)
+	}
+	results, err := execute(mb, "SELECT * FROM t;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Columns) != 3 || len(results.Rows) != 1 {
+		t.Errorf("got %d columns and %d rows, want 3 and 1", len(results.Columns), len(results.Rows))
+	}
+}
+
+func TestSetLockTimeout(t *testing.T) {
+	mb := NewMemoryBackend()
+	for _, test := range []struct {
+		sql  string
+		want time.Duration
+		err  error
+	}{
+		{"SET lock_timeout = 250;", 250 * time.Millisecond, nil},
+		{"SET lock_timeout TO '2s';", 2 * time.Second, nil},
+		{"SET lock_timeout = DEFAULT;", 0, nil},
+		{"SET lock_timeout = '-1s';", 0, ErrInvalidDataType},
+		{"SET lock_timeout = 'soon';", 0, ErrInvalidDataType},
+		{"SET lock_timeout = 9223372036854775807;", 0, ErrInvalidDataType},
+		{"SET statement_timeout = 1;", 0, ErrSettingDoesNotExist},
+	} {
+		mb.SetLockTimeout(0)
+		err := set(t, mb, test.sql)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.sql, err, test.err)
+		}
+		if got := mb.getLockTimeout(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.sql, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// ? Keys of the tree under an LSMBackend start with their kind
+const (
+	// ? The table of a name, its id, rows and columns
+	tableKeyKind = 'c'
+	// ? A row under the id of its table and its own
+	rowKeyKind  = 'r'
+	viewKeyKind = 'v'
+	// ? The id the next table written gets
+	nextTableKey = "n"
+
+	rowKeyPrefixSize = 1 + 8
+	// ? Rows are written to the tree in batches of about this many bytes
+	lsmBatchSize = 1 << 20
+)
+
+// ? A Backend kept in a log-structured merge tree in a directory, for
+// ? workloads that mostly add rows: the rows are written sequentially, to
+// ? the log and later to sorted runs, instead of to pages all over a file.
+// ? Statements run on a MemoryBackend, the changes they make are written to
+// ? the tree before they return or anyone else sees them, and undone when
+// ? that fails. Rows written are read back from the tree.
+// ?
+// ? A table that changes in any other way than growing is written again
+// ? under a new id, the rows under its old id are dropped by compactions.
+type LSMBackend struct {
+	persistentBackend
+	mu   sync.Mutex
+	tree *lsmTree
+	// ? The tables and views as they are in the tree
+	logged  *catalog
+	nextID  uint64
+	liveMu  sync.Mutex
+	liveIDs map[uint64]bool
+}
+
+// ? Rows of a table in an lsmTree, under the id of the table
+type lsmRows struct {
+	tree  *lsmTree
+	id    uint64
+	count int
+	width int
+}
+
+// ? Open the database in the directory dir, creating it when it does not
+// ? exist
+func OpenLSMBackend(dir string) (*LSMBackend, error) {
+	tree, err := openLSMTree(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &LSMBackend{tree: tree, liveIDs: make(map[uint64]bool)}
+	db.persistentBackend = newPersistentBackend(db.persist)
+	if err = db.load(); err != nil {
+		tree.close()
+		return nil, err
+	}
+	db.logged = takeCatalog(db.Tables, db.Views)
+	tree.startCompaction(db.keep)
+	return db, nil
+}
+
+func (db *LSMBackend) load() error {
+	err := db.tree.scan([]byte{tableKeyKind}, []byte{tableKeyKind + 1}, func(key, value []byte) error {
+		d := &decoder{r: bytes.NewReader(value)}
+		rows := &lsmRows{tree: db.tree, id: d.uvarint(), count: int(d.uvarint())}
+		table := decodeColumns(d)
+		if err := d.finish(); err != nil {
+			return fmt.Errorf("%w, in table %s", err, key[1:])
+		}
+		rows.width = len(table.Columns)
+		table.stored = rows
+		table.rows = rowTree{next: uint64(rows.count)}
+		table.written.Store(rows)
+		db.Tables[string(key[1:])] = table
+		db.liveIDs[rows.id] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = db.tree.scan([]byte{viewKeyKind}, []byte{viewKeyKind + 1}, func(key, value []byte) error {
+		view, err := decodeView(value)
+		if err != nil {
+			return err
+		}
+		db.Views[string(key[1:])] = view
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.tree.scan([]byte(nextTableKey), []byte(nextTableKey+"\x00"), func(key, value []byte) error {
+		d := &decoder{r: bytes.NewReader(value)}
+		db.nextID = d.uvarint()
+		return d.finish()
+	})
+}
+
+// ? Compactions keep the rows of tables in use, and of those some
+// ? statement may still read
+func (db *LSMBackend) keep(key []byte) bool {
+	if len(key) < rowKeyPrefixSize || key[0] != rowKeyKind {
+		return true
+	}
+	db.liveMu.Lock()
+	defer db.liveMu.Unlock()
+
+	return db.liveIDs[binary.BigEndian.Uint64(key[1:])]
+}
+
+// ? Write the tables and views that changed since they were last written.
+// ? A table that only grew gets its new rows. Called with the MemoryBackend
+// ? locked.
+// ?
+// ? Rows are written in batches of about lsmBatchSize bytes as they are
+// ? read, the tables get their new ids and counts with the last batch. Rows
+// ? written before are not read until then: they are past the count of
+// ? their table, and written over by the rows it gets next, or under an id
+// ? no table has, and dropped by compactions. Ids are written before any
+// ? rows under them, so none is used twice.
+func (db *LSMBackend) persist() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	current := takeCatalog(db.Tables, db.Views)
+
+	// ? The tables that changed, and for those that only grew their new rows
+	written := make(map[*Table]*lsmRows)
+	appended := make(map[*Table][][]MemoryCell)
+	names := make(map[*Table]string)
+	var created, dropped []uint64
+	nextID := db.nextID
+	for name, table := range current.tables {
+		logged, ok := db.logged.tables[name]
+		if ok && logged == table {
+			continue
+		}
+		rows := &lsmRows{tree: db.tree, width: len(table.Columns)}
+		if added, grew := appendedRows(logged, table); ok && grew {
+			loggedRows := logged.written.Load().(*lsmRows)
+			rows.id, rows.count = loggedRows.id, loggedRows.count
+			appended[table] = added
+		} else {
+			rows.id = nextID
+			nextID++
+			created = append(created, rows.id)
+			if ok {
+				dropped = append(dropped, logged.written.Load().(*lsmRows).id)
+			}
+		}
+		written[table] = rows
+		names[table] = name
+	}
+	for name, logged := range db.logged.tables {
+		if _, ok := current.tables[name]; !ok {
+			dropped = append(dropped, logged.written.Load().(*lsmRows).id)
+		}
+	}
+
+	var entries []*lsmEntry
+	if nextID != db.nextID {
+		var buf bytes.Buffer
+		putUvarint(&buf, nextID)
+		entries = append(entries, &lsmEntry{key: []byte(nextTableKey), value: buf.Bytes()})
+		db.nextID = nextID
+	}
+	// ? Before their rows are written, so no compaction drops them
+	db.liveMu.Lock()
+	for _, id := range created {
+		db.liveIDs[id] = true
+	}
+	db.liveMu.Unlock()
+	fail := func(err error) error {
+		db.liveMu.Lock()
+		defer db.liveMu.Unlock()
+
+		for _, id := range created {
+			delete(db.liveIDs, id)
+		}
+		return err
+	}
+
+	// ? What goes in the last batch
+	var last []*lsmEntry
+	size := 0
+	for table, rows := range written {
+		put := func(row []MemoryCell) error {
+			var buf bytes.Buffer
+			putRow(&buf, row)
+			entries = append(entries, &lsmEntry{key: lsmRowKey(rows.id, rows.count), value: buf.Bytes()})
+			rows.count++
+			if size += rowKeyPrefixSize + 8 + buf.Len(); size < lsmBatchSize {
+				return nil
+			}
+			err := db.tree.write(entries)
+			entries, size = nil, 0
+			return err
+		}
+		var err error
+		if added, grew := appended[table]; grew {
+			err = eachRow(added, put)
+		} else {
+			err = table.each(put)
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		var buf bytes.Buffer
+		putUvarint(&buf, rows.id)
+		putUvarint(&buf, uint64(rows.count))
+		putColumns(&buf, table)
+		last = append(last, &lsmEntry{key: nameKey(tableKeyKind, names[table]), value: buf.Bytes()})
+	}
+	for name := range db.logged.tables {
+		if _, ok := current.tables[name]; !ok {
+			last = append(last, &lsmEntry{key: nameKey(tableKeyKind, name), deleted: true})
+		}
+	}
+	for name, view := range current.views {
+		if db.logged.views[name] != view {
+			data, err := encodeView(view)
+			if err != nil {
+				return fail(err)
+			}
+			last = append(last, &lsmEntry{key: nameKey(viewKeyKind, name), value: data})
+		}
+	}
+	for name := range db.logged.views {
+		if _, ok := current.views[name]; !ok {
+			last = append(last, &lsmEntry{key: nameKey(viewKeyKind, name), deleted: true})
+		}
+	}
+	if len(last) == 0 {
+		return nil
+	}
+	if err := db.tree.write(append(entries, last...)); err != nil {
+		return fail(err)
+	}
+
+	for table, rows := range written {
+		table.written.Store(rows)
+	}
+	db.logged = current
+	if len(dropped) > 0 {
+		db.epochs.retire(func() {
+			db.liveMu.Lock()
+			defer db.liveMu.Unlock()
+
+			for _, id := range dropped {
+				delete(db.liveIDs, id)
+			}
+		})
+	}
+	return nil
+}
+
+// ? Stop compacting and close the files. The memtable is not flushed, the
+// ? log has what it holds.
+func (db *LSMBackend) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.tree.close()
+}
+
+func (lr *lsmRows) len() int {
+	return lr.count
+}
+
+// ? Rows are keyed by their number, so the scan seeks straight to from
+func (lr *lsmRows) each(from, to int, fn func(row []MemoryCell) error) error {
+	n := 0
+	err := lr.tree.scan(lsmRowKey(lr.id, from), lsmRowKey(lr.id, to), func(key, value []byte) error {
+		d := &decoder{r: bytes.NewReader(value)}
+		row := decodeRow(d, lr.width)
+		if err := d.finish(); err != nil {
+			return err
+		}
+		n++
+		return fn(row)
+	})
+	if err != nil {
+		return err
+	}
+	if n != to-from {
+		return fmt.Errorf("%w: table %d has %d rows from %d up to %d", ErrCorruptDatabase, lr.id, n, from, to)
+	}
+	return nil
+}
+
+// ? Row keys sort by table and then by row
+func lsmRowKey(table uint64, row int) []byte {
+	key := make([]byte, rowKeyPrefixSize+8)
+	key[0] = rowKeyKind
+	binary.BigEndian.PutUint64(key[1:], table)
+	binary.BigEndian.PutUint64(key[rowKeyPrefixSize:], uint64(row))
+	return key
+}
+
+func nameKey(kind byte, name string) []byte {
+	return append([]byte{kind}, name...)
+}
+
+// ? What the bloom filters of runs hold for a key besides the key itself:
+// ? the kind and table of a row key, so scans of the rows of a table skip
+// ? runs without any, and the kind of other keys. Every range scanned is
+// ? either one key or keys sharing this, so nothing else is looked for.
+func filterKey(key []byte) []byte {
+	if len(key) >= rowKeyPrefixSize && key[0] == rowKeyKind {
+		return key[:rowKeyPrefixSize]
+	}
+	if len(key) == 0 {
+		return nil
+	}
+	return key[:1]
+}
+
+// ? What a scan from start up to end looks for in bloom filters: the key
+// ? when it is the only one in the range, like a row read by its id, and
+// ? otherwise the filter key of start, which every key in the range has
+func scanFilterKey(start, end []byte) []byte {
+	if isRowKey(start) && isRowKey(end) && bytes.Equal(start[:rowKeyPrefixSize], end[:rowKeyPrefixSize]) &&
+		binary.BigEndian.Uint64(end[rowKeyPrefixSize:]) == binary.BigEndian.Uint64(start[rowKeyPrefixSize:])+1 {
+		return start
+	}
+	if len(end) == len(start)+1 && end[len(start)] == 0 && bytes.HasPrefix(end, start) {
+		return start
+	}
+	return filterKey(start)
+}
+
+func isRowKey(key []byte) bool {
+	return len(key) == rowKeyPrefixSize+8 && key[0] == rowKeyKind
+}
@@ -0,0 +1,350 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+func openLSM(t *testing.T, dir string) *LSMBackend {
+	t.Helper()
+	db, err := OpenLSMBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// ? Copy the files of a tree, as a crash would leave them
+func copyDir(t *testing.T, from, to string) {
+	t.Helper()
+	if err := os.MkdirAll(to, 0755); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(from, info.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(to, info.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func waitForFlush(t *testing.T, tree *lsmTree) {
+	t.Helper()
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	tree.waitForFlush()
+	if tree.flushErr != nil {
+		t.Fatal(tree.flushErr)
+	}
+}
+
+// ? Insert n rows in one change, which fills a small memtable
+func insertRows(t *testing.T, db *LSMBackend, format string, n int) {
+	t.Helper()
+	tx, err := db.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		mustExecute(t, tx, fmt.Sprintf(format, i))
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ? Cut the log of the memtable short at every offset, as a crash in the
+// ? middle of writing it would, and open the tree again. It has every
+// ? change whose records were all written and none of the others.
+func TestLSMRecoverFromTruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	db := openLSM(t, path)
+	logPath := db.tree.logPath(db.tree.generation)
+	logSize := func() int64 {
+		info, err := os.Stat(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	states := []string{dump(db)}
+	ends := []int64{logSize()}
+	record := func() {
+		states = append(states, dump(db))
+		ends = append(ends, logSize())
+	}
+
+	mustExecute(t, db, "CREATE TABLE a (x INT, s TEXT);")
+	record()
+	mustExecute(t, db, "CREATE TABLE b (y BIGINT);")
+	record()
+	for i := 1; i < 4; i++ {
+		mustExecute(t, db, fmt.Sprintf("INSERT INTO a VALUES (%d, 'row %d');", i, i))
+		record()
+	}
+	tx, err := db.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, tx, "INSERT INTO a VALUES (4, 'four'); INSERT INTO b VALUES (40); INSERT INTO b VALUES (41);")
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	record()
+	mustExecute(t, db, "ALTER TABLE a ADD COLUMN z INT DEFAULT 7;")
+	record()
+	mustExecute(t, db, "CREATE VIEW v AS SELECT count(*) AS n, sum(x) AS total FROM a;")
+	record()
+	mustExecute(t, db, "INSERT INTO a VALUES (5, 'five', 5);")
+	record()
+	mustExecute(t, db, "ALTER TABLE b RENAME COLUMN y TO w;")
+	record()
+
+	// ? A crash, the files are left as they are
+	crash := filepath.Join(dir, "crash")
+	copyDir(t, path, crash)
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	log := readFile(t, filepath.Join(crash, filepath.Base(logPath)))
+	if int64(len(log)) != ends[len(ends)-1] {
+		t.Fatalf("log has %d bytes, want %d", len(log), ends[len(ends)-1])
+	}
+
+	for offset := 0; offset <= len(log); offset++ {
+		crashed := filepath.Join(dir, fmt.Sprintf("crash%d", offset))
+		copyDir(t, crash, crashed)
+		if err = ioutil.WriteFile(filepath.Join(crashed, filepath.Base(logPath)), log[:offset], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		committed := 0
+		for committed+1 < len(ends) && ends[committed+1] <= int64(offset) {
+			committed++
+		}
+
+		recovered := openLSM(t, crashed)
+		if got := dump(recovered); got != states[committed] {
+			t.Fatalf("offset %d: got\n%s\nwant the state after %d changes\n%s", offset, got, committed, states[committed])
+		}
+		if err = recovered.Close(); err != nil {
+			t.Fatal(err)
+		}
+		os.RemoveAll(crashed)
+	}
+}
+
+// ? A flush writes the run, then the manifest listing it, then removes the
+// ? log of the memtable. A crash between any two of them loses nothing.
+func TestLSMFlushIsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	db := openLSM(t, path)
+	db.tree.flushSize = 4 << 10
+	mustExecute(t, db, "CREATE TABLE a (x INT, s TEXT); CREATE TABLE b (y BIGINT); INSERT INTO b VALUES (1);")
+
+	// ? The manifest before the flush, and the log of the memtable flushed,
+	// ? linked so it can still be read once the flush removes it
+	manifest := readFile(t, filepath.Join(path, manifestName))
+	logName := filepath.Base(db.tree.logPath(db.tree.generation))
+	if err := os.Link(filepath.Join(path, logName), filepath.Join(dir, logName)); err != nil {
+		t.Fatal(err)
+	}
+	insertRows(t, db, "INSERT INTO a VALUES (%d, 'a row long enough to fill the memtable soon');", 100)
+	waitForFlush(t, db.tree)
+	log := readFile(t, filepath.Join(dir, logName))
+	if len(db.tree.runs) != 1 {
+		t.Fatalf("got %d runs, want the one flushed", len(db.tree.runs))
+	}
+	runName := filepath.Base(db.tree.runPath(db.tree.runs[0].number))
+	if _, err := os.Stat(filepath.Join(path, logName)); !os.IsNotExist(err) {
+		t.Fatalf("log of the flushed memtable is still there")
+	}
+	mustExecute(t, db, "INSERT INTO b VALUES (2);")
+	want := dump(db)
+
+	crashes := map[string]func(crashed string){
+		// ? The run is written, the manifest does not list it yet
+		"before the manifest": func(crashed string) {
+			ioutil.WriteFile(filepath.Join(crashed, manifestName), manifest, 0644)
+			ioutil.WriteFile(filepath.Join(crashed, logName), log, 0644)
+		},
+		// ? The manifest lists the run, the log is still there
+		"before removing the log": func(crashed string) {
+			ioutil.WriteFile(filepath.Join(crashed, logName), log, 0644)
+		},
+	}
+	for name, crash := range crashes {
+		crashed := filepath.Join(dir, name)
+		copyDir(t, path, crashed)
+		crash(crashed)
+
+		recovered := openLSM(t, crashed)
+		if got := dump(recovered); got != want {
+			t.Errorf("crash %s: got\n%s\nwant\n%s", name, got, want)
+		}
+		listed := len(recovered.tree.runs) == 1
+		if _, err := os.Stat(filepath.Join(crashed, runName)); os.IsNotExist(err) == listed {
+			t.Errorf("crash %s: run listed %v, but its file exists %v", name, listed, !os.IsNotExist(err))
+		}
+		if _, err := os.Stat(filepath.Join(crashed, logName)); os.IsNotExist(err) != listed {
+			t.Errorf("crash %s: run listed %v, but the log of its memtable exists %v", name, listed, !os.IsNotExist(err))
+		}
+		if err := recovered.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = openLSM(t, path)
+	defer db.Close()
+	if got := dump(db); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// ? The rows under the id a table had before it was altered are gone from
+// ? the runs once compacted
+func TestLSMCompactionDropsDeadTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db := openLSM(t, path)
+	db.tree.flushSize = 4 << 10
+
+	mustExecute(t, db, "CREATE TABLE a (x INT, s TEXT);")
+	insertRows(t, db, "INSERT INTO a VALUES (%d, 'a row long enough to fill the memtable soon');", 100)
+	waitForFlush(t, db.tree)
+	dead := db.logged.tables["a"].written.Load().(*lsmRows).id
+	mustExecute(t, db, "ALTER TABLE a ADD COLUMN z INT DEFAULT 7;")
+	waitForFlush(t, db.tree)
+	if live := db.logged.tables["a"].written.Load().(*lsmRows).id; live == dead {
+		t.Fatalf("altered table kept its id %d", dead)
+	}
+
+	// ? The fourth run on level 0 starts a compaction of all of them
+	mustExecute(t, db, "CREATE TABLE b (y BIGINT, s TEXT);")
+	for i := 0; i < 2; i++ {
+		insertRows(t, db, "INSERT INTO b VALUES (%d, 'a row long enough to fill the memtable soon');", 100)
+		waitForFlush(t, db.tree)
+	}
+	want := dump(db)
+	// ? Waits for the compaction
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := openLSMTree(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compacted := false
+	for _, run := range tree.runs {
+		compacted = compacted || run.level > 0
+		it := run.seek(lsmRowKey(dead, 0), lsmRowKey(dead+1, 0))
+		for it.next() {
+			t.Errorf("run %d on level %d has row %x of dropped table %d", run.number, run.level, it.entry().key, dead)
+		}
+		if err = it.error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !compacted {
+		t.Errorf("no run was compacted")
+	}
+	if err = tree.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openLSM(t, path)
+	defer db.Close()
+	if got := dump(db); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// ? Runs whose bloom filter does not have the table scanned, or the row
+// ? read, are not read at all
+func TestLSMFilterSkipsRuns(t *testing.T) {
+	tree, err := openLSMTree(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.flushSize = 1
+	write := func(entries []*lsmEntry) {
+		if err := tree.write(entries); err != nil {
+			t.Fatal(err)
+		}
+		waitForFlush(t, tree)
+	}
+
+	// ? Tables 1 and 3 in one run, with the even rows of 1, table 2 in another
+	var entries []*lsmEntry
+	for row := 0; row < 100; row++ {
+		entries = append(entries,
+			&lsmEntry{key: lsmRowKey(1, 2*row), value: []byte("one")},
+			&lsmEntry{key: lsmRowKey(3, row), value: []byte("three")})
+	}
+	write(entries)
+	entries = nil
+	for row := 0; row < 100; row++ {
+		entries = append(entries, &lsmEntry{key: lsmRowKey(2, row), value: []byte("two")})
+	}
+	write(entries)
+	if len(tree.runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(tree.runs))
+	}
+
+	// ? Reading the first run now fails
+	tree.runs[1].file.Close()
+	count := func(start, end []byte) (int, error) {
+		n := 0
+		err := tree.scan(start, end, func(key, value []byte) error {
+			n++
+			return nil
+		})
+		return n, err
+	}
+	if _, err = count(lsmRowKey(1, 0), lsmRowKey(2, 0)); err == nil {
+		t.Fatal("read the rows of table 1 from a closed run")
+	}
+	scans := []struct {
+		start, end []byte
+		want       int
+	}{
+		{lsmRowKey(2, 0), lsmRowKey(3, 0), 100},
+		{lsmRowKey(2, 7), lsmRowKey(2, 8), 1},
+		{lsmRowKey(1, 51), lsmRowKey(1, 52), 0},
+		{lsmRowKey(1, 151), lsmRowKey(1, 152), 0},
+	}
+	for _, scan := range scans {
+		if n, err := count(scan.start, scan.end); err != nil || n != scan.want {
+			t.Errorf("scan from %x up to %x: got %d rows and %v, want %d rows and the first run skipped", scan.start, scan.end, n, err, scan.want)
+		}
+	}
+	tree.close()
+}
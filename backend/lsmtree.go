@@ -0,0 +1,722 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ? The memtable is written to a run once it holds this many bytes
+	memtableSize = 4 << 20
+	// ? This many runs of a level are merged into one of the next level
+	compactionRuns = 4
+
+	manifestMagic = "gosqlman"
+	manifestName  = "MANIFEST"
+	logSuffix     = ".log"
+	runSuffix     = ".run"
+)
+
+// ? A log-structured merge tree of keys and values in a directory. Writes
+// ? go to the write-ahead log and the memtable, which keeps them sorted in
+// ? memory. Once large enough the memtable is flushed to a sorted run, a
+// ? file that is never changed afterwards. Scans merge the memtable with
+// ? the runs, newer entries hiding older ones with the same key.
+// ?
+// ? Each memtable has a log of its own. A full one is flushed by a goroutine
+// ? while writes go on to the next memtable and log, a write only waits
+// ? when that fills up too before the flush is done. The log of a memtable
+// ? is removed once the manifest lists its run.
+// ?
+// ? Runs written by flushes are on level 0. A goroutine merges every
+// ? compactionRuns runs of a level into one of the next level in the
+// ? background, so each key is written about once per level. Runs are
+// ? kept from newest to oldest, which is also from the lowest level to the
+// ? highest, and the manifest lists them.
+// ?
+// ? Writes are made one at a time, scans can run alongside them and each
+// ? other.
+type lsmTree struct {
+	dir string
+	// ? Guards the fields below, but not the files of the runs
+	mu       sync.Mutex
+	memtable *memtable
+	// ? The memtable being flushed, which scans still read, or the one whose
+	// ? flush failed, which is flushed again once the memtable is full
+	flushing *memtable
+	flushErr error
+	// ? Signalled when a flush is done
+	flushed *sync.Cond
+	// ? The memtable is flushed once it holds this many bytes
+	flushSize int
+	runs      []*sortedRun
+	// ? The log of the memtable, logs are numbered by generation. Those from
+	// ? oldest on hold entries not yet in a run, the manifest has oldest.
+	log        *writeAheadLog
+	generation uint32
+	oldest     uint32
+	nextRun    uint64
+	// ? Whether compactions keep an entry, dropped ones are no longer used
+	keep func(key []byte) bool
+	// ? Wakes up the compaction goroutine, closed to stop it
+	compact chan struct{}
+	done    chan struct{}
+	// ? Error of the last compaction, a failed one is tried again after the
+	// ? next flush
+	compactErr error
+}
+
+// ? Open the tree in dir, creating it when it does not exist. Changes
+// ? committed to the log since the last flush go back to the memtable.
+func openLSMTree(dir string) (*lsmTree, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	t := &lsmTree{
+		dir:       dir,
+		memtable:  newMemtable(),
+		flushSize: memtableSize,
+		nextRun:   1,
+		compact:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	t.flushed = sync.NewCond(&t.mu)
+
+	if err := t.readManifest(); err != nil {
+		t.closeRuns()
+		return nil, err
+	}
+	if err := t.removeUnused(); err != nil {
+		t.closeRuns()
+		return nil, err
+	}
+
+	// ? There is more than one log when a crash came before a flush was done
+	for generation := t.oldest; ; generation++ {
+		path := t.logPath(generation)
+		if generation > t.oldest {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				break
+			} else if err != nil {
+				t.close()
+				return nil, err
+			}
+		}
+		log, changes, err := openLog(path, generation)
+		if err != nil {
+			t.close()
+			return nil, err
+		}
+		if t.log != nil {
+			t.log.close()
+		}
+		t.log, t.generation = log, generation
+		if err = t.replay(changes); err != nil {
+			t.close()
+			return nil, err
+		}
+	}
+	if err := syncDir(dir); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *lsmTree) replay(changes [][]*logRecord) error {
+	for _, records := range changes {
+		for _, record := range records {
+			switch record.kind {
+			case putLogRecord:
+				t.memtable.put(&lsmEntry{key: []byte(record.name), value: record.data})
+			case deleteLogRecord:
+				t.memtable.put(&lsmEntry{key: []byte(record.name), deleted: true})
+			default:
+				return fmt.Errorf("%w: unknown log record %d", ErrCorruptDatabase, record.kind)
+			}
+		}
+	}
+	return nil
+}
+
+// ? The manifest is the oldest log still needed, the number of the next run
+// ? and the number and level of each run, followed by a checksum
+func (t *lsmTree) readManifest() error {
+	data, err := ioutil.ReadFile(filepath.Join(t.dir, manifestName))
+	if os.IsNotExist(err) {
+		return t.writeManifest()
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) < len(manifestMagic)+4 || string(data[:len(manifestMagic)]) != manifestMagic {
+		return fmt.Errorf("%w: bad manifest", ErrCorruptDatabase)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return fmt.Errorf("%w: bad manifest checksum", ErrCorruptDatabase)
+	}
+
+	d := &decoder{r: bytes.NewReader(body[len(manifestMagic):])}
+	t.oldest = uint32(d.uvarint())
+	t.nextRun = d.uvarint()
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		number, level := d.uvarint(), int(d.uvarint())
+		if d.err != nil {
+			break
+		}
+		run, err := openRun(t.runPath(number), number, level)
+		if err != nil {
+			return err
+		}
+		t.runs = append(t.runs, run)
+	}
+	return d.finish()
+}
+
+// ? Replace the manifest at once by renaming a new one over it
+func (t *lsmTree) writeManifest() error {
+	var buf bytes.Buffer
+	buf.WriteString(manifestMagic)
+	putUvarint(&buf, uint64(t.oldest))
+	putUvarint(&buf, t.nextRun)
+	putUvarint(&buf, uint64(len(t.runs)))
+	for _, run := range t.runs {
+		putUvarint(&buf, run.number)
+		putUvarint(&buf, uint64(run.level))
+	}
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(crc[:])
+
+	path := filepath.Join(t.dir, manifestName)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(buf.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err == nil {
+		err = syncDir(t.dir)
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ? Remove runs the manifest does not list, left by a flush or compaction
+// ? cut short, and logs older than those it needs, left by a flush done
+// ? just before a crash
+func (t *lsmTree) removeUnused() error {
+	listed := make(map[uint64]bool)
+	for _, run := range t.runs {
+		listed[run.number] = true
+	}
+	names, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range names {
+		name := info.Name()
+		suffix := filepath.Ext(name)
+		number, err := strconv.ParseUint(strings.TrimSuffix(name, suffix), 10, 64)
+		if err != nil || suffix == runSuffix && listed[number] ||
+			suffix == logSuffix && number >= uint64(t.oldest) ||
+			suffix != runSuffix && suffix != logSuffix {
+			continue
+		}
+		if err = os.Remove(filepath.Join(t.dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *lsmTree) runPath(number uint64) string {
+	return filepath.Join(t.dir, strconv.FormatUint(number, 10)+runSuffix)
+}
+
+func (t *lsmTree) logPath(generation uint32) string {
+	return filepath.Join(t.dir, strconv.FormatUint(uint64(generation), 10)+logSuffix)
+}
+
+// ? Start merging runs in the background. keep is asked about each entry
+// ? the compactions write, from their goroutine.
+func (t *lsmTree) startCompaction(keep func(key []byte) bool) {
+	t.keep = keep
+	go t.compactRuns()
+	t.compact <- struct{}{}
+}
+
+// ? Make entries durable and apply them, one write at a time
+func (t *lsmTree) write(entries []*lsmEntry) error {
+	records := make([]*logRecord, len(entries))
+	for i, entry := range entries {
+		records[i] = &logRecord{kind: putLogRecord, name: string(entry.key), data: entry.value}
+		if entry.deleted {
+			records[i].kind = deleteLogRecord
+		}
+	}
+	if err := t.log.append(records); err != nil {
+		return err
+	}
+
+	// ? The entries are written once they are in the log. What follows only
+	// ? keeps the memtable from growing without bound, and when it fails the
+	// ? memtable grows until the next write tries again.
+	t.mu.Lock()
+	for _, entry := range entries {
+		t.memtable.put(entry)
+	}
+	full := t.memtable.size >= t.flushSize
+	if full {
+		t.waitForFlush()
+	}
+	retry := full && t.flushing != nil
+	if retry {
+		t.flushErr = nil
+		go t.flush(t.flushing)
+	}
+	t.mu.Unlock()
+	if !full || retry {
+		return nil
+	}
+
+	log, _, err := openLog(t.logPath(t.generation+1), t.generation+1)
+	if err == nil {
+		err = syncDir(t.dir)
+	}
+	if err != nil {
+		if log != nil {
+			log.close()
+		}
+		return nil
+	}
+	t.mu.Lock()
+	mem, previous := t.memtable, t.log
+	t.flushing, t.memtable = mem, newMemtable()
+	t.log = log
+	t.generation++
+	t.mu.Unlock()
+	previous.close()
+	go t.flush(mem)
+	return nil
+}
+
+// ? Wait until no flush is running, with t locked
+func (t *lsmTree) waitForFlush() {
+	for t.flushing != nil && t.flushErr == nil {
+		t.flushed.Wait()
+	}
+}
+
+// ? Write mem to a new run on level 0. Until the manifest lists the run the
+// ? logs of mem are kept, and removed once it does.
+func (t *lsmTree) flush(mem *memtable) {
+	t.mu.Lock()
+	number := t.nextRun
+	t.nextRun++
+	t.mu.Unlock()
+
+	entries := mem.slice(nil, nil)
+	run, err := writeRun(t.runPath(number), number, 0, func() (*lsmEntry, error) {
+		if len(entries) == 0 {
+			return nil, nil
+		}
+		entry := entries[0]
+		entries = entries[1:]
+		return entry, nil
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.flushed.Broadcast()
+	oldest := t.oldest
+	if err == nil {
+		t.runs = append([]*sortedRun{run}, t.runs...)
+		t.oldest = t.generation
+		if err = t.writeManifest(); err != nil {
+			t.runs = t.runs[1:]
+			t.oldest = oldest
+			run.file.Close()
+			os.Remove(t.runPath(number))
+		}
+	}
+	if err != nil {
+		t.flushErr = err
+		return
+	}
+
+	t.flushing = nil
+	for generation := oldest; generation < t.oldest; generation++ {
+		os.Remove(t.logPath(generation))
+	}
+	select {
+	case t.compact <- struct{}{}:
+	default:
+	}
+}
+
+// ? Call fn with the entries whose keys go from start up to end, a nil end
+// ? has no bound, in the order of their keys. Runs are skipped when their
+// ? bloom filter does not have scanFilterKey of the range.
+func (t *lsmTree) scan(start, end []byte, fn func(key, value []byte) error) error {
+	t.mu.Lock()
+	iterators := []entryIterator{&sliceIterator{entries: t.memtable.slice(start, end)}}
+	if t.flushing != nil {
+		iterators = append(iterators, &sliceIterator{entries: t.flushing.slice(start, end)})
+	}
+	filter := scanFilterKey(start, end)
+	var runs []*sortedRun
+	for _, run := range t.runs {
+		if run.mayContain(start, end, filter) {
+			run.refs++
+			runs = append(runs, run)
+			iterators = append(iterators, run.seek(start, end))
+		}
+	}
+	t.mu.Unlock()
+	defer t.release(runs)
+
+	merged := newMergeIterator(iterators)
+	for merged.next() {
+		entry := merged.entry()
+		if entry.deleted {
+			continue
+		}
+		if err := fn(entry.key, entry.value); err != nil {
+			return err
+		}
+	}
+	return merged.error()
+}
+
+// ? Let go of runs a scan or compaction read, removing those that were
+// ? replaced once nothing reads them
+func (t *lsmTree) release(runs []*sortedRun) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, run := range runs {
+		run.refs--
+		t.removeObsolete(run)
+	}
+}
+
+func (t *lsmTree) removeObsolete(run *sortedRun) {
+	if run.obsolete && run.refs == 0 {
+		run.file.Close()
+		os.Remove(t.runPath(run.number))
+	}
+}
+
+func (t *lsmTree) compactRuns() {
+	defer close(t.done)
+	for range t.compact {
+		for {
+			runs, bottom := t.pickCompaction()
+			if runs == nil {
+				break
+			}
+			err := t.compactLevel(runs, bottom)
+			t.mu.Lock()
+			t.compactErr = err
+			t.mu.Unlock()
+			if err != nil {
+				break
+			}
+		}
+	}
+}
+
+// ? The oldest compactionRuns runs of the first level that has as many,
+// ? and whether the oldest of all is among them
+func (t *lsmTree) pickCompaction() ([]*sortedRun, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for end := len(t.runs); end > 0; {
+		start := end - 1
+		for start > 0 && t.runs[start-1].level == t.runs[end-1].level {
+			start--
+		}
+		if end-start >= compactionRuns {
+			runs := append([]*sortedRun{}, t.runs[end-compactionRuns:end]...)
+			for _, run := range runs {
+				run.refs++
+			}
+			return runs, end == len(t.runs)
+		}
+		end = start
+	}
+	return nil, false
+}
+
+// ? Merge runs, which follow each other, into one run of the next level.
+// ? Deletes only hide keys in older runs, so they are dropped along with
+// ? what they hide once there are none.
+func (t *lsmTree) compactLevel(runs []*sortedRun, bottom bool) error {
+	defer t.release(runs)
+
+	t.mu.Lock()
+	number := t.nextRun
+	t.nextRun++
+	t.mu.Unlock()
+
+	iterators := make([]entryIterator, len(runs))
+	for i, run := range runs {
+		iterators[i] = run.seek(nil, nil)
+	}
+	merged := newMergeIterator(iterators)
+	run, err := writeRun(t.runPath(number), number, runs[0].level+1, func() (*lsmEntry, error) {
+		for merged.next() {
+			entry := merged.entry()
+			if entry.deleted && bottom || !t.keep(entry.key) {
+				continue
+			}
+			return entry, nil
+		}
+		return nil, merged.error()
+	})
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old := t.runs
+	i := 0
+	for t.runs[i] != runs[0] {
+		i++
+	}
+	t.runs = append(append(append([]*sortedRun{}, old[:i]...), run), old[i+len(runs):]...)
+	if err = t.writeManifest(); err != nil {
+		t.runs = old
+		run.file.Close()
+		os.Remove(t.runPath(number))
+		return err
+	}
+	for _, run := range runs {
+		run.obsolete = true
+	}
+	return nil
+}
+
+// ? Stop compacting, once the flush and compaction running are done, and
+// ? close the files. Returns the error of the last flush or compaction if
+// ? it failed.
+func (t *lsmTree) close() error {
+	t.mu.Lock()
+	t.waitForFlush()
+	t.mu.Unlock()
+	if t.keep != nil {
+		close(t.compact)
+		<-t.done
+	}
+	var err error
+	if t.log != nil {
+		err = t.log.close()
+	}
+	t.closeRuns()
+	if err == nil {
+		err = t.flushErr
+	}
+	if err == nil {
+		err = t.compactErr
+	}
+	return err
+}
+
+func (t *lsmTree) closeRuns() {
+	for _, run := range t.runs {
+		run.file.Close()
+	}
+}
+
+type entryIterator interface {
+	next() bool
+	entry() *lsmEntry
+	error() error
+}
+
+type sliceIterator struct {
+	entries []*lsmEntry
+	current *lsmEntry
+}
+
+func (it *sliceIterator) next() bool {
+	if len(it.entries) == 0 {
+		return false
+	}
+	it.current, it.entries = it.entries[0], it.entries[1:]
+	return true
+}
+
+func (it *sliceIterator) entry() *lsmEntry {
+	return it.current
+}
+
+func (it *sliceIterator) error() error {
+	return nil
+}
+
+// ? Merges iterators given from newest to oldest into one in the order of
+// ? keys. Of the entries with the same key only the newest is kept.
+type mergeIterator struct {
+	iterators []entryIterator
+	// ? The next entry of each iterator, nil once it is done
+	heads   []*lsmEntry
+	current *lsmEntry
+	err     error
+}
+
+func newMergeIterator(iterators []entryIterator) *mergeIterator {
+	m := &mergeIterator{iterators: iterators, heads: make([]*lsmEntry, len(iterators))}
+	for i := range iterators {
+		m.advance(i)
+	}
+	return m
+}
+
+func (m *mergeIterator) advance(i int) {
+	if m.iterators[i].next() {
+		m.heads[i] = m.iterators[i].entry()
+		return
+	}
+	m.heads[i] = nil
+	if err := m.iterators[i].error(); err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *mergeIterator) next() bool {
+	if m.err != nil {
+		return false
+	}
+	// ? On equal keys the newer iterator comes first
+	least := -1
+	for i, head := range m.heads {
+		if head != nil && (least < 0 || bytes.Compare(head.key, m.heads[least].key) < 0) {
+			least = i
+		}
+	}
+	if least < 0 {
+		return false
+	}
+
+	m.current = m.heads[least]
+	for i, head := range m.heads {
+		if head != nil && bytes.Equal(head.key, m.current.key) {
+			m.advance(i)
+		}
+	}
+	return m.err == nil
+}
+
+func (m *mergeIterator) entry() *lsmEntry {
+	return m.current
+}
+
+func (m *mergeIterator) error() error {
+	return m.err
+}
+
+const memtableLevels = 16
+
+// ? A skip list of entries sorted by key
+type memtable struct {
+	head memtableNode
+	// ? Bytes of keys and values
+	size   int
+	random *rand.Rand
+}
+
+type memtableNode struct {
+	entry *lsmEntry
+	next  []*memtableNode
+}
+
+func newMemtable() *memtable {
+	return &memtable{
+		head:   memtableNode{next: make([]*memtableNode, memtableLevels)},
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+// ? Add entry, in place of the one with the same key if any
+func (m *memtable) put(entry *lsmEntry) {
+	var previous [memtableLevels]*memtableNode
+	node := &m.head
+	for level := memtableLevels - 1; level >= 0; level-- {
+		for node.next[level] != nil && bytes.Compare(node.next[level].entry.key, entry.key) < 0 {
+			node = node.next[level]
+		}
+		previous[level] = node
+	}
+
+	if found := node.next[0]; found != nil && bytes.Equal(found.entry.key, entry.key) {
+		m.size += len(entry.value) - len(found.entry.value)
+		found.entry = entry
+		return
+	}
+
+	// ? Each level has about a quarter of the nodes of the one below
+	levels := 1
+	for levels < memtableLevels && m.random.Intn(4) == 0 {
+		levels++
+	}
+	added := &memtableNode{entry: entry, next: make([]*memtableNode, levels)}
+	for level := 0; level < levels; level++ {
+		added.next[level] = previous[level].next[level]
+		previous[level].next[level] = added
+	}
+	m.size += len(entry.key) + len(entry.value)
+}
+
+// ? The entries from start up to end, a nil end has no bound
+func (m *memtable) slice(start, end []byte) []*lsmEntry {
+	node := &m.head
+	for level := memtableLevels - 1; level >= 0; level-- {
+		for node.next[level] != nil && bytes.Compare(node.next[level].entry.key, start) < 0 {
+			node = node.next[level]
+		}
+	}
+
+	var entries []*lsmEntry
+	for node = node.next[0]; node != nil; node = node.next[0] {
+		if end != nil && bytes.Compare(node.entry.key, end) >= 0 {
+			break
+		}
+		entries = append(entries, node.entry)
+	}
+	return entries
+}
@@ -1,10 +1,14 @@
 package backend
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jameslahm/gosql/ast"
 	"github.com/jameslahm/gosql/lex"
@@ -13,56 +17,249 @@ import (
 type MemoryCell []byte
 
 func (mc MemoryCell) AsInt() int32 {
-	var i int32
-	err := binary.Read(bytes.NewBuffer(mc), binary.BigEndian, &i)
-	if err != nil {
-		panic(err)
+	return int32(mc.AsBigInt())
+}
+
+// ? Int cells are stored in 4 bytes, bigint cells in 8
+func (mc MemoryCell) AsBigInt() int64 {
+	if len(mc) == 4 {
+		return int64(int32(binary.BigEndian.Uint32(mc)))
 	}
-	return i
+	return int64(binary.BigEndian.Uint64(mc))
 }
 
 func (mc MemoryCell) AsText() string {
 	return string(mc)
 }
 
+func (mc MemoryCell) AsBool() bool {
+	return len(mc) == 1 && mc[0] == 1
+}
+
+// ? NULL is stored as a nil cell, the empty string is a non-nil empty cell
+func (mc MemoryCell) IsNull() bool {
+	return mc == nil
+}
+
+func intCell(i int32) MemoryCell {
+	var buf = make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(i))
+	return buf
+}
+
+func bigIntCell(i int64) MemoryCell {
+	var buf = make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(i))
+	return buf
+}
+
+func boolCell(b bool) MemoryCell {
+	if b {
+		return MemoryCell{1}
+	}
+	return MemoryCell{0}
+}
+
+func textCell(s string) MemoryCell {
+	return append(MemoryCell{}, s...)
+}
+
+func cellToString(cell MemoryCell, t ColumnType) string {
+	if cell == nil {
+		return "NULL"
+	}
+	if isNumeric(t) {
+		return strconv.FormatInt(cell.AsBigInt(), 10)
+	}
+	if t == BoolType {
+		return strconv.FormatBool(cell.AsBool())
+	}
+	return cell.AsText()
+}
+
+// ? Rows are numbered in the order they were added. A table of a DiskBackend
+// ? can keep the first of them in its file, rows holds the others.
 type Table struct {
 	Columns     []string
 	ColumnTypes []ColumnType
-	Rows        [][]MemoryCell
+	rows        rowTree
+	stored      rowSource
+	// ? Holds a rowSource with all of the rows once they were written out.
+	// ? The table and newer versions read them from there, what they were
+	// ? read from before, like the table ALTER TABLE made this one from,
+	// ? can be dropped.
+	written atomic.Value
+}
+
+// ? Rows of a table kept out of memory by a DiskBackend or an LSMBackend,
+// ? numbered from 0
+type rowSource interface {
+	// ? Calls fn with the rows numbered from from up to to in turn, stopping
+	// ? at the first error
+	each(from, to int, fn func(row []MemoryCell) error) error
+	len() int
+}
+
+// ? Call fn with every row of the table, those in the file first, without
+// ? reading all of them into memory
+func (t *Table) each(fn func(row []MemoryCell) error) error {
+	return t.scan(0, math.MaxUint64, func(id uint64, row []MemoryCell) error {
+		return fn(row)
+	})
+}
+
+// ? Call fn with the rows whose ids are from from up to to, in the order of
+// ? their ids. Only the rows in that range are read: the tree is searched
+// ? for the first of them.
+func (t *Table) scan(from, to uint64, fn func(id uint64, row []MemoryCell) error) error {
+	if from >= to {
+		return nil
+	}
+	stored, rows := t.storage()
+	if stored != nil && from < uint64(stored.len()) {
+		end := stored.len()
+		if to < uint64(end) {
+			end = int(to)
+		}
+		id := from
+		err := stored.each(int(from), end, func(row []MemoryCell) error {
+			id++
+			return fn(id-1, row)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	rows.ascend(from, func(id uint64, row []MemoryCell) bool {
+		if id >= to {
+			return false
+		}
+		err = fn(id, row)
+		return err == nil
+	})
+	return err
+}
+
+func (t *Table) len() int {
+	if t.stored == nil {
+		return t.rows.count
+	}
+	return t.stored.len() + t.rows.count
 }
 
+// ? Where newer versions of the table find its rows
+func (t *Table) storage() (rowSource, rowTree) {
+	if written, ok := t.written.Load().(rowSource); ok {
+		return written, rowTree{next: uint64(written.len())}
+	}
+	return t.stored, t.rows
+}
+
+// ? A named select, compiled again every time it is used. A materialized
+// ? view keeps its rows in the table of the same name instead, until it is
+// ? refreshed. Query is Select as SQL text, views are stored as that.
+type View struct {
+	Columns      []string
+	Select       *ast.SelectStatement
+	Query        string
+	Materialized bool
+}
+
+// ? Safe for concurrent use, selects run in parallel and everything else one
+// ? at a time. Tables and Views must not be used directly while other
+// ? goroutines run statements.
 type MemoryBackend struct {
-	Tables map[string]*Table
+	mu         sync.RWMutex
+	Tables     map[string]*Table
+	Views      map[string]*View
+	functions  map[string]*scalarFunction
+	aggregates map[string]*aggregateFunction
+	// ? Iterations allowed for a WITH RECURSIVE table, 0 means defaultRecursionLimit
+	recursionLimit int
+	locks          lockManager
+	lockTimeout    time.Duration
+	// ? Set by backends that keep their tables elsewhere, records what the
+	// ? last statement or commit changed, see change
+	persist func() error
+	// ? Set on snapshots, the tables and views as they were when it was taken
+	base *catalog
+	// ? Versions of tables a transaction changed only by inserting rows, with
+	// ? the number of rows inserted since it began
+	inserted map[*Table]int
+	// ? Names of the tables and views a serializable transaction has read
+	reads map[string]bool
 }
 
 func NewMemoryBackend() *MemoryBackend {
 	return &MemoryBackend{
 		Tables: make(map[string]*Table),
+		Views:  make(map[string]*View),
 	}
 }
 
 func (mb *MemoryBackend) CreateTable(stmt *ast.CreateTableStatement) error {
-	tables := mb.Tables
+	return mb.exec(exclusiveLock, []string{stmt.Name.Value}, func() error {
+		return mb.createTable(stmt)
+	})
+}
+
+func (mb *MemoryBackend) createTable(stmt *ast.CreateTableStatement) error {
+	if err := mb.checkNameIsFree(stmt.Name.Value); err != nil {
+		return err
+	}
+
 	var table Table
-	tables[stmt.Name.Value] = &table
 	for _, col := range *stmt.Cols {
 		table.Columns = append(table.Columns, col.Name.Value)
-		switch col.DataType.Value {
-		case string(lex.IntKeyword):
-			table.ColumnTypes = append(table.ColumnTypes, IntType)
-		case string(lex.TextKeyword):
-			table.ColumnTypes = append(table.ColumnTypes, TextType)
-		default:
-			return ErrInvalidDataType
+		columnType, err := columnTypeFromToken(col.DataType)
+		if err != nil {
+			return err
 		}
+		table.ColumnTypes = append(table.ColumnTypes, columnType)
 	}
+	mb.Tables[stmt.Name.Value] = &table
 	return nil
 }
 
+// ? Tables and views share one namespace
+func (mb *MemoryBackend) checkNameIsFree(name string) error {
+	if _, ok := mb.Views[name]; ok {
+		return fmt.Errorf("%w: %s", ErrViewAlreadyExists, name)
+	}
+	if _, ok := mb.Tables[name]; ok {
+		return fmt.Errorf("%w: %s", ErrTableAlreadyExists, name)
+	}
+	return nil
+}
+
+func columnTypeFromToken(t lex.Token) (ColumnType, error) {
+	switch t.Value {
+	case string(lex.IntKeyword):
+		return IntType, nil
+	case string(lex.TextKeyword):
+		return TextType, nil
+	case string(lex.BigIntKeyword):
+		return BigIntType, nil
+	case string(lex.BoolKeyword):
+		return BoolType, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrInvalidDataType, t.Value)
+}
+
 func (mb *MemoryBackend) Insert(stmt *ast.InsertStatement) error {
+	return mb.exec(rowExclusiveLock, []string{stmt.Table.Value}, func() error {
+		return mb.insert(stmt)
+	})
+}
+
+func (mb *MemoryBackend) insert(stmt *ast.InsertStatement) error {
+	if view, ok := mb.Views[stmt.Table.Value]; ok {
+		return fmt.Errorf("%w: %s is a %s", ErrTableDoesNotExist, stmt.Table.Value, view.kind())
+	}
 	table, ok := mb.Tables[stmt.Table.Value]
 	if !ok {
-		return ErrTableDoesNotExist
+		return fmt.Errorf("%w: %s", ErrTableDoesNotExist, stmt.Table.Value)
 	}
 	if len(table.Columns) != len(*stmt.Values) {
 		return ErrMissingValues
@@ -73,71 +270,123 @@ func (mb *MemoryBackend) Insert(stmt *ast.InsertStatement) error {
 	}
 
 	var row []MemoryCell
-	for _, value := range *stmt.Values {
-		if value.Kind != ast.LiteralKind {
-			fmt.Println("Skipping non-literal...")
-			continue
+	for i, value := range *stmt.Values {
+		exp, err := mb.compileExpression(value, &scope{})
+		if err != nil {
+			return err
+		}
+		cell, err := exp.eval(nil)
+		if err != nil {
+			return err
 		}
-		row = append(row, mb.tokenToCell(value.Literal))
+
+		cell, err = coerceCell(cell, exp.Type, table.ColumnTypes[i], table.Columns[i])
+		if err != nil {
+			return err
+		}
+		row = append(row, cell)
 	}
-	table.Rows = append(table.Rows, row)
+	mb.Tables[stmt.Table.Value] = mb.appendRow(stmt.Table.Value, table, row)
 	return nil
 }
 
-func (mb *MemoryBackend) tokenToCell(t *lex.Token) MemoryCell {
+// ? A new version of table with row added, which shares the nodes of its
+// ? tree with table. In a transaction, the rows it inserted are counted.
+func (mb *MemoryBackend) appendRow(name string, table *Table, row []MemoryCell) *Table {
+	stored, rows := table.storage()
+	inserted, ok := mb.inserted[table]
+	if mb.base != nil && mb.base.tables[name] == table {
+		inserted, ok = 0, true
+	}
+
+	appended := &Table{
+		Columns:     table.Columns,
+		ColumnTypes: table.ColumnTypes,
+		rows:        rows.append(row),
+		stored:      stored,
+	}
+	if ok {
+		mb.inserted[appended] = inserted + 1
+	}
+	return appended
+}
+
+// ? Coerce a value stored into column
+func coerceCell(cell MemoryCell, from, to ColumnType, column string) (MemoryCell, error) {
+	if from == to {
+		return cell, nil
+	}
+	if !canCoerce(from, to) {
+		return nil, fmt.Errorf("%w: column %s expects %s, got %s", ErrInvalidDataType, column, to, from)
+	}
+	cell, err := castCell(cell, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%w, in column %s", err, column)
+	}
+	return cell, nil
+}
+
+// ? Number literals are int when they fit in 32 bits and bigint otherwise
+func (mb *MemoryBackend) tokenToCell(t *lex.Token) (MemoryCell, ColumnType, error) {
 	if t.Kind == lex.NumberKind {
-		value, err := strconv.Atoi(t.Value)
-		if err != nil {
-			panic(err)
+		value, err := strconv.ParseInt(t.Value, 10, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, 0, fmt.Errorf("%w: %s does not fit in bigint", ErrIntegerOutOfRange, t.Value)
 		}
-		var buf = new(bytes.Buffer)
-		err = binary.Write(buf, binary.BigEndian, int32(value))
 		if err != nil {
-			panic(err)
+			return nil, 0, fmt.Errorf("%w: %s is not an integer", ErrInvalidDataType, t.Value)
 		}
-		return buf.Bytes()
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			return bigIntCell(value), BigIntType, nil
+		}
+		return intCell(int32(value)), IntType, nil
 	} else if t.Kind == lex.StringKind {
-		return []byte(t.Value)
+		return textCell(t.Value), TextType, nil
+	} else if t.Kind == lex.KeywordKind {
+		switch lex.Keyword(t.Value) {
+		case lex.NullKeyword:
+			return nil, NullType, nil
+		case lex.TrueKeyword:
+			return boolCell(true), BoolType, nil
+		case lex.FalseKeyword:
+			return boolCell(false), BoolType, nil
+		}
 	}
-	return nil
+	return nil, 0, ErrInvalidExpression
 }
 
+// ? Runs on a snapshot, the lock is only held while it is taken so a long
+// ? select does not hold up writers
 func (mb *MemoryBackend) Select(stmt *ast.SelectStatement) (*Results, error) {
-	table, ok := mb.Tables[stmt.From.Value]
-	if !ok {
-		return nil, ErrTableDoesNotExist
-	}
-
-	var columns []ResultColumn
-	var indexes []int
-	for _, col := range *stmt.Items {
-		for i, colInfo := range table.Columns {
-			if col.Literal.Value == colInfo {
-				indexes = append(indexes, i)
-				columns = append(columns, ResultColumn{
-					Name: col.Literal.Value,
-					Type: table.ColumnTypes[i],
-				})
-				break
-			}
-		}
+	mb.mu.RLock()
+	snapshot := mb.snapshot()
+	mb.mu.RUnlock()
+
+	return snapshot.query(stmt)
+}
+
+func (mb *MemoryBackend) query(stmt *ast.SelectStatement) (*Results, error) {
+	slct, err := mb.compileSelect(stmt, &scope{})
+	if err != nil {
+		return nil, err
 	}
 
-	if len(indexes) != len(*stmt.Items) {
-		return nil, ErrColumnDoesNotExist
+	rows, err := slct.run(nil)
+	if err != nil {
+		return nil, err
 	}
 
 	var resultRows [][]Cell
-	for _, row := range table.Rows {
+	for _, row := range rows {
 		var resultRow []Cell
-		for _, i := range indexes {
-			resultRow = append(resultRow, &row[i])
+		for _, cell := range row {
+			resultRow = append(resultRow, cell)
 		}
 		resultRows = append(resultRows, resultRow)
 	}
 
 	return &Results{
-		Columns: columns,
+		Columns: slct.columns,
 		Rows:    resultRows,
 	}, nil
 }
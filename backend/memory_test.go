@@ -0,0 +1,209 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? Run the statements of sql on e, returning the results of the last select
+func execute(e Executor, sql string) (*Results, error) {
+	tokens, err := lex.Lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	program, err := ast.Parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	var results *Results
+	for _, stmt := range program.Statements {
+		switch stmt.Kind {
+		case ast.CreateTableKind:
+			err = e.CreateTable(stmt.CreateTableStatement)
+		case ast.InsertKind:
+			err = e.Insert(stmt.InsertStatement)
+		case ast.CreateViewKind:
+			err = e.CreateView(stmt.CreateViewStatement)
+		case ast.DropViewKind:
+			err = e.DropView(stmt.DropViewStatement)
+		case ast.RefreshViewKind:
+			err = e.RefreshView(stmt.RefreshViewStatement)
+		case ast.AlterTableKind:
+			err = e.AlterTable(stmt.AlterTableStatement)
+		case ast.SelectKind:
+			results, err = e.Select(stmt.SelectStatement)
+		default:
+			err = fmt.Errorf("unexpected statement in %q", sql)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// ? The only value a select returns
+func count(e Executor, sql string) (int64, error) {
+	results, err := execute(e, sql)
+	if err != nil {
+		return 0, err
+	}
+	if len(results.Rows) != 1 || len(results.Rows[0]) != 1 {
+		return 0, fmt.Errorf("%q returned %d rows", sql, len(results.Rows))
+	}
+	return results.Rows[0][0].AsBigInt(), nil
+}
+
+func mustExecute(t *testing.T, e Executor, sql string) {
+	t.Helper()
+	if _, err := execute(e, sql); err != nil {
+		t.Fatalf("%s: %s", sql, err)
+	}
+}
+
+func TestConcurrentSelectsAndInserts(t *testing.T) {
+	mb := NewMemoryBackend()
+	mustExecute(t, mb, "CREATE TABLE t (a INT);")
+
+	const (
+		workers    = 4
+		statements = 100
+	)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(3)
+
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < statements; i++ {
+				if _, err := execute(mb, fmt.Sprintf("INSERT INTO t VALUES (%d);", i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+
+		// ? Rows are only ever added, so each select sees at least as many
+		// ? as the one before it
+		go func() {
+			defer wg.Done()
+			var last int64
+			for i := 0; i < statements; i++ {
+				n, err := count(mb, "SELECT count(*) FROM t;")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if n < last {
+					t.Errorf("count went from %d down to %d", last, n)
+					return
+				}
+				last = n
+			}
+		}()
+
+		// ? Every other transaction rolls back, the others add two rows each
+		go func() {
+			defer wg.Done()
+			for i := 0; i < statements; i++ {
+				tx, err := mb.Begin(&ast.BeginStatement{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				before, err := count(tx, "SELECT count(*) FROM t;")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				after, err := count(tx, "INSERT INTO t VALUES (1); INSERT INTO t VALUES (2); SELECT count(*) FROM t;")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if after != before+2 {
+					t.Errorf("transaction saw %d rows after adding two to %d", after, before)
+				}
+				if i%2 == 0 {
+					err = tx.Commit()
+				} else {
+					err = tx.Rollback()
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := count(mb, "SELECT count(*) FROM t;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(workers*statements + workers*statements/2*2); n != want {
+		t.Errorf("got %d rows, want %d", n, want)
+	}
+}
+
+// ? Two transactions changing the same table in other ways than adding rows
+// ? can not both commit
+func TestConcurrentAlterConflicts(t *testing.T) {
+	mb := NewMemoryBackend()
+	mustExecute(t, mb, "CREATE TABLE t (a INT); INSERT INTO t VALUES (1);")
+
+	const workers = 8
+	// ? All of them begin before any of them alters the table
+	var begun, wg sync.WaitGroup
+	var mu sync.Mutex
+	committed := 0
+	start := make(chan bool)
+	for w := 0; w < workers; w++ {
+		begun.Add(1)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			tx, err := mb.Begin(&ast.BeginStatement{})
+			begun.Done()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			<-start
+			if _, err = execute(tx, fmt.Sprintf("ALTER TABLE t ADD COLUMN c%d INT;", w)); err == nil {
+				err = tx.Commit()
+			} else {
+				tx.Rollback()
+			}
+			switch {
+			case err == nil:
+				mu.Lock()
+				committed++
+				mu.Unlock()
+			case !errors.Is(err, ErrSerializationFailure) && !errors.Is(err, ErrDeadlock) && !errors.Is(err, ErrLockTimeout):
+				t.Error(err)
+			}
+		}(w)
+	}
+	begun.Wait()
+	close(start)
+	wg.Wait()
+
+	if committed != 1 {
+		t.Fatalf("%d transactions committed, want 1", committed)
+	}
+	results, err := execute(mb, "SELECT * FROM t;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Columns) != 2 || len(results.Rows) != 1 {
+		t.Errorf("got %d columns and %d rows, want 2 and 1", len(results.Columns), len(results.Rows))
+	}
+}
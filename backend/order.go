@@ -0,0 +1,155 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+type compiledOrderBy struct {
+	exps []*compiledExpression
+	desc []bool
+}
+
+// ? ORDER BY expressions are evaluated on the same rows as the select items,
+// ? a bare number refers to the select item at that position and a bare name
+// ? to the select item of that name before any column
+func (mb *MemoryBackend) compileOrderBy(orderBy *[]*ast.OrderByItem, s *scope, items []*compiledExpression, names []string) (*compiledOrderBy, error) {
+	if orderBy == nil {
+		return nil, nil
+	}
+
+	ob := &compiledOrderBy{}
+	for _, item := range *orderBy {
+		var exp *compiledExpression
+		if item.Exp.Kind == ast.LiteralKind && item.Exp.Literal.Kind == lex.NumberKind {
+			position, err := strconv.Atoi(item.Exp.Literal.Value)
+			if err != nil || position < 1 || position > len(items) {
+				return nil, fmt.Errorf("%w: ORDER BY position %s is not in select list", ErrInvalidExpression, item.Exp.Literal.Value)
+			}
+			exp = items[position-1]
+		} else if i := outputColumn(item.Exp, names); i >= 0 {
+			exp = items[i]
+		} else {
+			var err error
+			exp, err = mb.compileExpression(item.Exp, s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ob.exps = append(ob.exps, exp)
+		ob.desc = append(ob.desc, item.Desc)
+	}
+	return ob, nil
+}
+
+// ? With DISTINCT, rows differing only in what ORDER BY sorts them by are one
+// ? row, so it can only sort by the select items: by position, by name, by
+// ? the same expression or by one of the first selected columns * selects
+func checkDistinctOrderBy(orderBy *[]*ast.OrderByItem, items []*ast.SelectItem, s *scope, selected int, names []string) error {
+	if orderBy == nil {
+		return nil
+	}
+
+outer:
+	for _, item := range *orderBy {
+		exp := item.Exp
+		if exp.Kind == ast.LiteralKind && exp.Literal.Kind == lex.NumberKind || outputColumn(exp, names) >= 0 {
+			continue
+		}
+		for _, selectItem := range items {
+			if !selectItem.Asterisk && sameExpression(selectItem.Exp, exp) {
+				continue outer
+			}
+			if selectItem.Asterisk && exp.Kind == ast.LiteralKind && exp.Literal.Kind == lex.IdentifierKind {
+				if i, err := s.lookup(exp.Qualifier, exp.Literal.Value); err == nil && i < selected {
+					continue outer
+				}
+			}
+		}
+		return fmt.Errorf("%w: for SELECT DISTINCT, ORDER BY expressions must appear in select list", ErrInvalidExpression)
+	}
+	return nil
+}
+
+// ? Index of the only select item named like a bare identifier, -1 otherwise
+func outputColumn(exp *ast.Expression, names []string) int {
+	if exp.Kind != ast.LiteralKind || exp.Qualifier != nil || exp.Literal.Kind != lex.IdentifierKind {
+		return -1
+	}
+	found := -1
+	for i, name := range names {
+		if name == exp.Literal.Value {
+			if found >= 0 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+func (ob *compiledOrderBy) keys(row []MemoryCell) ([]MemoryCell, error) {
+	keys := make([]MemoryCell, len(ob.exps))
+	for i, exp := range ob.exps {
+		cell, err := exp.eval(row)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = cell
+	}
+	return keys, nil
+}
+
+// ? Stable sort of rows by their keys, NULLs sort after every value so they
+// ? come last ascending and first descending
+func (ob *compiledOrderBy) sort(rows [][]MemoryCell, keys [][]MemoryCell) {
+	sort.Stable(&rowSorter{ob: ob, rows: rows, keys: keys})
+}
+
+type rowSorter struct {
+	ob   *compiledOrderBy
+	rows [][]MemoryCell
+	keys [][]MemoryCell
+}
+
+func (rs *rowSorter) Len() int {
+	return len(rs.rows)
+}
+
+func (rs *rowSorter) Swap(i, j int) {
+	rs.rows[i], rs.rows[j] = rs.rows[j], rs.rows[i]
+	rs.keys[i], rs.keys[j] = rs.keys[j], rs.keys[i]
+}
+
+func (rs *rowSorter) Less(i, j int) bool {
+	return rs.ob.compare(rs.keys[i], rs.keys[j]) < 0
+}
+
+// ? Compare two rows by their keys in sort order, 0 when they are peers
+func (ob *compiledOrderBy) compare(keysA, keysB []MemoryCell) int {
+	for k, exp := range ob.exps {
+		a, b := keysA[k], keysB[k]
+		var cmp int
+		switch {
+		case a == nil && b == nil:
+			cmp = 0
+		case a == nil:
+			cmp = 1
+		case b == nil:
+			cmp = -1
+		default:
+			cmp = compareCells(a, exp.Type, b, exp.Type)
+		}
+		if ob.desc[k] {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
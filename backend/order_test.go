@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+)
+
+// ? SELECT DISTINCT can only be sorted by what it selects
+func TestDistinctOrderBy(t *testing.T) {
+	mb := NewMemoryBackend()
+	mustExecute(t, mb, "CREATE TABLE t (id INT, v INT); INSERT INTO t VALUES (2, 1); INSERT INTO t VALUES (1, 2); INSERT INTO t VALUES (2, 3);")
+
+	for _, test := range []struct {
+		sql  string
+		want []int32
+	}{
+		{"SELECT DISTINCT id FROM t ORDER BY id;", []int32{1, 2}},
+		{"SELECT DISTINCT id FROM t ORDER BY 1 DESC;", []int32{2, 1}},
+		{"SELECT DISTINCT id AS n FROM t ORDER BY n;", []int32{1, 2}},
+		{"SELECT DISTINCT id + 1 FROM t ORDER BY id + 1 DESC;", []int32{3, 2}},
+		{"SELECT DISTINCT t.id FROM t ORDER BY t.id;", []int32{1, 2}},
+		{"SELECT DISTINCT * FROM t ORDER BY t.v DESC;", []int32{2, 1, 2}},
+		{"SELECT id FROM t ORDER BY v DESC;", []int32{2, 1, 2}},
+	} {
+		results, err := execute(mb, test.sql)
+		if err != nil {
+			t.Errorf("%s: %v", test.sql, err)
+			continue
+		}
+		var got []int32
+		for _, row := range results.Rows {
+			got = append(got, row[0].AsInt())
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.sql, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, want %v", test.sql, got, test.want)
+				break
+			}
+		}
+	}
+
+	for _, sql := range []string{
+		"SELECT DISTINCT id FROM t ORDER BY v;",
+		"SELECT DISTINCT id FROM t ORDER BY id + 1;",
+		"SELECT DISTINCT id, v FROM t ORDER BY rowid;",
+		"SELECT DISTINCT * FROM t ORDER BY rowid;",
+	} {
+		if _, err := execute(mb, sql); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("%s: got %v, want ErrInvalidExpression", sql, err)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	pageSize = 4096
+
+	fileMagic   = "gosqldb\x00"
+	fileVersion = 2
+	// ? Only the start of the header page is used, so it is written at once
+	headerSize = 32
+	// ? Each page of a chain starts with the id of the next one and the
+	// ? length of its data
+	chainHeaderSize = 6
+	chainDataSize   = pageSize - chainHeaderSize
+)
+
+// ? Pages are numbered from 0, which is the header, so 0 also marks the end
+// ? of a chain
+type pageID uint32
+
+// ? A file of fixed-size pages. The header page points to the root chain,
+// ? every other page is part of a chain reachable from it or free. Pages are
+// ? never changed while reachable: new data goes to free pages and becomes
+// ? visible all at once when the header is written. Pages other than the
+// ? header are read and written through the pool.
+type pager struct {
+	file *os.File
+	pool *bufferPool
+	// ? Guards pageCount and free, statements read pages while a checkpoint
+	// ? allocates others
+	mu        sync.Mutex
+	pageCount uint32
+	root      pageID
+	// ? Counts the checkpoints written, see writeAheadLog
+	checkpoint uint32
+	// ? Unreachable pages, found again when the file is opened
+	free []pageID
+}
+
+func openPager(path string) (*pager, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pager{file: file, pool: newBufferPool(file, defaultCachePages)}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		p.pageCount = 1
+		err = p.commit(0, 0)
+	} else {
+		err = p.readHeader()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pager) readHeader() error {
+	header := make([]byte, headerSize)
+	if _, err := p.file.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("%w: %s", ErrCorruptDatabase, err)
+	}
+	if string(header[:8]) != fileMagic {
+		return fmt.Errorf("%w: not a gosql database", ErrCorruptDatabase)
+	}
+	if crc32.ChecksumIEEE(header[:28]) != binary.BigEndian.Uint32(header[28:]) {
+		return fmt.Errorf("%w: bad header checksum", ErrCorruptDatabase)
+	}
+	if version := binary.BigEndian.Uint32(header[8:]); version != fileVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrCorruptDatabase, version)
+	}
+	if size := binary.BigEndian.Uint32(header[12:]); size != pageSize {
+		return fmt.Errorf("%w: page size %d", ErrCorruptDatabase, size)
+	}
+	p.pageCount = binary.BigEndian.Uint32(header[16:])
+	p.root = pageID(binary.BigEndian.Uint32(header[20:]))
+	p.checkpoint = binary.BigEndian.Uint32(header[24:])
+	return nil
+}
+
+// ? Pin page id in the pool, it has to be unpinned once read
+func (p *pager) pin(id pageID) (*frame, error) {
+	p.mu.Lock()
+	count := p.pageCount
+	p.mu.Unlock()
+	if id == 0 || uint32(id) >= count {
+		return nil, fmt.Errorf("%w: page %d out of range", ErrCorruptDatabase, id)
+	}
+	return p.pool.pin(id)
+}
+
+// ? Make the pages written so far durable
+func (p *pager) sync() error {
+	if err := p.pool.flush(); err != nil {
+		return err
+	}
+	return p.file.Sync()
+}
+
+func (p *pager) allocate() pageID {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n := len(p.free); n > 0 {
+		id := p.free[n-1]
+		p.free = p.free[:n-1]
+		return id
+	}
+	p.pageCount++
+	return pageID(p.pageCount - 1)
+}
+
+// ? Make everything written so far durable and switch to the new root chain
+func (p *pager) commit(root pageID, checkpoint uint32) error {
+	if err := p.sync(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	count := p.pageCount
+	p.mu.Unlock()
+
+	header := make([]byte, headerSize)
+	copy(header, fileMagic)
+	binary.BigEndian.PutUint32(header[8:], fileVersion)
+	binary.BigEndian.PutUint32(header[12:], pageSize)
+	binary.BigEndian.PutUint32(header[16:], count)
+	binary.BigEndian.PutUint32(header[20:], uint32(root))
+	binary.BigEndian.PutUint32(header[24:], checkpoint)
+	binary.BigEndian.PutUint32(header[28:], crc32.ChecksumIEEE(header[:28]))
+	if _, err := p.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	p.root, p.checkpoint = root, checkpoint
+	return nil
+}
+
+// ? Write data to a new chain of pages, returning the pages from the first
+func (p *pager) writeChain(data []byte) ([]pageID, error) {
+	w := newChainWriter(p)
+	if _, err := w.Write(data); err != nil {
+		p.release(w.pages)
+		return nil, err
+	}
+	return w.close()
+}
+
+// ? Writes a new chain of pages as the data comes, a page at a time. A page
+// ? is written once the next one is needed, when it is known where that is.
+type chainWriter struct {
+	pager *pager
+	// ? The pages so far, the last is the one being filled
+	pages []pageID
+	page  []byte
+	size  int
+}
+
+func newChainWriter(p *pager) *chainWriter {
+	return &chainWriter{pager: p, pages: []pageID{p.allocate()}}
+}
+
+func (w *chainWriter) Write(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		if len(w.page) == chainDataSize {
+			next := w.pager.allocate()
+			w.pages = append(w.pages, next)
+			if err := w.writePage(w.pages[len(w.pages)-2], next); err != nil {
+				return n, err
+			}
+		}
+		m := chainDataSize - len(w.page)
+		if m > len(b)-n {
+			m = len(b) - n
+		}
+		w.page = append(w.page, b[n:n+m]...)
+		n += m
+	}
+	w.size += n
+	return n, nil
+}
+
+func (w *chainWriter) writePage(id, next pageID) error {
+	f, err := w.pager.pool.pinNew(id)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(f.data, uint32(next))
+	binary.BigEndian.PutUint16(f.data[4:], uint16(len(w.page)))
+	copy(f.data[chainHeaderSize:], w.page)
+	w.pager.pool.unpin(f, true)
+	w.page = w.page[:0]
+	return nil
+}
+
+// ? Write the last page, returning the pages of the chain. They are given
+// ? back when that fails.
+func (w *chainWriter) close() ([]pageID, error) {
+	if err := w.writePage(w.pages[len(w.pages)-1], 0); err != nil {
+		w.pager.release(w.pages)
+		return nil, err
+	}
+	return w.pages, nil
+}
+
+// ? The data of the chain starting at id, and the pages it is made of
+func (p *pager) readChain(id pageID) ([]byte, []pageID, error) {
+	var data bytes.Buffer
+	var ids []pageID
+	for id != 0 {
+		if len(ids) >= int(p.pageCount) {
+			return nil, nil, fmt.Errorf("%w: chain loops", ErrCorruptDatabase)
+		}
+		f, err := p.pin(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		length := binary.BigEndian.Uint16(f.data[4:])
+		next := pageID(binary.BigEndian.Uint32(f.data))
+		if length <= chainDataSize {
+			data.Write(f.data[chainHeaderSize : chainHeaderSize+int(length)])
+		}
+		p.pool.unpin(f, false)
+		if length > chainDataSize {
+			return nil, nil, fmt.Errorf("%w: page %d", ErrCorruptDatabase, id)
+		}
+		ids = append(ids, id)
+		id = next
+	}
+	return data.Bytes(), ids, nil
+}
+
+// ? Reads size bytes from the data of pages, which make up a chain
+type chainReader struct {
+	pager *pager
+	pages []pageID
+	page  []byte
+	// ? What is left of the data of the page read last
+	data []byte
+	left int
+}
+
+func (r *chainReader) Len() int {
+	return r.left
+}
+
+func (r *chainReader) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) && r.left > 0 {
+		if len(r.data) == 0 {
+			if err := r.next(); err != nil {
+				return n, err
+			}
+		}
+		m := copy(b[n:], r.data)
+		r.data = r.data[m:]
+		r.left -= m
+		n += m
+	}
+	if n == 0 && len(b) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *chainReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := r.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ? The data is copied out, so the page is pinned only while it is read
+func (r *chainReader) next() error {
+	if len(r.pages) == 0 {
+		return fmt.Errorf("%w: chain ends early", ErrCorruptDatabase)
+	}
+	id := r.pages[0]
+	r.pages = r.pages[1:]
+	f, err := r.pager.pin(id)
+	if err != nil {
+		return err
+	}
+	defer r.pager.pool.unpin(f, false)
+
+	length := int(binary.BigEndian.Uint16(f.data[4:]))
+	if length == 0 || length > chainDataSize || length > r.left {
+		return fmt.Errorf("%w: page %d", ErrCorruptDatabase, id)
+	}
+	r.page = append(r.page[:0], f.data[chainHeaderSize:chainHeaderSize+length]...)
+	r.data = r.page
+	return nil
+}
+
+// ? Pages of chains that are no longer reachable, only once the header no
+// ? longer leads to them
+func (p *pager) release(ids []pageID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.free = append(p.free, ids...)
+}
+
+// ? Free every page but those in use, after the file is opened. Pages
+// ? written for changes in the log can be past the count in the header,
+// ? which is only written by checkpoints.
+func (p *pager) setUsed(used map[pageID]bool) {
+	for id := range used {
+		if uint32(id) >= p.pageCount {
+			p.pageCount = uint32(id) + 1
+		}
+	}
+	p.free = nil
+	for id := pageID(p.pageCount - 1); id > 0; id-- {
+		if !used[id] {
+			p.free = append(p.free, id)
+		}
+	}
+}
+
+func (p *pager) close() error {
+	return p.file.Close()
+}
@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"sync"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? Statements and transactions of a backend that keeps rows out of memory
+// ? enter the current epoch before they take their snapshot, and leave it
+// ? once done. What a change stops using is retired in the epoch it is made
+// ? in, and only released once nothing that entered that epoch or an earlier
+// ? one is left, since until then some snapshot may still use it.
+type epochs struct {
+	mu    sync.Mutex
+	epoch uint64
+	// ? Statements and transactions running, by the epoch they entered
+	readers map[uint64]int
+	retired []retirement
+}
+
+type retirement struct {
+	epoch   uint64
+	release func()
+}
+
+func (e *epochs) enter() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.readers == nil {
+		e.readers = make(map[uint64]int)
+	}
+	e.readers[e.epoch]++
+	return e.epoch
+}
+
+func (e *epochs) leave(epoch uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.readers[epoch]--
+	if e.readers[epoch] == 0 {
+		delete(e.readers, epoch)
+	}
+	e.release()
+}
+
+// ? Retire what release frees and start a new epoch. release is called with
+// ? e locked.
+func (e *epochs) retire(release func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.retired = append(e.retired, retirement{epoch: e.epoch, release: release})
+	e.epoch++
+	e.release()
+}
+
+func (e *epochs) release() {
+	oldest := e.epoch
+	for epoch := range e.readers {
+		if epoch < oldest {
+			oldest = epoch
+		}
+	}
+	for len(e.retired) > 0 && e.retired[0].epoch < oldest {
+		e.retired[0].release()
+		e.retired = e.retired[1:]
+	}
+}
+
+// ? Statements run on a MemoryBackend, which calls persist to record what a
+// ? statement or commit changed before anyone else can see it
+type persistentBackend struct {
+	*MemoryBackend
+	epochs *epochs
+}
+
+func newPersistentBackend(persist func() error) persistentBackend {
+	mb := NewMemoryBackend()
+	mb.persist = persist
+	return persistentBackend{MemoryBackend: mb, epochs: &epochs{}}
+}
+
+// ? Run a statement that changes something, in an epoch as it may read rows
+// ? kept out of memory
+func (pb *persistentBackend) exec(run func() error) error {
+	defer pb.epochs.leave(pb.epochs.enter())
+	return run()
+}
+
+func (pb *persistentBackend) CreateTable(stmt *ast.CreateTableStatement) error {
+	return pb.exec(func() error { return pb.MemoryBackend.CreateTable(stmt) })
+}
+
+func (pb *persistentBackend) Insert(stmt *ast.InsertStatement) error {
+	return pb.exec(func() error { return pb.MemoryBackend.Insert(stmt) })
+}
+
+func (pb *persistentBackend) CreateView(stmt *ast.CreateViewStatement) error {
+	return pb.exec(func() error { return pb.MemoryBackend.CreateView(stmt) })
+}
+
+func (pb *persistentBackend) DropView(stmt *ast.DropViewStatement) error {
+	return pb.exec(func() error { return pb.MemoryBackend.DropView(stmt) })
+}
+
+func (pb *persistentBackend) RefreshView(stmt *ast.RefreshViewStatement) error {
+	return pb.exec(func() error { return pb.MemoryBackend.RefreshView(stmt) })
+}
+
+func (pb *persistentBackend) AlterTable(stmt *ast.AlterTableStatement) error {
+	return pb.exec(func() error { return pb.MemoryBackend.AlterTable(stmt) })
+}
+
+func (pb *persistentBackend) Select(stmt *ast.SelectStatement) (*Results, error) {
+	defer pb.epochs.leave(pb.epochs.enter())
+	return pb.MemoryBackend.Select(stmt)
+}
+
+func (pb *persistentBackend) Begin(stmt *ast.BeginStatement) (Transaction, error) {
+	epoch := pb.epochs.enter()
+	tx := pb.MemoryBackend.begin(stmt)
+	tx.onEnd = func() { pb.epochs.leave(epoch) }
+	return tx, nil
+}
@@ -0,0 +1,361 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+func compileComparison(op string, a, b *compiledExpression) (*compiledExpression, error) {
+	if _, ok := unifyTypes([]ColumnType{a.Type, b.Type}); !ok {
+		return nil, fmt.Errorf("%w: cannot compare %s with %s", ErrInvalidDataType, a.Type, b.Type)
+	}
+
+	return &compiledExpression{
+		Name: "?column?",
+		Type: BoolType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			left, err := a.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			right, err := b.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if left == nil || right == nil {
+				return nil, nil
+			}
+			return boolCell(compareWith(op, compareCells(left, a.Type, right, b.Type))), nil
+		},
+	}, nil
+}
+
+// ? Whether the result of compareCells satisfies a comparison operator
+func compareWith(op string, cmp int) bool {
+	switch lex.Symbol(op) {
+	case lex.EqualSymbol:
+		return cmp == 0
+	case lex.NotEqualSymbol, lex.BangEqualSymbol:
+		return cmp != 0
+	case lex.LessSymbol:
+		return cmp < 0
+	case lex.LessEqualSymbol:
+		return cmp <= 0
+	case lex.GreaterSymbol:
+		return cmp > 0
+	case lex.GreaterEqualSymbol:
+		return cmp >= 0
+	}
+	return false
+}
+
+// ? AND and OR with SQL three-valued logic, NULL stands for unknown
+func compileLogical(op string, a, b *compiledExpression) (*compiledExpression, error) {
+	if !isBoolOrNull(a.Type) || !isBoolOrNull(b.Type) {
+		return nil, fmt.Errorf("%w: operator %s expects bool operands, got %s and %s", ErrInvalidDataType, op, a.Type, b.Type)
+	}
+
+	// ? The value that decides the result on its own, false for AND and true for OR
+	decisive := op == string(lex.OrKeyword)
+
+	return &compiledExpression{
+		Name: "?column?",
+		Type: BoolType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			left, err := a.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if left != nil && left.AsBool() == decisive {
+				return left, nil
+			}
+			right, err := b.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if right != nil && right.AsBool() == decisive {
+				return right, nil
+			}
+			if left == nil || right == nil {
+				return nil, nil
+			}
+			return boolCell(!decisive), nil
+		},
+	}, nil
+}
+
+func compileNot(exp *compiledExpression) (*compiledExpression, error) {
+	if !isBoolOrNull(exp.Type) {
+		return nil, fmt.Errorf("%w: operator not expects a bool operand, got %s", ErrInvalidDataType, exp.Type)
+	}
+
+	return &compiledExpression{
+		Name: "?column?",
+		Type: BoolType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			cell, err := exp.eval(row)
+			if err != nil || cell == nil {
+				return nil, err
+			}
+			return boolCell(!cell.AsBool()), nil
+		},
+	}, nil
+}
+
+func isBoolOrNull(t ColumnType) bool {
+	return t == BoolType || t == NullType
+}
+
+// ? x IN (a, b) is true when x equals one of the values, and NULL instead of
+// ? false when x or one of the values is NULL. The values can also come from
+// ? a single column subquery.
+func (mb *MemoryBackend) compileIn(in *ast.InExpression, s *scope) (*compiledExpression, error) {
+	exp, err := mb.compileExpression(in.Exp, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []ColumnType
+	var candidates func(row []MemoryCell) ([]MemoryCell, error)
+	if in.Subquery != nil {
+		sub, err := mb.compileSingleColumnSubquery(in.Subquery, s)
+		if err != nil {
+			return nil, err
+		}
+		types = []ColumnType{sub.columns[0].Type}
+		candidates = func(row []MemoryCell) ([]MemoryCell, error) {
+			rows, err := sub.run(row)
+			if err != nil {
+				return nil, err
+			}
+			cells := make([]MemoryCell, len(rows))
+			for i, r := range rows {
+				cells[i] = r[0]
+			}
+			return cells, nil
+		}
+	} else {
+		var list []*compiledExpression
+		for _, item := range *in.List {
+			value, err := mb.compileExpression(item, s)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+			types = append(types, value.Type)
+		}
+		candidates = func(row []MemoryCell) ([]MemoryCell, error) {
+			cells := make([]MemoryCell, len(list))
+			for i, value := range list {
+				cell, err := value.eval(row)
+				if err != nil {
+					return nil, err
+				}
+				cells[i] = cell
+			}
+			return cells, nil
+		}
+	}
+
+	for _, t := range types {
+		if _, ok := unifyTypes([]ColumnType{exp.Type, t}); !ok {
+			return nil, fmt.Errorf("%w: cannot compare %s with %s in IN list", ErrInvalidDataType, exp.Type, t)
+		}
+	}
+	// ? Every subquery row has the type of its only column
+	typeOf := func(i int) ColumnType {
+		if in.Subquery != nil {
+			return types[0]
+		}
+		return types[i]
+	}
+
+	result := &compiledExpression{
+		Name: "?column?",
+		Type: BoolType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			cell, err := exp.eval(row)
+			if err != nil || cell == nil {
+				return nil, err
+			}
+			values, err := candidates(row)
+			if err != nil {
+				return nil, err
+			}
+
+			sawNull := false
+			for i, candidate := range values {
+				if candidate == nil {
+					sawNull = true
+					continue
+				}
+				if compareCells(cell, exp.Type, candidate, typeOf(i)) == 0 {
+					return boolCell(true), nil
+				}
+			}
+			if sawNull {
+				return nil, nil
+			}
+			return boolCell(false), nil
+		},
+	}
+
+	if in.Not {
+		return compileNot(result)
+	}
+	return result, nil
+}
+
+// ? x BETWEEN a AND b is x >= a AND x <= b
+func (mb *MemoryBackend) compileBetween(between *ast.BetweenExpression, s *scope) (*compiledExpression, error) {
+	exp, err := mb.compileExpression(between.Exp, s)
+	if err != nil {
+		return nil, err
+	}
+	low, err := mb.compileExpression(between.Low, s)
+	if err != nil {
+		return nil, err
+	}
+	high, err := mb.compileExpression(between.High, s)
+	if err != nil {
+		return nil, err
+	}
+
+	aboveLow, err := compileComparison(string(lex.GreaterEqualSymbol), exp, low)
+	if err != nil {
+		return nil, err
+	}
+	belowHigh, err := compileComparison(string(lex.LessEqualSymbol), exp, high)
+	if err != nil {
+		return nil, err
+	}
+	result, err := compileLogical(string(lex.AndKeyword), aboveLow, belowHigh)
+	if err != nil {
+		return nil, err
+	}
+
+	if between.Not {
+		return compileNot(result)
+	}
+	return result, nil
+}
+
+// ? LIKE patterns use % for any run of characters and _ for one character,
+// ? the escape character defaults to a backslash
+func (mb *MemoryBackend) compileLike(like *ast.LikeExpression, s *scope) (*compiledExpression, error) {
+	exp, err := mb.compileExpression(like.Exp, s)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := mb.compileExpression(like.Pattern, s)
+	if err != nil {
+		return nil, err
+	}
+	operands := []*compiledExpression{exp, pattern}
+
+	var escape *compiledExpression
+	if like.Escape != nil {
+		escape, err = mb.compileExpression(like.Escape, s)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, escape)
+	}
+
+	for _, operand := range operands {
+		if operand.Type != TextType && operand.Type != NullType {
+			return nil, fmt.Errorf("%w: LIKE expects text operands, got %s", ErrInvalidDataType, operand.Type)
+		}
+	}
+
+	result := &compiledExpression{
+		Name: "?column?",
+		Type: BoolType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			cells := make([]MemoryCell, len(operands))
+			for i, operand := range operands {
+				cell, err := operand.eval(row)
+				if err != nil || cell == nil {
+					return nil, err
+				}
+				cells[i] = cell
+			}
+
+			escapeRune := '\\'
+			if escape != nil {
+				text := cells[2].AsText()
+				if utf8.RuneCountInString(text) != 1 {
+					return nil, fmt.Errorf("%w: ESCAPE must be a single character, got '%s'", ErrInvalidArguments, text)
+				}
+				escapeRune, _ = utf8.DecodeRuneInString(text)
+			}
+
+			value, patternText := cells[0].AsText(), cells[1].AsText()
+			if like.CaseInsensitive {
+				value, patternText = strings.ToLower(value), strings.ToLower(patternText)
+			}
+			matched, err := matchLike([]rune(value), []rune(patternText), escapeRune)
+			if err != nil {
+				return nil, err
+			}
+			return boolCell(matched), nil
+		},
+	}
+
+	if like.Not {
+		return compileNot(result)
+	}
+	return result, nil
+}
+
+// ? One element of a LIKE pattern
+type likeToken struct {
+	wildcard rune
+	literal  rune
+}
+
+func matchLike(value []rune, pattern []rune, escape rune) (bool, error) {
+	var tokens []likeToken
+	for i := 0; i < len(pattern); i++ {
+		r := pattern[i]
+		switch {
+		case r == escape:
+			if i+1 == len(pattern) {
+				return false, fmt.Errorf("%w: LIKE pattern must not end with the escape character", ErrInvalidArguments)
+			}
+			i++
+			tokens = append(tokens, likeToken{literal: pattern[i]})
+		case r == '%' || r == '_':
+			tokens = append(tokens, likeToken{wildcard: r})
+		default:
+			tokens = append(tokens, likeToken{literal: r})
+		}
+	}
+
+	// ? Greedy matching that backtracks to the last % seen
+	v, t := 0, 0
+	star, starValue := -1, 0
+	for v < len(value) {
+		switch {
+		case t < len(tokens) && tokens[t].wildcard == '%':
+			star, starValue = t, v
+			t++
+		case t < len(tokens) && (tokens[t].wildcard == '_' || (tokens[t].wildcard == 0 && tokens[t].literal == value[v])):
+			v++
+			t++
+		case star >= 0:
+			starValue++
+			v, t = starValue, star+1
+		default:
+			return false, nil
+		}
+	}
+	for t < len(tokens) && tokens[t].wildcard == '%' {
+		t++
+	}
+	return t == len(tokens), nil
+}
@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"math"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? Every table has a hidden bigint column with the id of each row, unless
+// ? it has a column of that name. * leaves it out.
+const rowIDColumn = "rowid"
+
+// ? The row with its id as the last cell
+func withRowID(id uint64, row []MemoryCell) []MemoryCell {
+	return append(row[:len(row):len(row)], bigIntCell(int64(id)))
+}
+
+// ? Bounds on the row ids a WHERE clause can match, so a select only reads
+// ? the rows between them instead of every row of the table
+type idRange struct {
+	// ? Columns of the rows of the table, the bounds are evaluated with NULLs
+	// ? in their place
+	local int
+	// ? Each is a lower bound on the ids, plus 1 when it is excluded
+	from []idBound
+	// ? Each is an upper bound on the ids, plus 1 when it is included
+	to []idBound
+}
+
+type idBound struct {
+	exp  *compiledExpression
+	plus int64
+}
+
+// ? The bounds found in the conditions ANDed together in where that compare
+// ? the rowid column at index to values that do not depend on the row, such
+// ? as constants and columns of enclosing selects. nil when there are none.
+func (mb *MemoryBackend) compileIDRange(where *ast.Expression, s *scope, index, local int) *idRange {
+	r := &idRange{local: local}
+	var visit func(exp *ast.Expression)
+	visit = func(exp *ast.Expression) {
+		isRowID := func(exp *ast.Expression) bool {
+			if exp.Kind != ast.LiteralKind || exp.Literal.Kind != lex.IdentifierKind {
+				return false
+			}
+			i, err := s.lookup(exp.Qualifier, exp.Literal.Value)
+			return err == nil && i == index
+		}
+		// ? Values the rowid is compared to are evaluated once per run, they
+		// ? can not refer to the row
+		value := func(exp *ast.Expression) *compiledExpression {
+			usesRow := false
+			check := func(index int) {
+				if index < local {
+					usesRow = true
+				}
+			}
+			compiled, err := mb.compileExpression(exp, &scope{
+				columns:        s.columns,
+				tables:         s.tables,
+				types:          s.types,
+				commonTables:   s.commonTables,
+				reference:      check,
+				outerReference: check,
+			})
+			if err != nil || usesRow || !isNumericOrNull(compiled.Type) {
+				return nil
+			}
+			return compiled
+		}
+
+		switch exp.Kind {
+		case ast.BinaryKind:
+			op := exp.Binary.Op.Value
+			if op == string(lex.AndKeyword) {
+				visit(exp.Binary.A)
+				visit(exp.Binary.B)
+				return
+			}
+			a, b := exp.Binary.A, exp.Binary.B
+			if !isRowID(a) {
+				// ? value < rowid is rowid > value
+				a, b = b, a
+				switch op {
+				case string(lex.LessSymbol):
+					op = string(lex.GreaterSymbol)
+				case string(lex.LessEqualSymbol):
+					op = string(lex.GreaterEqualSymbol)
+				case string(lex.GreaterSymbol):
+					op = string(lex.LessSymbol)
+				case string(lex.GreaterEqualSymbol):
+					op = string(lex.LessEqualSymbol)
+				}
+			}
+			if !isRowID(a) {
+				return
+			}
+			v := value(b)
+			if v == nil {
+				return
+			}
+			switch op {
+			case string(lex.EqualSymbol):
+				r.from = append(r.from, idBound{v, 0})
+				r.to = append(r.to, idBound{v, 1})
+			case string(lex.GreaterSymbol):
+				r.from = append(r.from, idBound{v, 1})
+			case string(lex.GreaterEqualSymbol):
+				r.from = append(r.from, idBound{v, 0})
+			case string(lex.LessSymbol):
+				r.to = append(r.to, idBound{v, 0})
+			case string(lex.LessEqualSymbol):
+				r.to = append(r.to, idBound{v, 1})
+			}
+		case ast.BetweenKind:
+			between := exp.Between
+			if between.Not || !isRowID(between.Exp) {
+				return
+			}
+			if low := value(between.Low); low != nil {
+				r.from = append(r.from, idBound{low, 0})
+			}
+			if high := value(between.High); high != nil {
+				r.to = append(r.to, idBound{high, 1})
+			}
+		}
+	}
+	visit(where)
+
+	if len(r.from) == 0 && len(r.to) == 0 {
+		return nil
+	}
+	return r
+}
+
+// ? The ids from from up to to. A NULL bound matches no rows, so neither
+// ? does the range.
+func (r *idRange) eval(outer []MemoryCell) (uint64, uint64, error) {
+	row := append(make([]MemoryCell, r.local), outer...)
+	var from, to uint64 = 0, math.MaxUint64
+	for _, bound := range r.from {
+		cell, err := bound.exp.eval(row)
+		if err != nil {
+			return 0, 0, err
+		}
+		if cell == nil {
+			return 0, 0, nil
+		}
+		v := cell.AsBigInt()
+		if v < 0 {
+			continue
+		}
+		if id := uint64(v) + uint64(bound.plus); id > from {
+			from = id
+		}
+	}
+	for _, bound := range r.to {
+		cell, err := bound.exp.eval(row)
+		if err != nil {
+			return 0, 0, err
+		}
+		if cell == nil {
+			return 0, 0, nil
+		}
+		v := cell.AsBigInt()
+		if v < 0 || v+bound.plus == 0 {
+			return 0, 0, nil
+		}
+		if id := uint64(v) + uint64(bound.plus); id < to {
+			to = id
+		}
+	}
+	return from, to, nil
+}
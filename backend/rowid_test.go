@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ? Selects bounded by rowid see the same rows as those that filter on a
+// ? column holding the same numbers, wherever the rows are kept
+func TestRowIDRanges(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := OpenDiskBackend(filepath.Join(dir, "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	lsm, err := OpenLSMBackend(filepath.Join(dir, "lsm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lsm.Close()
+
+	for _, test := range []struct {
+		name string
+		e    Executor
+		// ? Called between batches of rows, to move them out of memory
+		checkpoint func() error
+	}{
+		{"memory", NewMemoryBackend(), func() error { return nil }},
+		{"disk", disk, disk.Checkpoint},
+		{"lsm", lsm, func() error { return nil }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mustExecute(t, test.e, "CREATE TABLE t (n BIGINT, s TEXT);")
+			// ? Segments of 150, 150 and then rows only in memory
+			for i := 0; i < 400; i++ {
+				if i == 150 || i == 300 {
+					if err := test.checkpoint(); err != nil {
+						t.Fatal(err)
+					}
+				}
+				mustExecute(t, test.e, fmt.Sprintf("INSERT INTO t VALUES (%d, 'row %d');", i, i))
+			}
+
+			for _, bounds := range []string{
+				"= 0", "= 149", "= 150", "= 399", "= 400", "= -1", "= NULL",
+				"> 140 AND %s < 160", ">= 299 AND %s <= 301", "< 10", "> 390",
+				"BETWEEN 100 AND 350", "BETWEEN 350 AND 100", "> 0 AND %s > 200 AND %s < 250",
+				"<= 9223372036854775807", ">= -5 AND %s < 3",
+			} {
+				cond := func(column string) string {
+					return column + " " + strings.ReplaceAll(bounds, "%s", column)
+				}
+				sql := "SELECT count(*), sum(n), min(s) FROM t WHERE %s;"
+				want, err := execute(test.e, fmt.Sprintf(sql, cond("n")))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := execute(test.e, fmt.Sprintf(sql, cond("rowid")))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := range want.Rows[0] {
+					if string(got.Rows[0][i].(MemoryCell)) != string(want.Rows[0][i].(MemoryCell)) {
+						t.Errorf("rowid %s: got %v, want %v", bounds, got.Rows[0], want.Rows[0])
+						break
+					}
+				}
+			}
+
+			// ? Bounds can come from an enclosing select
+			n, err := count(test.e, "SELECT count(*) FROM t WHERE (SELECT count(*) FROM t u WHERE u.rowid = t.rowid + 1) = 0;")
+			if err != nil || n != 1 {
+				t.Errorf("got %d rows without a next one, want 1: %v", n, err)
+			}
+			results, err := execute(test.e, "SELECT * FROM t WHERE rowid = 7;")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results.Columns) != 2 || len(results.Rows) != 1 || results.Rows[0][0].AsBigInt() != 7 {
+				t.Errorf("got %d columns and %d rows, want the 2 columns of row 7", len(results.Columns), len(results.Rows))
+			}
+		})
+	}
+}
+
+// ? A DiskBackend finds the page a row written by a checkpoint starts in,
+// ? without reading the pages of its segment before it
+func TestRowIDSeeksStoredRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDiskBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustExecute(t, db, "CREATE TABLE t (n BIGINT, s TEXT);")
+	tx := begin(t, db.MemoryBackend)
+	var inserts strings.Builder
+	for i := 0; i < 3000; i++ {
+		// ? Some rows span pages that no row starts in
+		s := strings.Repeat("x", 100)
+		if i%1000 == 500 {
+			s = strings.Repeat("y", 3*pageSize)
+		}
+		fmt.Fprintf(&inserts, "INSERT INTO t VALUES (%d, '%s');", i, s)
+	}
+	mustExecute(t, tx, inserts.String())
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// ? Opened again, the rows are only in the file
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = OpenDiskBackend(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if pages := len(db.stored["t"].rows.segments[0].pages); pages < 80 {
+		t.Fatalf("got a segment of %d pages, want rows over more than 80", pages)
+	}
+
+	for _, row := range []int64{0, 499, 500, 501, 1234, 2500, 2999} {
+		before := db.CacheStats()
+		results, err := execute(db, fmt.Sprintf("SELECT n, length(s) FROM t WHERE rowid = %d;", row))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results.Rows) != 1 || results.Rows[0][0].AsBigInt() != row {
+			t.Fatalf("rowid %d: got %d rows, want row %d", row, len(results.Rows), row)
+		}
+		after := db.CacheStats()
+		if pinned := after.Hits + after.Misses - before.Hits - before.Misses; pinned > 5 {
+			t.Errorf("rowid %d: %d pages were read, want those of the row", row, pinned)
+		}
+	}
+}
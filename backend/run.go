@@ -0,0 +1,383 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	runMagic     = "gosqlrun"
+	runBlockSize = 4096
+	// ? Offset and size of the index, size of the bloom filter after it,
+	// ? checksum of both and the magic
+	runFooterSize   = 8 + 8 + 8 + 4 + 8
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+)
+
+type lsmEntry struct {
+	key   []byte
+	value []byte
+	// ? Set for deletes, which hide the key in older runs until a compaction
+	// ? that reaches the oldest run drops them
+	deleted bool
+}
+
+// ? An immutable file of entries sorted by key, written by a flush of the
+// ? memtable or by a compaction. Entries are grouped in blocks of about
+// ? 4 KiB read when needed, the index of the blocks and a bloom filter of
+// ? the keys of the entries and their filter keys are kept in memory.
+type sortedRun struct {
+	number uint64
+	level  int
+	file   *os.File
+	size   int64
+	blocks []runBlock
+	last   []byte
+	bloom  bloomFilter
+	// ? Guarded by the lsmTree. Scans reading the run and whether a
+	// ? compaction replaced it, once both are over its file is removed.
+	refs     int
+	obsolete bool
+}
+
+type runBlock struct {
+	first  []byte
+	offset int64
+	size   int
+	crc    uint32
+}
+
+// ? Write the entries next returns to a new run at path
+func writeRun(path string, number uint64, level int, next func() (*lsmEntry, error)) (*sortedRun, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &runWriter{w: bufio.NewWriter(file)}
+	for err == nil {
+		var entry *lsmEntry
+		if entry, err = next(); entry == nil {
+			break
+		}
+		err = w.add(entry)
+	}
+	if err == nil {
+		err = w.finish()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	file.Close()
+	return openRun(path, number, level)
+}
+
+type runWriter struct {
+	w      *bufio.Writer
+	offset int64
+	block  bytes.Buffer
+	first  []byte
+	blocks []runBlock
+	last   []byte
+	// ? Hashes of the keys, and of their filter keys, each once for keys
+	// ? that follow each other
+	hashes []uint64
+	filter []byte
+}
+
+func (w *runWriter) add(entry *lsmEntry) error {
+	if w.block.Len() == 0 {
+		w.first = entry.key
+	}
+	putBytes(&w.block, entry.key)
+	if entry.deleted {
+		w.block.WriteByte(1)
+	} else {
+		w.block.WriteByte(0)
+		putBytes(&w.block, entry.value)
+	}
+	w.last = entry.key
+
+	filter := filterKey(entry.key)
+	if w.hashes == nil || !bytes.Equal(filter, w.filter) {
+		w.hashes = append(w.hashes, bloomHash(filter))
+		w.filter = filter
+	}
+	if !bytes.Equal(filter, entry.key) {
+		w.hashes = append(w.hashes, bloomHash(entry.key))
+	}
+	if w.block.Len() >= runBlockSize {
+		return w.finishBlock()
+	}
+	return nil
+}
+
+func (w *runWriter) finishBlock() error {
+	if w.block.Len() == 0 {
+		return nil
+	}
+	w.blocks = append(w.blocks, runBlock{
+		first:  w.first,
+		offset: w.offset,
+		size:   w.block.Len(),
+		crc:    crc32.ChecksumIEEE(w.block.Bytes()),
+	})
+	if _, err := w.w.Write(w.block.Bytes()); err != nil {
+		return err
+	}
+	w.offset += int64(w.block.Len())
+	w.block.Reset()
+	return nil
+}
+
+// ? The blocks are followed by the index, the bloom filter and the footer
+func (w *runWriter) finish() error {
+	if err := w.finishBlock(); err != nil {
+		return err
+	}
+
+	var index bytes.Buffer
+	putUvarint(&index, uint64(len(w.blocks)))
+	for _, block := range w.blocks {
+		putBytes(&index, block.first)
+		putUvarint(&index, uint64(block.offset))
+		putUvarint(&index, uint64(block.size))
+		putUvarint(&index, uint64(block.crc))
+	}
+	putBytes(&index, w.last)
+	bloom := newBloomFilter(w.hashes).encode()
+
+	footer := make([]byte, runFooterSize)
+	binary.BigEndian.PutUint64(footer, uint64(w.offset))
+	binary.BigEndian.PutUint64(footer[8:], uint64(index.Len()))
+	binary.BigEndian.PutUint64(footer[16:], uint64(len(bloom)))
+	crc := crc32.ChecksumIEEE(index.Bytes())
+	binary.BigEndian.PutUint32(footer[24:], crc32.Update(crc, crc32.IEEETable, bloom))
+	copy(footer[28:], runMagic)
+	for _, b := range [][]byte{index.Bytes(), bloom, footer} {
+		if _, err := w.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+func openRun(path string, number uint64, level int) (*sortedRun, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	run, err := readRun(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w, in %s", err, path)
+	}
+	run.number, run.level = number, level
+	return run, nil
+}
+
+func readRun(file *os.File) (*sortedRun, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size < runFooterSize {
+		return nil, fmt.Errorf("%w: run is too short", ErrCorruptDatabase)
+	}
+	footer := make([]byte, runFooterSize)
+	if _, err = file.ReadAt(footer, size-runFooterSize); err != nil {
+		return nil, err
+	}
+	if string(footer[28:]) != runMagic {
+		return nil, fmt.Errorf("%w: not a run", ErrCorruptDatabase)
+	}
+	offset := binary.BigEndian.Uint64(footer)
+	indexSize := binary.BigEndian.Uint64(footer[8:])
+	bloomSize := binary.BigEndian.Uint64(footer[16:])
+	if offset+indexSize+bloomSize != uint64(size-runFooterSize) {
+		return nil, fmt.Errorf("%w: bad run footer", ErrCorruptDatabase)
+	}
+	data := make([]byte, indexSize+bloomSize)
+	if _, err = file.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(footer[24:]) {
+		return nil, fmt.Errorf("%w: bad run index checksum", ErrCorruptDatabase)
+	}
+
+	run := &sortedRun{file: file, size: size}
+	d := &decoder{r: bytes.NewReader(data[:indexSize])}
+	count := d.uvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		run.blocks = append(run.blocks, runBlock{
+			first:  d.bytes(),
+			offset: int64(d.uvarint()),
+			size:   int(d.uvarint()),
+			crc:    uint32(d.uvarint()),
+		})
+	}
+	run.last = d.bytes()
+	if err = d.finish(); err != nil {
+		return nil, err
+	}
+	if run.bloom, err = decodeBloomFilter(data[indexSize:]); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// ? Whether the run can have keys from start up to end that have filter as
+// ? their filter key, or are filter. A nil end has no bound.
+func (r *sortedRun) mayContain(start, end, filter []byte) bool {
+	if len(r.blocks) == 0 {
+		return false
+	}
+	if end != nil && bytes.Compare(r.blocks[0].first, end) >= 0 || bytes.Compare(r.last, start) < 0 {
+		return false
+	}
+	return filter == nil || r.bloom.mayContain(filter)
+}
+
+// ? An iterator over the entries from start up to end
+func (r *sortedRun) seek(start, end []byte) *runIterator {
+	block := sort.Search(len(r.blocks), func(i int) bool { return bytes.Compare(r.blocks[i].first, start) > 0 }) - 1
+	if block < 0 {
+		block = 0
+	}
+	return &runIterator{run: r, block: block, start: start, end: end, data: bytes.NewReader(nil)}
+}
+
+type runIterator struct {
+	run *sortedRun
+	// ? The next block to read
+	block      int
+	data       *bytes.Reader
+	start, end []byte
+	current    *lsmEntry
+	err        error
+}
+
+func (it *runIterator) next() bool {
+	for it.err == nil {
+		if it.data.Len() == 0 {
+			if it.block == len(it.run.blocks) {
+				return false
+			}
+			it.err = it.readBlock()
+			continue
+		}
+
+		d := &decoder{r: it.data}
+		entry := &lsmEntry{key: d.bytes(), deleted: d.byte() == 1}
+		if !entry.deleted {
+			entry.value = d.bytes()
+		}
+		if d.err != nil {
+			it.err = fmt.Errorf("%w: %s", ErrCorruptDatabase, d.err)
+			return false
+		}
+		if bytes.Compare(entry.key, it.start) < 0 {
+			continue
+		}
+		if it.end != nil && bytes.Compare(entry.key, it.end) >= 0 {
+			it.block = len(it.run.blocks)
+			it.data.Reset(nil)
+			return false
+		}
+		it.current = entry
+		return true
+	}
+	return false
+}
+
+func (it *runIterator) readBlock() error {
+	block := it.run.blocks[it.block]
+	it.block++
+	data := make([]byte, block.size)
+	if _, err := it.run.file.ReadAt(data, block.offset); err != nil && err != io.EOF {
+		return err
+	}
+	if crc32.ChecksumIEEE(data) != block.crc {
+		return fmt.Errorf("%w: bad block checksum in run %d", ErrCorruptDatabase, it.run.number)
+	}
+	it.data.Reset(data)
+	return nil
+}
+
+func (it *runIterator) entry() *lsmEntry {
+	return it.current
+}
+
+func (it *runIterator) error() error {
+	return it.err
+}
+
+// ? A set of keys that can tell for sure that a key is not in it, with about
+// ? 1% of false positives at 10 bits per key
+type bloomFilter struct {
+	bits   []byte
+	hashes uint8
+}
+
+func newBloomFilter(hashes []uint64) bloomFilter {
+	size := (len(hashes)*bloomBitsPerKey + 7) / 8
+	if size < 8 {
+		size = 8
+	}
+	bf := bloomFilter{bits: make([]byte, size), hashes: bloomHashes}
+	for _, h := range hashes {
+		bf.probe(h, func(bit uint32) bool {
+			bf.bits[bit/8] |= 1 << (bit % 8)
+			return true
+		})
+	}
+	return bf
+}
+
+// ? The bits of a hash, derived from its two halves
+func (bf bloomFilter) probe(h uint64, fn func(bit uint32) bool) bool {
+	m := uint32(len(bf.bits) * 8)
+	h1, h2 := uint32(h), uint32(h>>32)
+	for i := uint32(0); i < uint32(bf.hashes); i++ {
+		if !fn((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (bf bloomFilter) mayContain(key []byte) bool {
+	return bf.probe(bloomHash(key), func(bit uint32) bool {
+		return bf.bits[bit/8]&(1<<(bit%8)) != 0
+	})
+}
+
+func bloomHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+func (bf bloomFilter) encode() []byte {
+	return append([]byte{bf.hashes}, bf.bits...)
+}
+
+func decodeBloomFilter(data []byte) (bloomFilter, error) {
+	if len(data) < 2 || data[0] == 0 {
+		return bloomFilter{}, fmt.Errorf("%w: bad bloom filter", ErrCorruptDatabase)
+	}
+	return bloomFilter{bits: data[1:], hashes: data[0]}, nil
+}
@@ -0,0 +1,545 @@
+package backend
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+// ? A select compiled against the scope it is nested in, run takes the row
+// ? of that scope, nil at the top level
+type compiledSelect struct {
+	columns []ResultColumn
+	run     func(outer []MemoryCell) ([][]MemoryCell, error)
+}
+
+// ? Where the rows of a select come from
+type source struct {
+	columns []string
+	tables  []string
+	types   []ColumnType
+	// ? Calls fn with each row in turn, stopping at the first error
+	rows func(outer []MemoryCell, fn func(row []MemoryCell) error) error
+	// ? Set for tables, whose last column is the hidden rowid: calls fn with
+	// ? the rows whose ids are from from up to to
+	scan func(from, to uint64, fn func(row []MemoryCell) error) error
+	// ? Trailing columns * leaves out
+	hidden int
+}
+
+func (mb *MemoryBackend) compileSource(from *ast.FromItem, outer *scope) (*source, error) {
+	// ? Without FROM a select runs once over an empty row
+	if from == nil {
+		return &source{
+			rows: func(outer []MemoryCell, fn func(row []MemoryCell) error) error {
+				return fn([]MemoryCell{})
+			},
+		}, nil
+	}
+
+	src := &source{}
+	var name string
+	switch from.Kind {
+	case ast.TableFromKind:
+		name = from.Table.Value
+		if ct, ok := outer.commonTables[name]; ok {
+			ct.referenced = true
+			src.columns = ct.columns
+			src.types = ct.types
+			src.rows = func(outer []MemoryCell, fn func(row []MemoryCell) error) error {
+				return eachRow(ct.rows, fn)
+			}
+			break
+		}
+
+		if mb.reads != nil {
+			mb.reads[name] = true
+		}
+		if view, ok := mb.Views[name]; ok && !view.Materialized {
+			viewSource, err := mb.compileViewSource(name, view)
+			if err != nil {
+				return nil, err
+			}
+			src = viewSource
+			break
+		}
+
+		table, ok := mb.Tables[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTableDoesNotExist, name)
+		}
+		src.columns = table.Columns
+		src.types = table.ColumnTypes
+		src.rows = func(outer []MemoryCell, fn func(row []MemoryCell) error) error {
+			return table.each(fn)
+		}
+		if columnIndex(table, rowIDColumn) >= 0 {
+			break
+		}
+		src.columns = append(append([]string{}, table.Columns...), rowIDColumn)
+		src.types = append(append([]ColumnType{}, table.ColumnTypes...), BigIntType)
+		src.hidden = 1
+		src.scan = func(from, to uint64, fn func(row []MemoryCell) error) error {
+			return table.scan(from, to, func(id uint64, row []MemoryCell) error {
+				return fn(withRowID(id, row))
+			})
+		}
+		src.rows = func(outer []MemoryCell, fn func(row []MemoryCell) error) error {
+			return src.scan(0, math.MaxUint64, fn)
+		}
+	case ast.SubqueryFromKind:
+		sub, err := mb.compileSelect(from.Subquery, outer)
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range sub.columns {
+			src.columns = append(src.columns, col.Name)
+			src.types = append(src.types, col.Type)
+		}
+		src.rows = func(outer []MemoryCell, fn func(row []MemoryCell) error) error {
+			rows, err := sub.run(outer)
+			if err != nil {
+				return err
+			}
+			return eachRow(rows, fn)
+		}
+	default:
+		return nil, ErrInvalidSelectItem
+	}
+
+	if from.Alias != nil {
+		name = from.Alias.Value
+	}
+	for range src.columns {
+		src.tables = append(src.tables, name)
+	}
+	return src, nil
+}
+
+func (mb *MemoryBackend) compileSelect(stmt *ast.SelectStatement, outer *scope) (*compiledSelect, error) {
+	if stmt.With != nil {
+		return mb.compileWith(stmt, outer)
+	}
+
+	if stmt.SetOperations == nil {
+		slct, err := mb.compileSelectCore(stmt, outer, stmt.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		return mb.compileLimit(stmt, outer, slct)
+	}
+
+	slct, err := mb.compileSelectCore(stmt, outer, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, operation := range *stmt.SetOperations {
+		right, err := mb.compileSelect(operation.Select, outer)
+		if err != nil {
+			return nil, err
+		}
+		slct, err = compileSetOperation(operation, slct, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slct, err = mb.compileResultOrderBy(stmt.OrderBy, slct)
+	if err != nil {
+		return nil, err
+	}
+	return mb.compileLimit(stmt, outer, slct)
+}
+
+// ? A single SELECT without set operations or LIMIT, ORDER BY can use any
+// ? expression over its rows
+func (mb *MemoryBackend) compileSelectCore(stmt *ast.SelectStatement, outer *scope, orderBy *[]*ast.OrderByItem) (*compiledSelect, error) {
+	src, err := mb.compileSource(stmt.From, outer)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregates []*aggregateCall
+	var windows []*windowCall
+	s := &scope{
+		columns:    append(append([]string{}, src.columns...), outer.columns...),
+		tables:     append(append([]string{}, src.tables...), outer.tables...),
+		types:      append(append([]ColumnType{}, src.types...), outer.types...),
+		aggregates: &aggregates,
+		windows:    &windows,
+		// ? WITH tables stay visible in nested selects
+		commonTables: outer.commonTables,
+	}
+	local := len(src.columns)
+	outerWidth := len(outer.columns)
+
+	var keys []*compiledExpression
+	// ? Columns grouped on, and the first other column used outside of an
+	// ? aggregate, which is an error if the select turns out to be grouped
+	groupedColumns := make(map[int]bool)
+	ungrouped := -1
+	if outer.reference != nil {
+		s.outerReference = func(index int) {
+			if index >= local {
+				outer.reference(index - local)
+			}
+		}
+	}
+	s.reference = func(index int) {
+		if index < local {
+			if !groupedColumns[index] && ungrouped < 0 {
+				ungrouped = index
+			}
+		} else if s.outerReference != nil {
+			s.outerReference(index)
+		}
+	}
+	if stmt.GroupBy != nil {
+		for _, exp := range *stmt.GroupBy {
+			key, err := mb.compileExpression(exp, s.withoutAggregates())
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			s.groupBy = append(s.groupBy, exp)
+			if exp.Kind == ast.LiteralKind && exp.Literal.Kind == lex.IdentifierKind {
+				index, _ := s.lookup(exp.Qualifier, exp.Literal.Value)
+				groupedColumns[index] = true
+			}
+		}
+	}
+
+	var columns []ResultColumn
+	var items []*compiledExpression
+	for _, item := range *stmt.Items {
+		if item.Asterisk {
+			if stmt.From == nil {
+				return nil, fmt.Errorf("%w: * needs a FROM clause", ErrInvalidSelectItem)
+			}
+			for i := 0; i < local-src.hidden; i++ {
+				s.reference(i)
+				items = append(items, columnExpression(s, i))
+				columns = append(columns, ResultColumn{
+					Name: s.columns[i],
+					Type: s.types[i],
+				})
+			}
+			continue
+		}
+
+		exp, err := mb.compileExpression(item.Exp, s)
+		if err != nil {
+			return nil, err
+		}
+		name := exp.Name
+		if item.Alias != nil {
+			name = item.Alias.Value
+		}
+		items = append(items, exp)
+		columns = append(columns, ResultColumn{
+			Name: name,
+			Type: exp.Type,
+		})
+	}
+
+	var where *compiledExpression
+	var ids *idRange
+	if stmt.Where != nil {
+		where, err = mb.compileCondition(stmt.Where, s.withoutAggregates(), "WHERE")
+		if err != nil {
+			return nil, err
+		}
+		if src.scan != nil {
+			ids = mb.compileIDRange(stmt.Where, s, local-1, local)
+		}
+	}
+
+	var names []string
+	for _, col := range columns {
+		names = append(names, col.Name)
+	}
+	if stmt.Distinct {
+		if err := checkDistinctOrderBy(orderBy, *stmt.Items, s, local-src.hidden, names); err != nil {
+			return nil, err
+		}
+	}
+	ob, err := mb.compileOrderBy(orderBy, s, items, names)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := len(aggregates) > 0 || stmt.GroupBy != nil
+	if grouped && ungrouped >= 0 {
+		return nil, fmt.Errorf("%w: column %s must appear in GROUP BY or be used in an aggregate", ErrInvalidSelectItem, s.columns[ungrouped])
+	}
+	// ? Window results follow the aggregate results in each row
+	for i, w := range windows {
+		w.index = len(s.columns) + len(aggregates) + i
+	}
+	types := resultTypes(columns)
+
+	run := func(outerRow []MemoryCell) ([][]MemoryCell, error) {
+		// ? Rows of an enclosing grouped select carry aggregate results after its columns
+		outerRow = outerRow[:outerWidth]
+
+		var resultRows [][]MemoryCell
+		var sortKeys [][]MemoryCell
+		// ? With DISTINCT the first of equal rows is kept, along with its sort keys
+		seen := make(map[string]bool)
+		project := func(row []MemoryCell) error {
+			resultRow := make([]MemoryCell, len(items))
+			for i, item := range items {
+				cell, err := item.eval(row)
+				if err != nil {
+					return err
+				}
+				resultRow[i] = cell
+			}
+			if stmt.Distinct {
+				k := rowKey(resultRow, types)
+				if seen[k] {
+					return nil
+				}
+				seen[k] = true
+			}
+			resultRows = append(resultRows, resultRow)
+
+			if ob != nil {
+				rowKeys, err := ob.keys(row)
+				if err != nil {
+					return err
+				}
+				sortKeys = append(sortKeys, rowKeys)
+			}
+			return nil
+		}
+
+		// ? Rows are projected as they are read, unless they are grouped or
+		// ? windows need all of them first
+		var g *grouper
+		if grouped {
+			g = newGrouper(keys, aggregates)
+		}
+		var rows [][]MemoryCell
+		each := func(sourceRow []MemoryCell) error {
+			row := sourceRow
+			if outerWidth > 0 {
+				row = append(append(make([]MemoryCell, 0, local+outerWidth), sourceRow...), outerRow...)
+			}
+
+			if where != nil {
+				matched, err := where.eval(row)
+				if err != nil {
+					return err
+				}
+				if matched == nil || !matched.AsBool() {
+					return nil
+				}
+			}
+			switch {
+			case grouped:
+				return g.add(row)
+			case len(windows) > 0:
+				rows = append(rows, row)
+				return nil
+			}
+			return project(row)
+		}
+		// ? Bounds on the rowid in WHERE seek to the rows between them
+		var err error
+		if ids != nil {
+			var from, to uint64
+			from, to, err = ids.eval(outerRow)
+			if err == nil {
+				err = src.scan(from, to, each)
+			}
+		} else {
+			err = src.rows(outerRow, each)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if grouped {
+			emptyRow := append(make([]MemoryCell, local), outerRow...)
+			rows, err = g.rows(stmt.GroupBy != nil, emptyRow)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if grouped || len(windows) > 0 {
+			if len(windows) > 0 {
+				rows, err = applyWindows(rows, windows)
+				if err != nil {
+					return nil, err
+				}
+			}
+			for _, row := range rows {
+				if err := project(row); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if ob != nil {
+			ob.sort(resultRows, sortKeys)
+		}
+		return resultRows, nil
+	}
+
+	return &compiledSelect{
+		columns: columns,
+		run:     run,
+	}, nil
+}
+
+func eachRow(rows [][]MemoryCell, fn func(row []MemoryCell) error) error {
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func columnExpression(s *scope, index int) *compiledExpression {
+	return &compiledExpression{
+		Name: s.columns[index],
+		Type: s.types[index],
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			return row[index], nil
+		},
+	}
+}
+
+// ? A bool expression used to filter rows, clause names it in errors
+func (mb *MemoryBackend) compileCondition(exp *ast.Expression, s *scope, clause string) (*compiledExpression, error) {
+	condition, err := mb.compileExpression(exp, s)
+	if err != nil {
+		return nil, err
+	}
+	if !isBoolOrNull(condition.Type) {
+		return nil, fmt.Errorf("%w: %s expects a bool condition, got %s", ErrInvalidDataType, clause, condition.Type)
+	}
+	return condition, nil
+}
+
+// ? ORDER BY over the combined rows of set operations, it can only refer to
+// ? the result columns
+func (mb *MemoryBackend) compileResultOrderBy(orderBy *[]*ast.OrderByItem, slct *compiledSelect) (*compiledSelect, error) {
+	if orderBy == nil {
+		return slct, nil
+	}
+
+	s := &scope{}
+	for _, col := range slct.columns {
+		s.columns = append(s.columns, col.Name)
+		s.tables = append(s.tables, "")
+		s.types = append(s.types, col.Type)
+	}
+	var items []*compiledExpression
+	for i := range slct.columns {
+		items = append(items, columnExpression(s, i))
+	}
+
+	ob, err := mb.compileOrderBy(orderBy, s, items, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compiledSelect{
+		columns: slct.columns,
+		run: func(outer []MemoryCell) ([][]MemoryCell, error) {
+			rows, err := slct.run(outer)
+			if err != nil {
+				return nil, err
+			}
+			var sortKeys [][]MemoryCell
+			for _, row := range rows {
+				rowKeys, err := ob.keys(row)
+				if err != nil {
+					return nil, err
+				}
+				sortKeys = append(sortKeys, rowKeys)
+			}
+			ob.sort(rows, sortKeys)
+			return rows, nil
+		},
+	}, nil
+}
+
+// ? LIMIT and OFFSET are evaluated once per run, they can refer to the
+// ? columns of an enclosing select but not to the rows being limited
+func (mb *MemoryBackend) compileLimit(stmt *ast.SelectStatement, outer *scope, slct *compiledSelect) (*compiledSelect, error) {
+	if stmt.Limit == nil && stmt.Offset == nil {
+		return slct, nil
+	}
+
+	compileCount := func(exp *ast.Expression, clause string) (*compiledExpression, error) {
+		if exp == nil {
+			return nil, nil
+		}
+		count, err := mb.compileExpression(exp, outer.withoutAggregates())
+		if err != nil {
+			return nil, err
+		}
+		if !isNumericOrNull(count.Type) {
+			return nil, fmt.Errorf("%w: %s expects an integer, got %s", ErrInvalidDataType, clause, count.Type)
+		}
+		return count, nil
+	}
+	limit, err := compileCount(stmt.Limit, "LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := compileCount(stmt.Offset, "OFFSET")
+	if err != nil {
+		return nil, err
+	}
+
+	// ? A NULL count is the same as leaving the clause out
+	evalCount := func(count *compiledExpression, clause string, outer []MemoryCell) (int64, bool, error) {
+		if count == nil {
+			return 0, false, nil
+		}
+		cell, err := count.eval(outer)
+		if err != nil || cell == nil {
+			return 0, false, err
+		}
+		n := cell.AsBigInt()
+		if n < 0 {
+			return 0, false, fmt.Errorf("%w: %s must not be negative", ErrInvalidExpression, clause)
+		}
+		return n, true, nil
+	}
+
+	return &compiledSelect{
+		columns: slct.columns,
+		run: func(outerRow []MemoryCell) ([][]MemoryCell, error) {
+			limitCount, hasLimit, err := evalCount(limit, "LIMIT", outerRow)
+			if err != nil {
+				return nil, err
+			}
+			offsetCount, _, err := evalCount(offset, "OFFSET", outerRow)
+			if err != nil {
+				return nil, err
+			}
+
+			rows, err := slct.run(outerRow)
+			if err != nil {
+				return nil, err
+			}
+			if offsetCount >= int64(len(rows)) {
+				return nil, nil
+			}
+			rows = rows[offsetCount:]
+			if hasLimit && limitCount < int64(len(rows)) {
+				rows = rows[:limitCount]
+			}
+			return rows, nil
+		},
+	}, nil
+}
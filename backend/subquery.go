@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? Compile a subquery that must return a single column, it sees the
+// ? columns of s and is run again for every row of s
+func (mb *MemoryBackend) compileSingleColumnSubquery(stmt *ast.SelectStatement, s *scope) (*compiledSelect, error) {
+	sub, err := mb.compileSelect(stmt, s)
+	if err != nil {
+		return nil, err
+	}
+	if len(sub.columns) != 1 {
+		return nil, fmt.Errorf("%w: subquery must return one column, got %d", ErrInvalidExpression, len(sub.columns))
+	}
+	return sub, nil
+}
+
+// ? (SELECT ...) as a value, NULL when there are no rows
+func (mb *MemoryBackend) compileScalarSubquery(stmt *ast.SelectStatement, s *scope) (*compiledExpression, error) {
+	sub, err := mb.compileSingleColumnSubquery(stmt, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compiledExpression{
+		Name: sub.columns[0].Name,
+		Type: sub.columns[0].Type,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			rows, err := sub.run(row)
+			if err != nil {
+				return nil, err
+			}
+			if len(rows) == 0 {
+				return nil, nil
+			}
+			if len(rows) > 1 {
+				return nil, ErrSubqueryMultipleRows
+			}
+			return rows[0][0], nil
+		},
+	}, nil
+}
+
+func (mb *MemoryBackend) compileExists(stmt *ast.SelectStatement, s *scope) (*compiledExpression, error) {
+	sub, err := mb.compileSelect(stmt, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compiledExpression{
+		Name: "exists",
+		Type: BoolType,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			rows, err := sub.run(row)
+			if err != nil {
+				return nil, err
+			}
+			return boolCell(len(rows) > 0), nil
+		},
+	}, nil
+}
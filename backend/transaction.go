@@ -0,0 +1,428 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? Tables and views at some point in time, the maps are not changed once
+// ? the catalog is taken
+type catalog struct {
+	tables map[string]*Table
+	views  map[string]*View
+}
+
+func takeCatalog(tables map[string]*Table, views map[string]*View) *catalog {
+	c := &catalog{
+		tables: make(map[string]*Table),
+		views:  make(map[string]*View),
+	}
+	for name, table := range tables {
+		c.tables[name] = table
+	}
+	for name, view := range views {
+		c.views[name] = view
+	}
+	return c
+}
+
+type savepoint struct {
+	name    string
+	catalog *catalog
+}
+
+// ? Runs statements on a copy of the backend. A failing statement leaves the
+// ? transaction as it was, since statements check everything before they
+// ? change anything. Safe for concurrent use, its statements run one at a time.
+type MemoryTransaction struct {
+	mu      sync.Mutex
+	backend *MemoryBackend
+	working *MemoryBackend
+	// ? Holds the locks taken by its statements until it ends
+	owner *lockOwner
+	// ? Innermost last. Tables are never changed in place, so the tables and
+	// ? views at a savepoint are all there is to undo.
+	savepoints []*savepoint
+	// ? Called once it ends
+	onEnd func()
+}
+
+// ? A copy of the backend over its tables and views as they are now. Tables
+// ? are never changed in place, so the copy keeps seeing them while the
+// ? backend moves on to newer versions.
+func (mb *MemoryBackend) snapshot() *MemoryBackend {
+	base := takeCatalog(mb.Tables, mb.Views)
+	return &MemoryBackend{
+		Tables:         base.tables,
+		Views:          base.views,
+		functions:      mb.functions,
+		aggregates:     mb.aggregates,
+		recursionLimit: mb.recursionLimit,
+		base:           base,
+	}
+}
+
+// ? The transaction reads and writes a snapshot, so it sees neither changes
+// ? committed after it began nor half of one. A serializable transaction also
+// ? remembers what it read, see Commit.
+func (mb *MemoryBackend) Begin(stmt *ast.BeginStatement) (Transaction, error) {
+	return mb.begin(stmt), nil
+}
+
+func (mb *MemoryBackend) begin(stmt *ast.BeginStatement) *MemoryTransaction {
+	mb.mu.RLock()
+	working := mb.snapshot()
+	mb.mu.RUnlock()
+
+	working.restore(working.base)
+	working.inserted = make(map[*Table]int)
+	if stmt.Isolation == ast.SerializableLevel {
+		working.reads = make(map[string]bool)
+	}
+	return &MemoryTransaction{
+		backend: mb,
+		working: working,
+		owner:   &lockOwner{},
+	}
+}
+
+// ? Apply the tables and views the transaction created, changed or removed,
+// ? all of them or none. The first transaction to commit a change to a table
+// ? or view wins, later ones fail with ErrSerializationFailure and are rolled
+// ? back. Rows that were only inserted do not conflict, they are added to the
+// ? table as it has been committed since.
+// ?
+// ? A serializable transaction that changed anything also fails when a table
+// ? or view it read was changed since it began, so it could have run all at
+// ? once when it commits. Without changes it could have run all at once when
+// ? it began, and always commits.
+func (tx *MemoryTransaction) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	working, base := tx.working, tx.working.base
+	defer tx.end()
+
+	tx.backend.mu.Lock()
+	defer tx.backend.mu.Unlock()
+	return tx.backend.change(func() error {
+		return merge(working, base, tx.backend)
+	})
+}
+
+// ? Apply what working changed since base to committed, see Commit
+func merge(working *MemoryBackend, base *catalog, committed *MemoryBackend) error {
+
+	tables := make(map[string]*Table)
+	var droppedTables []string
+	for name, table := range working.Tables {
+		if base.tables[name] == table {
+			continue
+		}
+		merged, err := working.mergeTable(name, table, committed.Tables[name])
+		if err != nil {
+			return err
+		}
+		tables[name] = merged
+	}
+	for name, table := range base.tables {
+		if _, ok := working.Tables[name]; ok {
+			continue
+		}
+		if committed.Tables[name] != table {
+			return fmt.Errorf("%w: table %s", ErrSerializationFailure, name)
+		}
+		droppedTables = append(droppedTables, name)
+	}
+
+	views := make(map[string]*View)
+	var droppedViews []string
+	for name, view := range working.Views {
+		if base.views[name] == view {
+			continue
+		}
+		if committed.Views[name] != base.views[name] {
+			return fmt.Errorf("%w: view %s", ErrSerializationFailure, name)
+		}
+		views[name] = view
+	}
+	for name, view := range base.views {
+		if _, ok := working.Views[name]; ok {
+			continue
+		}
+		if committed.Views[name] != view {
+			return fmt.Errorf("%w: view %s", ErrSerializationFailure, name)
+		}
+		droppedViews = append(droppedViews, name)
+	}
+
+	changed := len(tables) > 0 || len(droppedTables) > 0 || len(views) > 0 || len(droppedViews) > 0
+	if changed {
+		for name := range working.reads {
+			if committed.Tables[name] != base.tables[name] || committed.Views[name] != base.views[name] {
+				return fmt.Errorf("%w: %s changed after it was read", ErrSerializationFailure, name)
+			}
+		}
+	}
+
+	for name, table := range tables {
+		committed.Tables[name] = table
+	}
+	for _, name := range droppedTables {
+		delete(committed.Tables, name)
+	}
+	for name, view := range views {
+		committed.Views[name] = view
+	}
+	for _, name := range droppedViews {
+		delete(committed.Views, name)
+	}
+	return nil
+}
+
+// ? The version of table to commit, given the one committed since the
+// ? transaction began
+func (mb *MemoryBackend) mergeTable(name string, table, committed *Table) (*Table, error) {
+	found := mb.base.tables[name]
+	if committed == found {
+		return table, nil
+	}
+
+	inserted, ok := mb.inserted[table]
+	if !ok || found == nil || committed == nil || !sameColumns(found, committed) {
+		return nil, fmt.Errorf("%w: table %s", ErrSerializationFailure, name)
+	}
+	stored, rows := committed.storage()
+	table.rows.ascend(table.rows.next-uint64(inserted), func(id uint64, row []MemoryCell) bool {
+		rows = rows.append(row)
+		return true
+	})
+	return &Table{
+		Columns:     committed.Columns,
+		ColumnTypes: committed.ColumnTypes,
+		rows:        rows,
+		stored:      stored,
+	}, nil
+}
+
+func sameColumns(a, b *Table) bool {
+	if len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if a.Columns[i] != b.Columns[i] || a.ColumnTypes[i] != b.ColumnTypes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (tx *MemoryTransaction) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	tx.end()
+	return nil
+}
+
+func (tx *MemoryTransaction) end() {
+	tx.working = nil
+	tx.backend.locks.release(tx.owner)
+	if tx.onEnd != nil {
+		tx.onEnd()
+	}
+}
+
+// ? Take locks for a statement of the transaction. As the victim of a
+// ? deadlock it is rolled back, which lets the others go on.
+func (tx *MemoryTransaction) lock(mode lockMode, names ...string) error {
+	timeout := tx.backend.getLockTimeout()
+	for _, name := range names {
+		err := tx.backend.locks.acquire(tx.owner, name, mode, timeout)
+		if errors.Is(err, ErrDeadlock) {
+			tx.end()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ? A savepoint with the name of an earlier one hides it until released
+func (tx *MemoryTransaction) Savepoint(name string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	tx.savepoints = append(tx.savepoints, &savepoint{
+		name:    name,
+		catalog: takeCatalog(tx.working.Tables, tx.working.Views),
+	})
+	return nil
+}
+
+// ? Forget the savepoint and every savepoint made after it
+func (tx *MemoryTransaction) ReleaseSavepoint(name string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+// ? Undo everything done since the savepoint, which stays so it can be
+// ? rolled back to again. Savepoints made after it are forgotten.
+func (tx *MemoryTransaction) RollbackToSavepoint(name string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.working.restore(tx.savepoints[i].catalog)
+	tx.savepoints = tx.savepoints[:i+1]
+	return nil
+}
+
+func (tx *MemoryTransaction) findSavepoint(name string) (int, error) {
+	if tx.working == nil {
+		return 0, ErrTransactionDone
+	}
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrSavepointDoesNotExist, name)
+}
+
+// ? Run run, which changes the tables and views, with mu locked. When the
+// ? backend persists changes they are recorded before mu is unlocked, so no
+// ? one sees a change that is not durable. If recording fails the tables and
+// ? views are put back as they were.
+func (mb *MemoryBackend) change(run func() error) error {
+	if mb.persist == nil {
+		return run()
+	}
+	previous := takeCatalog(mb.Tables, mb.Views)
+	err := run()
+	if err == nil {
+		err = mb.persist()
+	}
+	if err != nil {
+		mb.restore(previous)
+	}
+	return err
+}
+
+// ? Replace the tables and views with copies of those in c
+func (mb *MemoryBackend) restore(c *catalog) {
+	copied := takeCatalog(c.tables, c.views)
+	mb.Tables = copied.tables
+	mb.Views = copied.views
+}
+
+func (tx *MemoryTransaction) CreateTable(stmt *ast.CreateTableStatement) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	if err := tx.lock(exclusiveLock, stmt.Name.Value); err != nil {
+		return err
+	}
+	return tx.working.createTable(stmt)
+}
+
+func (tx *MemoryTransaction) Insert(stmt *ast.InsertStatement) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	if err := tx.lock(rowExclusiveLock, stmt.Table.Value); err != nil {
+		return err
+	}
+	return tx.working.insert(stmt)
+}
+
+func (tx *MemoryTransaction) Select(stmt *ast.SelectStatement) (*Results, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return nil, ErrTransactionDone
+	}
+	return tx.working.query(stmt)
+}
+
+func (tx *MemoryTransaction) CreateView(stmt *ast.CreateViewStatement) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	if err := tx.lock(exclusiveLock, stmt.Name.Value); err != nil {
+		return err
+	}
+	return tx.working.createView(stmt)
+}
+
+func (tx *MemoryTransaction) DropView(stmt *ast.DropViewStatement) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	if err := tx.lock(exclusiveLock, stmt.Name.Value); err != nil {
+		return err
+	}
+	return tx.working.dropView(stmt)
+}
+
+func (tx *MemoryTransaction) RefreshView(stmt *ast.RefreshViewStatement) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	if err := tx.lock(exclusiveLock, stmt.Name.Value); err != nil {
+		return err
+	}
+	return tx.working.refreshView(stmt)
+}
+
+func (tx *MemoryTransaction) AlterTable(stmt *ast.AlterTableStatement) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.working == nil {
+		return ErrTransactionDone
+	}
+	if err := tx.lock(exclusiveLock, alterTableLocks(stmt)...); err != nil {
+		return err
+	}
+	return tx.working.alterTable(stmt)
+}
@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? Two transactions each read the table the other writes. Both commit under
+// ? snapshot isolation, though no order of running them one at a time gives
+// ? that result. When serializable, the second to commit fails.
+func TestSerializableWriteSkew(t *testing.T) {
+	for _, test := range []struct {
+		isolation ast.IsolationLevel
+		committed int64
+	}{
+		{ast.RepeatableReadLevel, 2},
+		{ast.SerializableLevel, 1},
+	} {
+		mb := NewMemoryBackend()
+		mustExecute(t, mb, "CREATE TABLE a (n INT); CREATE TABLE b (n INT);")
+
+		first, err := mb.Begin(&ast.BeginStatement{Isolation: test.isolation})
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := mb.Begin(&ast.BeginStatement{Isolation: test.isolation})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// ? Each adds a row to the other table when its own is empty
+		mustExecute(t, first, "SELECT count(*) FROM a; INSERT INTO b VALUES (1);")
+		mustExecute(t, second, "SELECT count(*) FROM b; INSERT INTO a VALUES (1);")
+
+		if err := first.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		err = second.Commit()
+		if test.isolation == ast.SerializableLevel && !errors.Is(err, ErrSerializationFailure) {
+			t.Errorf("got %v, want ErrSerializationFailure", err)
+		} else if test.isolation != ast.SerializableLevel && err != nil {
+			t.Error(err)
+		}
+
+		n, err := count(mb, "SELECT (SELECT count(*) FROM a) + (SELECT count(*) FROM b);")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != test.committed {
+			t.Errorf("isolation %d: got %d rows, want %d", test.isolation, n, test.committed)
+		}
+	}
+}
+
+// ? A transaction that only reads keeps seeing the tables as they were when
+// ? it began, while another transaction changes several of them and commits
+func TestSnapshotOutlivesConcurrentCommit(t *testing.T) {
+	mb := NewMemoryBackend()
+	mustExecute(t, mb, "CREATE TABLE a (n INT); CREATE TABLE b (n INT); INSERT INTO a VALUES (1); INSERT INTO b VALUES (1);")
+	const sum = "SELECT (SELECT count(*) FROM a) * 10 + (SELECT count(*) FROM b);"
+
+	reader, err := mb.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := count(reader, sum); err != nil || n != 11 {
+		t.Fatalf("got %d, want 11: %v", n, err)
+	}
+
+	writer, err := mb.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, writer, "INSERT INTO a VALUES (2);")
+	if n, err := count(reader, sum); err != nil || n != 11 {
+		t.Fatalf("got %d while the writer runs, want 11: %v", n, err)
+	}
+	mustExecute(t, writer, "INSERT INTO b VALUES (2); ALTER TABLE b ADD COLUMN m INT;")
+	if err := writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// ? Neither half of the commit, nor the new column
+	if n, err := count(reader, sum); err != nil || n != 11 {
+		t.Fatalf("got %d after the writer committed, want 11: %v", n, err)
+	}
+	results, err := execute(reader, "SELECT * FROM b;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Columns) != 1 {
+		t.Errorf("got %d columns, want the 1 b had when the reader began", len(results.Columns))
+	}
+	if err := reader.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := count(mb, sum); err != nil || n != 22 {
+		t.Fatalf("got %d after the reader ended, want 22: %v", n, err)
+	}
+}
+
+// ? Of two transactions rewriting a table, the second to commit fails, even
+// ? when it waited for the first to commit before rewriting it
+func TestConcurrentRewritesConflict(t *testing.T) {
+	mb := NewMemoryBackend()
+	mustExecute(t, mb, "CREATE TABLE t (n INT); INSERT INTO t VALUES (1);")
+
+	first, err := mb.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mb.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, first, "ALTER TABLE t ADD COLUMN a INT;")
+
+	// ? Waits for the lock first holds until it commits
+	altered := make(chan error)
+	go func() {
+		_, err := execute(second, "ALTER TABLE t ADD COLUMN b INT;")
+		altered <- err
+	}()
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-altered; err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Commit(); !errors.Is(err, ErrSerializationFailure) {
+		t.Fatalf("got %v, want ErrSerializationFailure", err)
+	}
+
+	results, err := execute(mb, "SELECT * FROM t;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Columns) != 2 || results.Columns[1].Name != "a" {
+		t.Errorf("got columns %v, want n and a", results.Columns)
+	}
+}
@@ -0,0 +1,188 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/jameslahm/gosql/ast"
+	"github.com/jameslahm/gosql/lex"
+)
+
+func (v *View) kind() string {
+	if v.Materialized {
+		return "materialized view"
+	}
+	return "view"
+}
+
+// ? The select is checked against the current tables, later changes to them
+// ? show up the next time the view is used. A materialized view is filled
+// ? right away.
+func (mb *MemoryBackend) CreateView(stmt *ast.CreateViewStatement) error {
+	return mb.exec(exclusiveLock, []string{stmt.Name.Value}, func() error {
+		return mb.createView(stmt)
+	})
+}
+
+func (mb *MemoryBackend) createView(stmt *ast.CreateViewStatement) error {
+	name := stmt.Name.Value
+	if err := mb.checkNameIsFree(name); err != nil {
+		return err
+	}
+
+	slct, err := mb.compileSelect(stmt.Select, &scope{})
+	if err != nil {
+		return fmt.Errorf("%w, in view %s", err, name)
+	}
+	columns, err := renameColumns(name, slct.columns, stmt.Columns)
+	if err != nil {
+		return err
+	}
+
+	view := &View{
+		Columns:      columns,
+		Select:       stmt.Select,
+		Query:        stmt.Query,
+		Materialized: stmt.Materialized,
+	}
+	if view.Materialized {
+		table, err := materialize(name, view, slct)
+		if err != nil {
+			return err
+		}
+		mb.Tables[name] = table
+	}
+
+	if mb.Views == nil {
+		mb.Views = make(map[string]*View)
+	}
+	mb.Views[name] = view
+	return nil
+}
+
+func (mb *MemoryBackend) DropView(stmt *ast.DropViewStatement) error {
+	return mb.exec(exclusiveLock, []string{stmt.Name.Value}, func() error {
+		return mb.dropView(stmt)
+	})
+}
+
+func (mb *MemoryBackend) dropView(stmt *ast.DropViewStatement) error {
+	name := stmt.Name.Value
+	view, err := mb.lookupView(name, stmt.Materialized)
+	if err != nil {
+		return err
+	}
+
+	table := mb.Tables[name]
+	if view.Materialized {
+		delete(mb.Tables, name)
+	}
+	delete(mb.Views, name)
+
+	if err := mb.checkViews(name); err != nil {
+		if view.Materialized {
+			mb.Tables[name] = table
+		}
+		mb.Views[name] = view
+		return err
+	}
+	return nil
+}
+
+// ? Run the select of a materialized view again and replace its rows
+func (mb *MemoryBackend) RefreshView(stmt *ast.RefreshViewStatement) error {
+	return mb.exec(exclusiveLock, []string{stmt.Name.Value}, func() error {
+		return mb.refreshView(stmt)
+	})
+}
+
+func (mb *MemoryBackend) refreshView(stmt *ast.RefreshViewStatement) error {
+	name := stmt.Name.Value
+	view, err := mb.lookupView(name, true)
+	if err != nil {
+		return err
+	}
+
+	slct, err := mb.compileSelect(view.Select, &scope{})
+	if err != nil {
+		return fmt.Errorf("%w, in view %s", err, name)
+	}
+	table, err := materialize(name, view, slct)
+	if err != nil {
+		return err
+	}
+	mb.Tables[name] = table
+	return nil
+}
+
+// ? A view of the given kind, the error tells what name is when it is not one
+func (mb *MemoryBackend) lookupView(name string, materialized bool) (*View, error) {
+	expected := (&View{Materialized: materialized}).kind()
+	view, ok := mb.Views[name]
+	if ok && view.Materialized == materialized {
+		return view, nil
+	}
+	if ok {
+		return nil, fmt.Errorf("%w: %s is a %s, not a %s", ErrViewDoesNotExist, name, view.kind(), expected)
+	}
+	if _, ok := mb.Tables[name]; ok {
+		return nil, fmt.Errorf("%w: %s is a table, not a %s", ErrViewDoesNotExist, name, expected)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrViewDoesNotExist, name)
+}
+
+func materialize(name string, view *View, slct *compiledSelect) (*Table, error) {
+	if len(slct.columns) != len(view.Columns) {
+		return nil, fmt.Errorf("%w: view %s now has %d columns instead of %d", ErrInvalidSelectItem, name, len(slct.columns), len(view.Columns))
+	}
+	rows, err := slct.run(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w, in view %s", err, name)
+	}
+	return &Table{
+		Columns:     view.Columns,
+		ColumnTypes: resultTypes(slct.columns),
+		rows:        buildRowTree(0, rows),
+	}, nil
+}
+
+// ? Names of the result columns, replaced by names when given
+func renameColumns(relation string, columns []ResultColumn, names *[]*lex.Token) ([]string, error) {
+	if names != nil && len(*names) != len(columns) {
+		return nil, fmt.Errorf("%w: %s has %d columns but %d names", ErrInvalidSelectItem, relation, len(columns), len(*names))
+	}
+	var renamed []string
+	for i, col := range columns {
+		if names != nil {
+			renamed = append(renamed, (*names)[i].Value)
+		} else {
+			renamed = append(renamed, col.Name)
+		}
+	}
+	return renamed, nil
+}
+
+// ? A view used in FROM, it sees neither the enclosing select nor its WITH tables
+func (mb *MemoryBackend) compileViewSource(name string, view *View) (*source, error) {
+	slct, err := mb.compileSelect(view.Select, &scope{})
+	if err != nil {
+		return nil, fmt.Errorf("%w, in view %s", err, name)
+	}
+	if len(slct.columns) != len(view.Columns) {
+		return nil, fmt.Errorf("%w: view %s now has %d columns instead of %d", ErrInvalidSelectItem, name, len(slct.columns), len(view.Columns))
+	}
+
+	src := &source{
+		columns: view.Columns,
+		rows: func(outer []MemoryCell, fn func(row []MemoryCell) error) error {
+			rows, err := slct.run(nil)
+			if err != nil {
+				return err
+			}
+			return eachRow(rows, fn)
+		},
+	}
+	for _, col := range slct.columns {
+		src.types = append(src.types, col.Type)
+	}
+	return src, nil
+}
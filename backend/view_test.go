@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// ? Views are stored as the text of their select and parsed again when the
+// ? database is opened, they select the same rows afterwards
+func TestViewsSurviveReopening(t *testing.T) {
+	views := []string{
+		`CREATE VIEW quoted AS SELECT 'it''s', "say ""hi""", 'a"b', "c'd" || s FROM t;`,
+		"CREATE VIEW counted (n, total) AS SELECT count(*), sum(t.n) FROM t WHERE n BETWEEN -1 AND 25;",
+		"CREATE VIEW ranked AS SELECT n, rank() OVER (ORDER BY n DESC ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS level FROM t;",
+		"CREATE VIEW nested AS SELECT DISTINCT rows FROM (SELECT n::TEXT AS rows FROM t) AS current ORDER BY 1 LIMIT 2;",
+		"CREATE MATERIALIZED VIEW kept AS SELECT CASE WHEN n > 1 THEN 'big' ELSE NULL END FROM t;",
+	}
+	selects := []string{"quoted", "counted", "ranked", "nested", "kept"}
+
+	for _, test := range []struct {
+		name string
+		open func(path string) (Backend, func() error, error)
+	}{
+		{"disk", func(path string) (Backend, func() error, error) {
+			db, err := OpenDiskBackend(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			return db, db.Close, nil
+		}},
+		{"disk checkpointed", func(path string) (Backend, func() error, error) {
+			db, err := OpenDiskBackend(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			return db, func() error {
+				if err := db.Checkpoint(); err != nil {
+					return err
+				}
+				return db.Close()
+			}, nil
+		}},
+		{"lsm", func(path string) (Backend, func() error, error) {
+			db, err := OpenLSMBackend(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			return db, db.Close, nil
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db")
+			db, closeDB, err := test.open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustExecute(t, db, "CREATE TABLE t (n INT, s TEXT); INSERT INTO t VALUES (1, 'x'); INSERT INTO t VALUES (2, 'y');")
+			for _, sql := range views {
+				mustExecute(t, db, sql)
+			}
+			want := make(map[string]string)
+			for _, name := range selects {
+				want[name] = dumpSelect(t, db, name)
+			}
+			if err := closeDB(); err != nil {
+				t.Fatal(err)
+			}
+
+			db, closeDB, err = test.open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeDB()
+			for _, name := range selects {
+				if got := dumpSelect(t, db, name); got != want[name] {
+					t.Errorf("view %s: got\n%s\nwant\n%s", name, got, want[name])
+				}
+			}
+			// ? Materialized views can still be refreshed from their select
+			mustExecute(t, db, "INSERT INTO t VALUES (3, 'z'); REFRESH MATERIALIZED VIEW kept;")
+			if n, err := count(db, "SELECT count(*) FROM kept;"); err != nil || n != 3 {
+				t.Errorf("got %d rows in kept after refreshing, want 3: %v", n, err)
+			}
+		})
+	}
+}
+
+func dumpSelect(t *testing.T, e Executor, name string) string {
+	t.Helper()
+	results, err := execute(e, "SELECT * FROM "+name+";")
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	s := ""
+	for _, col := range results.Columns {
+		s += col.Name + " "
+	}
+	for _, row := range results.Rows {
+		s += "\n"
+		for i, cell := range row {
+			s += cellToString(cell.(MemoryCell), results.Columns[i].Type) + " "
+		}
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+const (
+	logMagic      = "gosqlwal"
+	logHeaderSize = 16
+	// ? Each record starts with the length and checksum of its payload
+	logRecordHeaderSize = 8
+	maxLogRecordSize    = math.MaxUint32
+)
+
+type logRecordKind byte
+
+const (
+	// ? The columns of a table and the segments of the file its rows were
+	// ? written to, when it changed in any other way than growing
+	tableLogRecord logRecordKind = iota
+	// ? Rows added to the end of the table
+	rowsLogRecord
+	dropTableLogRecord
+	viewLogRecord
+	dropViewLogRecord
+	// ? Ends the records of one change, which are applied together or not at all
+	commitLogRecord
+	// ? Entries of an lsmTree
+	putLogRecord
+	deleteLogRecord
+)
+
+type logRecord struct {
+	kind logRecordKind
+	name string
+	data []byte
+}
+
+// ? A log of the changes made since the last checkpoint. The header holds
+// ? the checkpoint the log starts from, a log left over from an earlier one
+// ? has already been written to the pages and is ignored.
+type writeAheadLog struct {
+	file *os.File
+	size int64
+}
+
+// ? Open the log at path, returning the changes that were committed to it
+// ? after checkpoint. What follows the last commit record, like the end of a
+// ? write cut short by a crash, is cut off.
+func openLog(path string, checkpoint uint32) (*writeAheadLog, [][]*logRecord, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	l := &writeAheadLog{file: file}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if !validLogHeader(data, checkpoint) {
+		if err = l.reset(checkpoint); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return l, nil, nil
+	}
+
+	var changes [][]*logRecord
+	var records []*logRecord
+	end := int64(logHeaderSize)
+	r := bytes.NewReader(data[logHeaderSize:])
+	for {
+		record, err := readLogRecord(r)
+		if err != nil {
+			break
+		}
+		if record.kind != commitLogRecord {
+			records = append(records, record)
+			continue
+		}
+		changes = append(changes, records)
+		records = nil
+		end = int64(len(data) - r.Len())
+	}
+
+	if end < int64(len(data)) {
+		if err = file.Truncate(end); err == nil {
+			err = file.Sync()
+		}
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	l.size = end
+	return l, changes, nil
+}
+
+func validLogHeader(data []byte, checkpoint uint32) bool {
+	return len(data) >= logHeaderSize &&
+		string(data[:8]) == logMagic &&
+		binary.BigEndian.Uint32(data[8:]) == checkpoint &&
+		crc32.ChecksumIEEE(data[:12]) == binary.BigEndian.Uint32(data[12:])
+}
+
+func readLogRecord(r *bytes.Reader) (*logRecord, error) {
+	var header [logRecordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if int64(length) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, length)
+	r.Read(payload)
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.New("bad checksum")
+	}
+
+	d := &decoder{r: bytes.NewReader(payload)}
+	record := &logRecord{
+		kind: logRecordKind(d.byte()),
+		name: string(d.bytes()),
+		data: d.bytes(),
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ? Append the records of one change and make them durable
+func (l *writeAheadLog) append(records []*logRecord) error {
+	var buf bytes.Buffer
+	for _, record := range append(records, &logRecord{kind: commitLogRecord}) {
+		var payload bytes.Buffer
+		payload.WriteByte(byte(record.kind))
+		putBytes(&payload, []byte(record.name))
+		putBytes(&payload, record.data)
+
+		if int64(payload.Len()) > maxLogRecordSize {
+			return fmt.Errorf("%w: %d bytes", ErrLogRecordTooLarge, payload.Len())
+		}
+		var header [logRecordHeaderSize]byte
+		binary.BigEndian.PutUint32(header[:], uint32(payload.Len()))
+		binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload.Bytes()))
+		buf.Write(header[:])
+		buf.Write(payload.Bytes())
+	}
+
+	_, err := l.file.WriteAt(buf.Bytes(), l.size)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		// ? The change failed, so it must not be found in the log when it
+		// ? is opened again even if some of it reached the disk
+		l.file.Truncate(l.size)
+		return err
+	}
+	l.size += int64(buf.Len())
+	return nil
+}
+
+// ? Empty the log, which now starts from checkpoint
+func (l *writeAheadLog) reset(checkpoint uint32) error {
+	header := make([]byte, logHeaderSize)
+	copy(header, logMagic)
+	binary.BigEndian.PutUint32(header[8:], checkpoint)
+	binary.BigEndian.PutUint32(header[12:], crc32.ChecksumIEEE(header[:12]))
+
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := l.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.size = logHeaderSize
+	return nil
+}
+
+func (l *writeAheadLog) close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,213 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? What a database holds, as far as the statements of the tests go
+func dump(e Executor) string {
+	var b strings.Builder
+	for _, sql := range []string{"SELECT * FROM a;", "SELECT * FROM b;", "SELECT * FROM v;"} {
+		results, err := execute(e, sql)
+		if err != nil {
+			fmt.Fprintf(&b, "%s\n", err)
+			continue
+		}
+		for _, col := range results.Columns {
+			fmt.Fprintf(&b, "%s ", col.Name)
+		}
+		b.WriteString("\n")
+		for _, row := range results.Rows {
+			for i, cell := range row {
+				if cell.IsNull() {
+					b.WriteString("NULL ")
+				} else if results.Columns[i].Type == TextType {
+					fmt.Fprintf(&b, "%s ", cell.AsText())
+				} else {
+					fmt.Fprintf(&b, "%d ", cell.AsBigInt())
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func walSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path + "-wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+// ? Cut the log short at every offset, as a crash in the middle of writing
+// ? it would, and open the database again. It has every change whose
+// ? records were all written and none of the others.
+func TestRecoverFromTruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	db, err := OpenDiskBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ? Each statement run on its own is one change
+	mustExecute(t, db, "CREATE TABLE a (x INT, s TEXT); INSERT INTO a VALUES (1, 'one');")
+	if err = db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// ? The state after each change, and where its records end in the log
+	states := []string{dump(db)}
+	ends := []int64{walSize(t, path)}
+	record := func() {
+		states = append(states, dump(db))
+		ends = append(ends, walSize(t, path))
+	}
+
+	mustExecute(t, db, "CREATE TABLE b (y BIGINT);")
+	record()
+	for i := 2; i < 6; i++ {
+		mustExecute(t, db, fmt.Sprintf("INSERT INTO a VALUES (%d, 'row %d');", i, i))
+		record()
+	}
+	// ? Changes of more than one table are applied together or not at all
+	tx, err := db.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, tx, "INSERT INTO a VALUES (6, 'six'); INSERT INTO b VALUES (60); INSERT INTO b VALUES (61);")
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	record()
+	mustExecute(t, db, "ALTER TABLE a ADD COLUMN z INT DEFAULT 7;")
+	record()
+	mustExecute(t, db, "CREATE VIEW v AS SELECT count(*) AS n, sum(x) AS total FROM a;")
+	record()
+	mustExecute(t, db, "INSERT INTO a VALUES (8, 'eight', 8);")
+	record()
+	mustExecute(t, db, "INSERT INTO b VALUES (80);")
+	record()
+	mustExecute(t, db, "ALTER TABLE b RENAME COLUMN y TO w;")
+	record()
+
+	// ? A crash, the files are left as they are
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := ioutil.ReadFile(path + "-wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.close(); err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(log)) != ends[len(ends)-1] {
+		t.Fatalf("log has %d bytes, want %d", len(log), ends[len(ends)-1])
+	}
+
+	for offset := 0; offset <= len(log); offset++ {
+		crashed := filepath.Join(dir, fmt.Sprintf("crash%d", offset))
+		if err = ioutil.WriteFile(crashed, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(crashed+"-wal", log[:offset], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// ? The changes whose records all made it
+		committed := 0
+		for committed+1 < len(ends) && ends[committed+1] <= int64(offset) {
+			committed++
+		}
+
+		recovered, err := OpenDiskBackend(crashed)
+		if err != nil {
+			t.Fatalf("offset %d: %s", offset, err)
+		}
+		if got := dump(recovered); got != states[committed] {
+			t.Fatalf("offset %d: got\n%s\nwant the state after %d changes\n%s", offset, got, committed, states[committed])
+		}
+		// ? What follows the last complete change is cut off, so changes made
+		// ? from now on are not lost behind it
+		if offset >= logHeaderSize {
+			if size := walSize(t, crashed); size != ends[committed] {
+				t.Fatalf("offset %d: log has %d bytes after opening, want %d", offset, size, ends[committed])
+			}
+		}
+		if offset%16 == 0 {
+			mustExecute(t, recovered, "CREATE TABLE c (x INT); INSERT INTO c VALUES (1);")
+			recovered.close()
+			reopened, err := OpenDiskBackend(crashed)
+			if err != nil {
+				t.Fatalf("offset %d: %s", offset, err)
+			}
+			if n, err := count(reopened, "SELECT count(*) FROM c;"); err != nil || n != 1 {
+				t.Fatalf("offset %d: change made after recovery was lost: %d rows, %v", offset, n, err)
+			}
+			if got := dump(reopened); got != states[committed] {
+				t.Fatalf("offset %d: got\n%s\nwant\n%s", offset, got, states[committed])
+			}
+			recovered = reopened
+		}
+		recovered.close()
+		os.Remove(crashed)
+		os.Remove(crashed + "-wal")
+	}
+}
+
+// ? A change that could not be logged fails, and is undone before anyone
+// ? else can see it
+func TestFailedLogWriteIsUndone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDiskBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, db, "CREATE TABLE a (x INT); INSERT INTO a VALUES (1);")
+	before := dump(db)
+
+	// ? Every write to the log fails from now on
+	if err = db.log.file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = execute(db, "INSERT INTO a VALUES (2);"); err == nil {
+		t.Fatal("insert succeeded without a log")
+	}
+	if _, err = execute(db, "ALTER TABLE a ADD COLUMN y INT;"); err == nil {
+		t.Fatal("alter succeeded without a log")
+	}
+	tx, err := db.Begin(&ast.BeginStatement{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExecute(t, tx, "INSERT INTO a VALUES (3); CREATE TABLE b (y INT);")
+	if err = tx.Commit(); err == nil {
+		t.Fatal("commit succeeded without a log")
+	}
+
+	if got := dump(db); got != before {
+		t.Fatalf("got\n%s\nwant\n%s", got, before)
+	}
+	db.pager.close()
+
+	reopened, err := OpenDiskBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got := dump(reopened); got != before {
+		t.Fatalf("after opening again got\n%s\nwant\n%s", got, before)
+	}
+}
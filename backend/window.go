@@ -0,0 +1,443 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+// ? Rows of one partition sorted by the window ORDER BY
+type partition struct {
+	rows [][]MemoryCell
+	// ? Position of the last row that sorts equal to each row
+	peerEnd []int
+	// ? Position of the first row that sorts equal to each row
+	peerStart []int
+}
+
+// ? A function that only exists with OVER, compute returns one value per
+// ? row of a partition
+type windowFunction struct {
+	minArgs int
+	maxArgs int
+	args    []argKind
+	returns func(types []ColumnType) (ColumnType, error)
+	compute func(w *windowCall, p *partition) ([]MemoryCell, error)
+}
+
+var windowFunctions = map[string]*windowFunction{
+	"row_number": {
+		minArgs: 0, maxArgs: 0,
+		returns: returnsType(BigIntType),
+		compute: func(w *windowCall, p *partition) ([]MemoryCell, error) {
+			results := make([]MemoryCell, len(p.rows))
+			for i := range p.rows {
+				results[i] = bigIntCell(int64(i + 1))
+			}
+			return results, nil
+		},
+	},
+	// ? Peers share the rank, the next rank skips over them
+	"rank": {
+		minArgs: 0, maxArgs: 0,
+		returns: returnsType(BigIntType),
+		compute: func(w *windowCall, p *partition) ([]MemoryCell, error) {
+			results := make([]MemoryCell, len(p.rows))
+			for i := range p.rows {
+				results[i] = bigIntCell(int64(p.peerStart[i] + 1))
+			}
+			return results, nil
+		},
+	},
+	// ? Peers share the rank, the next rank follows without a gap
+	"dense_rank": {
+		minArgs: 0, maxArgs: 0,
+		returns: returnsType(BigIntType),
+		compute: func(w *windowCall, p *partition) ([]MemoryCell, error) {
+			results := make([]MemoryCell, len(p.rows))
+			var rank int64
+			for i := range p.rows {
+				if p.peerStart[i] == i {
+					rank++
+				}
+				results[i] = bigIntCell(rank)
+			}
+			return results, nil
+		},
+	},
+	// ? lag(x [, offset [, default]]), x from offset rows before
+	"lag": {
+		minArgs: 1, maxArgs: 3, args: []argKind{anyArg, numericArg, anyArg},
+		returns: returnsShiftedType,
+		compute: func(w *windowCall, p *partition) ([]MemoryCell, error) {
+			return computeShifted(w, p, -1)
+		},
+	},
+	// ? lead(x [, offset [, default]]), x from offset rows after
+	"lead": {
+		minArgs: 1, maxArgs: 3, args: []argKind{anyArg, numericArg, anyArg},
+		returns: returnsShiftedType,
+		compute: func(w *windowCall, p *partition) ([]MemoryCell, error) {
+			return computeShifted(w, p, 1)
+		},
+	},
+}
+
+func returnsShiftedType(types []ColumnType) (ColumnType, error) {
+	candidates := []ColumnType{types[0]}
+	if len(types) == 3 {
+		candidates = append(candidates, types[2])
+	}
+	return returnsUnifiedType(candidates)
+}
+
+// ? lag when direction is -1, lead when it is 1
+func computeShifted(w *windowCall, p *partition, direction int64) ([]MemoryCell, error) {
+	results := make([]MemoryCell, len(p.rows))
+	for i, row := range p.rows {
+		offset := int64(1)
+		if len(w.args) > 1 {
+			cell, err := w.args[1].eval(row)
+			if err != nil {
+				return nil, err
+			}
+			if cell == nil {
+				continue
+			}
+			offset = cell.AsBigInt()
+		}
+
+		target := int64(i) + direction*offset
+		arg, t := w.args[0], w.types[0]
+		if target < 0 || target >= int64(len(p.rows)) {
+			if len(w.args) < 3 {
+				continue
+			}
+			arg, t = w.args[2], w.types[2]
+			target = int64(i)
+		}
+
+		cell, err := arg.eval(p.rows[target])
+		if err != nil {
+			return nil, err
+		}
+		results[i], err = castCell(cell, t, w.result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// ? A call with OVER found in a select list or ORDER BY, its result is
+// ? appended to each row after the aggregate results
+type windowCall struct {
+	name string
+	// ? fn is set for window functions, agg for aggregates used over a window
+	fn        *windowFunction
+	agg       *aggregateFunction
+	args      []*compiledExpression
+	types     []ColumnType
+	result    ColumnType
+	partition []*compiledExpression
+	order     *compiledOrderBy
+	// ? Offsets of ROWS frame bounds, nil frame is from the start of the
+	// ? partition to the last peer of the current row
+	frame       *ast.WindowFrame
+	startOffset int
+	endOffset   int
+	index       int
+}
+
+func (mb *MemoryBackend) compileWindow(name string, call *ast.CallExpression, s *scope) (*compiledExpression, error) {
+	if s.windows == nil {
+		return nil, fmt.Errorf("%w: window function %s is not allowed here", ErrInvalidExpression, name)
+	}
+	if call.Distinct {
+		return nil, fmt.Errorf("%w: DISTINCT is not allowed in window function %s", ErrInvalidArguments, name)
+	}
+
+	w := &windowCall{name: name}
+	minArgs, maxArgs, argKinds, returns := 0, 0, []argKind(nil), returnsType(NullType)
+	if fn, ok := windowFunctions[name]; ok {
+		w.fn = fn
+		minArgs, maxArgs, argKinds, returns = fn.minArgs, fn.maxArgs, fn.args, fn.returns
+	} else if agg, ok := mb.lookupAggregate(name); ok {
+		w.agg = agg
+		minArgs, maxArgs, argKinds, returns = agg.minArgs, agg.maxArgs, agg.args, agg.returns
+	} else if _, ok := mb.lookupFunction(name); ok {
+		return nil, fmt.Errorf("%w: %s is not a window function", ErrInvalidExpression, name)
+	} else {
+		return nil, fmt.Errorf("%w: %s", ErrFunctionDoesNotExist, call.Name.Value)
+	}
+
+	// ? Window functions are computed over grouped rows, so they can contain
+	// ? aggregates but not other window functions
+	ws := s.withoutWindows()
+	var err error
+	w.args, w.types, err = mb.compileArguments(call, ws)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkArguments(name, minArgs, maxArgs, argKinds, w.types); err != nil {
+		return nil, err
+	}
+	w.result, err = returns(w.types)
+	if err != nil {
+		return nil, fmt.Errorf("%w, in %s", err, name)
+	}
+
+	over := call.Over
+	if over.PartitionBy != nil {
+		for _, exp := range *over.PartitionBy {
+			key, err := mb.compileExpression(exp, ws)
+			if err != nil {
+				return nil, err
+			}
+			w.partition = append(w.partition, key)
+		}
+	}
+	w.order, err = mb.compileOrderBy(over.OrderBy, ws, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.setFrame(over.Frame); err != nil {
+		return nil, err
+	}
+
+	*s.windows = append(*s.windows, w)
+	return &compiledExpression{
+		Name: name,
+		Type: w.result,
+		eval: func(row []MemoryCell) (MemoryCell, error) {
+			return row[w.index], nil
+		},
+	}, nil
+}
+
+func (w *windowCall) setFrame(frame *ast.WindowFrame) error {
+	if frame == nil {
+		return nil
+	}
+	if frame.Start.Kind == ast.UnboundedFollowingKind {
+		return fmt.Errorf("%w: frame can not start at UNBOUNDED FOLLOWING", ErrInvalidExpression)
+	}
+	if frame.End.Kind == ast.UnboundedPrecedingKind {
+		return fmt.Errorf("%w: frame can not end at UNBOUNDED PRECEDING", ErrInvalidExpression)
+	}
+
+	offset := func(bound *ast.FrameBound) (int, error) {
+		if bound.Offset == nil {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(bound.Offset.Value)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%w: frame offset %s must be a non-negative integer", ErrInvalidExpression, bound.Offset.Value)
+		}
+		return n, nil
+	}
+	var err error
+	if w.startOffset, err = offset(frame.Start); err != nil {
+		return err
+	}
+	if w.endOffset, err = offset(frame.End); err != nil {
+		return err
+	}
+
+	// ? Where a bound is relative to the current row, unbounded ones are
+	// ? always on the right side
+	position := func(bound *ast.FrameBound, offset int) int {
+		switch bound.Kind {
+		case ast.PrecedingKind:
+			return -offset
+		case ast.FollowingKind:
+			return offset
+		}
+		return 0
+	}
+	if frame.Start.Kind != ast.UnboundedPrecedingKind && frame.End.Kind != ast.UnboundedFollowingKind &&
+		position(frame.Start, w.startOffset) > position(frame.End, w.endOffset) {
+		return fmt.Errorf("%w: frame can not start after it ends", ErrInvalidExpression)
+	}
+	w.frame = frame
+	return nil
+}
+
+// ? Positions of the first and last row of the frame of row i, the frame is
+// ? empty when last < first
+func (w *windowCall) frameBounds(p *partition, i int) (int, int) {
+	if w.frame == nil {
+		return 0, p.peerEnd[i]
+	}
+
+	bound := func(b *ast.FrameBound, offset int) int {
+		switch b.Kind {
+		case ast.UnboundedPrecedingKind:
+			return 0
+		case ast.PrecedingKind:
+			return i - offset
+		case ast.FollowingKind:
+			return i + offset
+		case ast.UnboundedFollowingKind:
+			return len(p.rows) - 1
+		}
+		return i
+	}
+	first, last := bound(w.frame.Start, w.startOffset), bound(w.frame.End, w.endOffset)
+	if first < 0 {
+		first = 0
+	}
+	if last > len(p.rows)-1 {
+		last = len(p.rows) - 1
+	}
+	return first, last
+}
+
+// ? Run an aggregate over the frame of each row. Frames that start at the
+// ? first row only grow, so one state is stepped along instead of starting
+// ? over for every row.
+func (w *windowCall) computeAggregate(p *partition) ([]MemoryCell, error) {
+	args := make([][]MemoryCell, len(p.rows))
+	for i, row := range p.rows {
+		args[i] = make([]MemoryCell, len(w.args))
+		for j, arg := range w.args {
+			cell, err := arg.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			args[i][j] = cell
+		}
+	}
+
+	results := make([]MemoryCell, len(p.rows))
+	growing := w.frame == nil || w.frame.Start.Kind == ast.UnboundedPrecedingKind
+	state := w.agg.newState(w.types, w.result)
+	next := 0
+	for i := range p.rows {
+		first, last := w.frameBounds(p, i)
+		if !growing {
+			state = w.agg.newState(w.types, w.result)
+			next = first
+		}
+		for ; next <= last; next++ {
+			if err := state.step(args[next]); err != nil {
+				return nil, err
+			}
+		}
+
+		cell, err := state.final()
+		if err != nil {
+			return nil, err
+		}
+		results[i] = cell
+	}
+	return results, nil
+}
+
+// ? One value for each of rows, in the same order
+func (w *windowCall) evaluate(rows [][]MemoryCell) ([]MemoryCell, error) {
+	partitionTypes := make([]ColumnType, len(w.partition))
+	for i, key := range w.partition {
+		partitionTypes[i] = key.Type
+	}
+
+	partitions := make(map[string][]int)
+	var ordered []string
+	sortKeys := make([][]MemoryCell, len(rows))
+	for r, row := range rows {
+		keyCells := make([]MemoryCell, len(w.partition))
+		for i, key := range w.partition {
+			cell, err := key.eval(row)
+			if err != nil {
+				return nil, err
+			}
+			keyCells[i] = cell
+		}
+		k := rowKey(keyCells, partitionTypes)
+		if _, ok := partitions[k]; !ok {
+			ordered = append(ordered, k)
+		}
+		partitions[k] = append(partitions[k], r)
+
+		if w.order != nil {
+			rowKeys, err := w.order.keys(row)
+			if err != nil {
+				return nil, err
+			}
+			sortKeys[r] = rowKeys
+		}
+	}
+
+	results := make([]MemoryCell, len(rows))
+	for _, k := range ordered {
+		indexes := partitions[k]
+		peers := func(a, b int) bool {
+			return w.order == nil || w.order.compare(sortKeys[a], sortKeys[b]) == 0
+		}
+		if w.order != nil {
+			sort.SliceStable(indexes, func(i, j int) bool {
+				return w.order.compare(sortKeys[indexes[i]], sortKeys[indexes[j]]) < 0
+			})
+		}
+
+		p := &partition{
+			rows:      make([][]MemoryCell, len(indexes)),
+			peerStart: make([]int, len(indexes)),
+			peerEnd:   make([]int, len(indexes)),
+		}
+		for i, r := range indexes {
+			p.rows[i] = rows[r]
+			if i > 0 && peers(indexes[i-1], r) {
+				p.peerStart[i] = p.peerStart[i-1]
+			} else {
+				p.peerStart[i] = i
+			}
+		}
+		for i := len(indexes) - 1; i >= 0; i-- {
+			if i < len(indexes)-1 && peers(indexes[i+1], indexes[i]) {
+				p.peerEnd[i] = p.peerEnd[i+1]
+			} else {
+				p.peerEnd[i] = i
+			}
+		}
+
+		var values []MemoryCell
+		var err error
+		if w.fn != nil {
+			values, err = w.fn.compute(w, p)
+		} else {
+			values, err = w.computeAggregate(p)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, r := range indexes {
+			results[r] = values[i]
+		}
+	}
+	return results, nil
+}
+
+// ? Append the result of every window call to each row
+func applyWindows(rows [][]MemoryCell, windows []*windowCall) ([][]MemoryCell, error) {
+	results := make([][]MemoryCell, len(windows))
+	for i, w := range windows {
+		values, err := w.evaluate(rows)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = values
+	}
+
+	extended := make([][]MemoryCell, len(rows))
+	for r, row := range rows {
+		extendedRow := append(make([]MemoryCell, 0, len(row)+len(windows)), row...)
+		for i := range windows {
+			extendedRow = append(extendedRow, results[i][r])
+		}
+		extended[r] = extendedRow
+	}
+	return extended, nil
+}
@@ -0,0 +1,233 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/jameslahm/gosql/ast"
+)
+
+const defaultRecursionLimit = 1000
+
+// ? A table defined by WITH, its rows are computed each time the statement
+// ? that defines it runs
+type commonTable struct {
+	columns []string
+	types   []ColumnType
+	rows    [][]MemoryCell
+	// ? Set when a FROM clause resolves to this table while compiling
+	referenced bool
+}
+
+// ? Limit the iterations of WITH RECURSIVE tables, so a query that never
+// ? reaches a fixpoint fails with ErrRecursionLimit instead of running forever
+func (mb *MemoryBackend) SetRecursionLimit(limit int) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.recursionLimit = limit
+}
+
+func (mb *MemoryBackend) compileWith(stmt *ast.SelectStatement, outer *scope) (*compiledSelect, error) {
+	// ? Each WITH table sees the ones defined before it, the statement sees all of them
+	commonTables := make(map[string]*commonTable)
+	for name, ct := range outer.commonTables {
+		commonTables[name] = ct
+	}
+	s := &scope{
+		columns:      outer.columns,
+		tables:       outer.tables,
+		types:        outer.types,
+		aggregates:   outer.aggregates,
+		commonTables: commonTables,
+		// ? The statement is nested in the enclosing select like the WITH
+		// ? tables are
+		reference:      outer.reference,
+		outerReference: outer.outerReference,
+	}
+
+	var tables []*commonTable
+	var fills []func(outer []MemoryCell) error
+	for _, cte := range *stmt.With.Tables {
+		ct, fill, err := mb.compileCommonTable(cte, stmt.With.Recursive, s)
+		if err != nil {
+			return nil, err
+		}
+		commonTables[cte.Name.Value] = ct
+		tables = append(tables, ct)
+		fills = append(fills, fill)
+	}
+
+	body := *stmt
+	body.With = nil
+	slct, err := mb.compileSelect(&body, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compiledSelect{
+		columns: slct.columns,
+		run: func(outer []MemoryCell) ([][]MemoryCell, error) {
+			for _, fill := range fills {
+				if err := fill(outer); err != nil {
+					return nil, err
+				}
+			}
+			rows, err := slct.run(outer)
+
+			// ? Let the rows go once the statement is done
+			for _, ct := range tables {
+				ct.rows = nil
+			}
+			return rows, err
+		},
+	}, nil
+}
+
+// ? Compile one WITH table, fill computes its rows for a row of the enclosing scope
+func (mb *MemoryBackend) compileCommonTable(cte *ast.CommonTableExpression, recursive bool, s *scope) (*commonTable, func(outer []MemoryCell) error, error) {
+	name := cte.Name.Value
+	if recursive && isRecursiveShape(cte.Select) {
+		ct, fill, err := mb.compileRecursiveTable(cte, s)
+		if err != nil || ct != nil {
+			return ct, fill, err
+		}
+	}
+
+	slct, err := mb.compileSelect(cte.Select, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	ct := &commonTable{}
+	if err := ct.setColumns(cte, slct.columns); err != nil {
+		return nil, nil, err
+	}
+
+	fill := func(outer []MemoryCell) error {
+		rows, err := slct.run(outer)
+		if err != nil {
+			return fmt.Errorf("%w, in %s", err, name)
+		}
+		ct.rows = rows
+		return nil
+	}
+	return ct, fill, nil
+}
+
+func (ct *commonTable) setColumns(cte *ast.CommonTableExpression, columns []ResultColumn) error {
+	names, err := renameColumns(cte.Name.Value, columns, cte.Columns)
+	if err != nil {
+		return err
+	}
+	ct.columns = names
+	ct.types = resultTypes(columns)
+	return nil
+}
+
+// ? anchor UNION [ALL] recursive term
+func isRecursiveShape(stmt *ast.SelectStatement) bool {
+	return stmt.With == nil && stmt.SetOperations != nil &&
+		len(*stmt.SetOperations) == 1 && (*stmt.SetOperations)[0].Kind == ast.UnionKind
+}
+
+// ? The anchor runs once, then the recursive term runs on the rows added by
+// ? the previous iteration until it adds none. Returns a nil table when the
+// ? recursive term does not refer to the table, it is then compiled as an
+// ? ordinary UNION.
+func (mb *MemoryBackend) compileRecursiveTable(cte *ast.CommonTableExpression, s *scope) (*commonTable, func(outer []MemoryCell) error, error) {
+	name := cte.Name.Value
+	operation := (*cte.Select.SetOperations)[0]
+	if cte.Select.OrderBy != nil || cte.Select.Limit != nil || cte.Select.Offset != nil {
+		return nil, nil, fmt.Errorf("%w: ORDER BY and LIMIT are not allowed in recursive table %s", ErrInvalidSelectItem, name)
+	}
+
+	anchorStmt := *cte.Select
+	anchorStmt.SetOperations = nil
+	anchor, err := mb.compileSelect(&anchorStmt, s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ct := &commonTable{}
+	if err := ct.setColumns(cte, anchor.columns); err != nil {
+		return nil, nil, err
+	}
+
+	// ? The recursive term sees the table, other tables keep their names
+	commonTables := make(map[string]*commonTable)
+	for other, table := range s.commonTables {
+		commonTables[other] = table
+	}
+	commonTables[name] = ct
+	recursiveScope := *s
+	recursiveScope.commonTables = commonTables
+
+	term, err := mb.compileSelect(operation.Select, &recursiveScope)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ct.referenced {
+		return nil, nil, nil
+	}
+	if len(term.columns) != len(anchor.columns) {
+		return nil, nil, fmt.Errorf("%w: recursive table %s has %d columns but its recursive term has %d", ErrInvalidSelectItem, name, len(anchor.columns), len(term.columns))
+	}
+	for i, col := range term.columns {
+		if _, ok := unifyTypes([]ColumnType{ct.types[i], col.Type}); !ok {
+			return nil, nil, fmt.Errorf("%w: recursive table %s column %d is %s but its recursive term gives %s", ErrInvalidDataType, name, i+1, ct.types[i], col.Type)
+		}
+	}
+
+	limit := mb.recursionLimit
+	if limit == 0 {
+		limit = defaultRecursionLimit
+	}
+
+	fill := func(outer []MemoryCell) error {
+		types := resultTypes(anchor.columns)
+		seen := make(map[string]bool)
+		// ? Without ALL rows already in the table are not added again
+		distinct := func(rows [][]MemoryCell) [][]MemoryCell {
+			if operation.All {
+				return rows
+			}
+			var fresh [][]MemoryCell
+			for _, row := range rows {
+				k := rowKey(row, types)
+				if !seen[k] {
+					seen[k] = true
+					fresh = append(fresh, row)
+				}
+			}
+			return fresh
+		}
+
+		rows, err := anchor.run(outer)
+		if err != nil {
+			return fmt.Errorf("%w, in %s", err, name)
+		}
+		working := distinct(rows)
+		result := append([][]MemoryCell{}, working...)
+
+		for iteration := 0; len(working) > 0; iteration++ {
+			if iteration >= limit {
+				return fmt.Errorf("%w: %s did not finish after %d iterations", ErrRecursionLimit, name, limit)
+			}
+
+			ct.rows = working
+			rows, err := term.run(outer)
+			if err != nil {
+				return fmt.Errorf("%w, in %s", err, name)
+			}
+			rows, err = castRows(rows, term.columns, anchor.columns)
+			if err != nil {
+				return fmt.Errorf("%w, in %s", err, name)
+			}
+			working = distinct(rows)
+			result = append(result, working...)
+		}
+
+		ct.rows = result
+		return nil
+	}
+	return ct, fill, nil
+}
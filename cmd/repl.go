@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -12,61 +14,147 @@ import (
 )
 
 func main() {
-	mb := backend.NewMemoryBackend()
+	lsm := flag.Bool("lsm", false, "keep the database in a log-structured merge tree in a directory")
+	flag.Parse()
+
+	var mb backend.Backend = backend.NewMemoryBackend()
+	// ? With a file argument the database is kept in that file, or in that
+	// ? directory with -lsm
+	if path := flag.Arg(0); path != "" {
+		var db interface {
+			backend.Backend
+			Close() error
+		}
+		var err error
+		if *lsm {
+			db, err = backend.OpenLSMBackend(path)
+		} else {
+			db, err = backend.OpenDiskBackend(path)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		mb = db
+	}
+	// ? Open transaction between BEGIN and COMMIT or ROLLBACK
+	var tx backend.Transaction
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("Welcome to gosql")
 
 	for {
 		fmt.Print("$ ")
 		text, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return
+		}
 		if err != nil {
 			panic(err)
 		}
 		text = strings.Replace(text, "\n", "", -1)
 		tokens, err := lex.Lex(text)
 		if err != nil {
-			panic(err)
+			fmt.Println(err)
+			continue
 		}
 		program, err := ast.Parse(tokens)
 		if err != nil {
-			panic(err)
+			fmt.Println(err)
+			continue
 		}
 		for _, stmt := range program.Statements {
+			var exec backend.Executor = mb
+			if tx != nil {
+				exec = tx
+			}
+
 			switch stmt.Kind {
-			case ast.CreateTableKind:
-				err = mb.CreateTable(stmt.CreateTableStatement)
-				if err != nil {
-					panic(err)
+			case ast.BeginKind:
+				if tx != nil {
+					err = backend.ErrTransactionInProgress
+					break
 				}
-			case ast.InsertKind:
-				err = mb.Insert(stmt.InsertStatement)
-				if err != nil {
-					panic(err)
+				tx, err = mb.Begin(stmt.BeginStatement)
+			case ast.CommitKind, ast.RollbackKind:
+				if tx == nil {
+					err = backend.ErrNoTransaction
+					break
 				}
-			case ast.SelectKind:
-				results, err := mb.Select(stmt.SelectStatement)
-				if err != nil {
-					panic(err)
+				if stmt.Kind == ast.CommitKind {
+					err = tx.Commit()
+				} else {
+					err = tx.Rollback()
 				}
-				fmt.Printf("|")
-				for _, col := range results.Columns {
-					fmt.Printf("%10s|", col.Name)
+				tx = nil
+			case ast.SavepointKind, ast.ReleaseKind, ast.RollbackToKind:
+				if tx == nil {
+					err = backend.ErrNoTransaction
+					break
 				}
-				fmt.Println()
-				for _, row := range results.Rows {
-					fmt.Printf("|")
-					for i, cell := range row {
-						switch results.Columns[i].Type {
-						case backend.IntType:
-							fmt.Printf("%10d|", cell.AsInt())
-						case backend.TextType:
-							fmt.Printf("%10s|", cell.AsText())
-						}
-					}
+				name := stmt.SavepointStatement.Name.Value
+				switch stmt.Kind {
+				case ast.SavepointKind:
+					err = tx.Savepoint(name)
+				case ast.ReleaseKind:
+					err = tx.ReleaseSavepoint(name)
+				default:
+					err = tx.RollbackToSavepoint(name)
 				}
-
+			case ast.SetKind:
+				err = mb.Set(stmt.SetStatement)
+			case ast.CreateTableKind:
+				err = exec.CreateTable(stmt.CreateTableStatement)
+			case ast.InsertKind:
+				err = exec.Insert(stmt.InsertStatement)
+			case ast.CreateViewKind:
+				err = exec.CreateView(stmt.CreateViewStatement)
+			case ast.DropViewKind:
+				err = exec.DropView(stmt.DropViewStatement)
+			case ast.RefreshViewKind:
+				err = exec.RefreshView(stmt.RefreshViewStatement)
+			case ast.AlterTableKind:
+				err = exec.AlterTable(stmt.AlterTableStatement)
+			case ast.SelectKind:
+				var results *backend.Results
+				results, err = exec.Select(stmt.SelectStatement)
+				if err == nil {
+					printResults(results)
+				}
+			}
+			if err != nil {
+				fmt.Println(err)
+				break
 			}
 			fmt.Println("Ok")
 		}
 	}
 }
+
+func printResults(results *backend.Results) {
+	fmt.Printf("|")
+	for _, col := range results.Columns {
+		fmt.Printf("%10s|", col.Name)
+	}
+	fmt.Println()
+	for _, row := range results.Rows {
+		fmt.Printf("|")
+		for i, cell := range row {
+			if cell.IsNull() {
+				fmt.Printf("%10s|", "NULL")
+				continue
+			}
+			switch results.Columns[i].Type {
+			case backend.IntType:
+				fmt.Printf("%10d|", cell.AsInt())
+			case backend.BigIntType:
+				fmt.Printf("%10d|", cell.AsBigInt())
+			case backend.TextType:
+				fmt.Printf("%10s|", cell.AsText())
+			case backend.BoolType:
+				fmt.Printf("%10t|", cell.AsBool())
+			}
+		}
+		fmt.Println()
+	}
+}
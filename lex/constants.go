@@ -3,27 +3,145 @@ package lex
 type Keyword string
 
 const (
-	SelectKeyword Keyword = "select"
-	FromKeyword   Keyword = "from"
-	AsKeyword     Keyword = "as"
-	TableKeyword  Keyword = "table"
-	CreateKeyword Keyword = "create"
-	InsertKeyword Keyword = "insert"
-	IntoKeyword   Keyword = "into"
-	ValuesKeyword Keyword = "values"
-	IntKeyword    Keyword = "int"
-	TextKeyword   Keyword = "text"
-	WhereKeyword  Keyword = "where"
+	SelectKeyword       Keyword = "select"
+	FromKeyword         Keyword = "from"
+	AsKeyword           Keyword = "as"
+	TableKeyword        Keyword = "table"
+	CreateKeyword       Keyword = "create"
+	InsertKeyword       Keyword = "insert"
+	IntoKeyword         Keyword = "into"
+	ValuesKeyword       Keyword = "values"
+	IntKeyword          Keyword = "int"
+	TextKeyword         Keyword = "text"
+	WhereKeyword        Keyword = "where"
+	CastKeyword         Keyword = "cast"
+	BigIntKeyword       Keyword = "bigint"
+	NullKeyword         Keyword = "null"
+	GroupKeyword        Keyword = "group"
+	ByKeyword           Keyword = "by"
+	CaseKeyword         Keyword = "case"
+	WhenKeyword         Keyword = "when"
+	ThenKeyword         Keyword = "then"
+	ElseKeyword         Keyword = "else"
+	EndKeyword          Keyword = "end"
+	AndKeyword          Keyword = "and"
+	OrKeyword           Keyword = "or"
+	NotKeyword          Keyword = "not"
+	TrueKeyword         Keyword = "true"
+	FalseKeyword        Keyword = "false"
+	BoolKeyword         Keyword = "bool"
+	OrderKeyword        Keyword = "order"
+	AscKeyword          Keyword = "asc"
+	DescKeyword         Keyword = "desc"
+	InKeyword           Keyword = "in"
+	BetweenKeyword      Keyword = "between"
+	LikeKeyword         Keyword = "like"
+	IlikeKeyword        Keyword = "ilike"
+	EscapeKeyword       Keyword = "escape"
+	ExistsKeyword       Keyword = "exists"
+	UnionKeyword        Keyword = "union"
+	AllKeyword          Keyword = "all"
+	IntersectKeyword    Keyword = "intersect"
+	ExceptKeyword       Keyword = "except"
+	LimitKeyword        Keyword = "limit"
+	OffsetKeyword       Keyword = "offset"
+	WithKeyword         Keyword = "with"
+	RecursiveKeyword    Keyword = "recursive"
+	DistinctKeyword     Keyword = "distinct"
+	OverKeyword         Keyword = "over"
+	PartitionKeyword    Keyword = "partition"
+	RowsKeyword         Keyword = "rows"
+	RowKeyword          Keyword = "row"
+	UnboundedKeyword    Keyword = "unbounded"
+	PrecedingKeyword    Keyword = "preceding"
+	FollowingKeyword    Keyword = "following"
+	CurrentKeyword      Keyword = "current"
+	ViewKeyword         Keyword = "view"
+	DropKeyword         Keyword = "drop"
+	MaterializedKeyword Keyword = "materialized"
+	RefreshKeyword      Keyword = "refresh"
+	AlterKeyword        Keyword = "alter"
+	AddKeyword          Keyword = "add"
+	ColumnKeyword       Keyword = "column"
+	RenameKeyword       Keyword = "rename"
+	ToKeyword           Keyword = "to"
+	DefaultKeyword      Keyword = "default"
+	BeginKeyword        Keyword = "begin"
+	CommitKeyword       Keyword = "commit"
+	RollbackKeyword     Keyword = "rollback"
+	TransactionKeyword  Keyword = "transaction"
+	SavepointKeyword    Keyword = "savepoint"
+	ReleaseKeyword      Keyword = "release"
+	IsolationKeyword    Keyword = "isolation"
+	LevelKeyword        Keyword = "level"
+	SerializableKeyword Keyword = "serializable"
+	RepeatableKeyword   Keyword = "repeatable"
+	ReadKeyword         Keyword = "read"
+	CommittedKeyword    Keyword = "committed"
+	UncommittedKeyword  Keyword = "uncommitted"
+	SetKeyword          Keyword = "set"
 )
 
+// ? Keywords that only mean something in the clauses that use them, so they
+// ? can still name tables, columns and aliases everywhere else
+var nonReservedKeywords = map[Keyword]bool{
+	RowsKeyword:         true,
+	RowKeyword:          true,
+	UnboundedKeyword:    true,
+	PrecedingKeyword:    true,
+	FollowingKeyword:    true,
+	CurrentKeyword:      true,
+	ViewKeyword:         true,
+	MaterializedKeyword: true,
+	RefreshKeyword:      true,
+	AddKeyword:          true,
+	ColumnKeyword:       true,
+	RenameKeyword:       true,
+	ToKeyword:           true,
+	DefaultKeyword:      true,
+	BeginKeyword:        true,
+	CommitKeyword:       true,
+	RollbackKeyword:     true,
+	TransactionKeyword:  true,
+	SavepointKeyword:    true,
+	ReleaseKeyword:      true,
+	IsolationKeyword:    true,
+	LevelKeyword:        true,
+	SerializableKeyword: true,
+	RepeatableKeyword:   true,
+	ReadKeyword:         true,
+	CommittedKeyword:    true,
+	UncommittedKeyword:  true,
+	SetKeyword:          true,
+}
+
+// ? Whether the keyword can not be used as a name
+func (k Keyword) IsReserved() bool {
+	return !nonReservedKeywords[k]
+}
+
 type Symbol string
 
 const (
-	SemiColonSymbol  Symbol = ";"
-	AsteriskSymbol   Symbol = "*"
-	CommaSymbol      Symbol = ","
-	LeftParenSymbol  Symbol = "("
-	RightParenSymbol Symbol = ")"
+	SemiColonSymbol    Symbol = ";"
+	AsteriskSymbol     Symbol = "*"
+	CommaSymbol        Symbol = ","
+	LeftParenSymbol    Symbol = "("
+	RightParenSymbol   Symbol = ")"
+	DoubleColonSymbol  Symbol = "::"
+	PlusSymbol         Symbol = "+"
+	MinusSymbol        Symbol = "-"
+	SlashSymbol        Symbol = "/"
+	PercentSymbol      Symbol = "%"
+	ConcatSymbol       Symbol = "||"
+	EqualSymbol        Symbol = "="
+	NotEqualSymbol     Symbol = "<>"
+	BangEqualSymbol    Symbol = "!="
+	LessSymbol         Symbol = "<"
+	LessEqualSymbol    Symbol = "<="
+	GreaterSymbol      Symbol = ">"
+	GreaterEqualSymbol Symbol = ">="
+	DotSymbol          Symbol = "."
 )
 
 type TokenKind uint
@@ -167,7 +167,7 @@ func longestMatch(source string, cursor Cursor, options []string) string {
 			}
 
 			sharePrefix := string(value) == option[:cursor.pointer-originCurosr.pointer]
-			tooLong := len(value) >= len(options)
+			tooLong := len(value) >= len(option)
 			if !sharePrefix || tooLong {
 				skipList = append(skipList, i)
 			}
@@ -177,7 +177,7 @@ func longestMatch(source string, cursor Cursor, options []string) string {
 			return match
 		}
 	}
-	return ""
+	return match
 }
 
 // ? Here to skip space
@@ -204,6 +204,20 @@ func lexSymbol(source string, cursor Cursor) (*Token, Cursor, bool) {
 		RightParenSymbol,
 		SemiColonSymbol,
 		AsteriskSymbol,
+		DoubleColonSymbol,
+		PlusSymbol,
+		MinusSymbol,
+		SlashSymbol,
+		PercentSymbol,
+		ConcatSymbol,
+		EqualSymbol,
+		NotEqualSymbol,
+		BangEqualSymbol,
+		LessSymbol,
+		LessEqualSymbol,
+		GreaterSymbol,
+		GreaterEqualSymbol,
+		DotSymbol,
 	}
 
 	var options []string
@@ -239,6 +253,72 @@ func lexKeyword(source string, cursor Cursor) (*Token, Cursor, bool) {
 		WhereKeyword,
 		TableKeyword,
 		AsKeyword,
+		CastKeyword,
+		BigIntKeyword,
+		NullKeyword,
+		GroupKeyword,
+		ByKeyword,
+		CaseKeyword,
+		WhenKeyword,
+		ThenKeyword,
+		ElseKeyword,
+		EndKeyword,
+		AndKeyword,
+		OrKeyword,
+		NotKeyword,
+		TrueKeyword,
+		FalseKeyword,
+		BoolKeyword,
+		OrderKeyword,
+		AscKeyword,
+		DescKeyword,
+		InKeyword,
+		BetweenKeyword,
+		LikeKeyword,
+		IlikeKeyword,
+		EscapeKeyword,
+		ExistsKeyword,
+		UnionKeyword,
+		AllKeyword,
+		IntersectKeyword,
+		ExceptKeyword,
+		LimitKeyword,
+		OffsetKeyword,
+		WithKeyword,
+		RecursiveKeyword,
+		DistinctKeyword,
+		OverKeyword,
+		PartitionKeyword,
+		RowsKeyword,
+		RowKeyword,
+		UnboundedKeyword,
+		PrecedingKeyword,
+		FollowingKeyword,
+		CurrentKeyword,
+		ViewKeyword,
+		DropKeyword,
+		MaterializedKeyword,
+		RefreshKeyword,
+		AlterKeyword,
+		AddKeyword,
+		ColumnKeyword,
+		RenameKeyword,
+		ToKeyword,
+		DefaultKeyword,
+		BeginKeyword,
+		CommitKeyword,
+		RollbackKeyword,
+		TransactionKeyword,
+		SavepointKeyword,
+		ReleaseKeyword,
+		IsolationKeyword,
+		LevelKeyword,
+		SerializableKeyword,
+		RepeatableKeyword,
+		ReadKeyword,
+		CommittedKeyword,
+		UncommittedKeyword,
+		SetKeyword,
 	}
 	var options []string
 	for _, keyword := range keywords {
@@ -248,6 +328,13 @@ func lexKeyword(source string, cursor Cursor) (*Token, Cursor, bool) {
 	if match == "" {
 		return nil, originCurosr, false
 	}
+
+	// ? Keyword must not be the prefix of an identifier
+	end := originCurosr.pointer + uint(len(match))
+	if end < uint(len(source)) && isIdentifierCharacter(source[end]) {
+		return nil, originCurosr, false
+	}
+
 	cursor.pointer = originCurosr.pointer + uint(len(match))
 	cursor.loc.Col = originCurosr.loc.Col + len(match)
 
@@ -274,9 +361,7 @@ func lexIdentifier(source string, cursor Cursor) (*Token, Cursor, bool) {
 	var value []byte = []byte{character}
 	for newCursor.pointer < uint(len(source)) {
 		character := source[newCursor.pointer]
-		isAlphabetical := (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z')
-		isNumeric := character >= '1' && character <= '9'
-		if isAlphabetical || isNumeric || character == '_' || character == '$' {
+		if isIdentifierCharacter(character) {
 			value = append(value, character)
 			newCursor.pointer++
 			newCursor.loc.Col++
@@ -288,3 +373,9 @@ func lexIdentifier(source string, cursor Cursor) (*Token, Cursor, bool) {
 
 	return NewToken(IdentifierKind, cursor.loc, string(value)), newCursor, true
 }
+
+func isIdentifierCharacter(character byte) bool {
+	isAlphabetical := (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z')
+	isNumeric := character >= '0' && character <= '9'
+	return isAlphabetical || isNumeric || character == '_' || character == '$'
+}
@@ -1,5 +1,7 @@
 package lex
 
+import "strings"
+
 type Token struct {
 	Kind  TokenKind
 	Loc   Location
@@ -14,6 +16,30 @@ func NewToken(kind TokenKind, loc Location, value string) *Token {
 	}
 }
 
+// ? SQL text that lexes back to the tokens
+func Join(tokens []*Token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.source())
+	}
+	return b.String()
+}
+
+// ? Strings keep doubled delimiters doubled in their values, so a string
+// ? with a lone ' came from a "-delimited one
+func (t *Token) source() string {
+	if t.Kind != StringKind {
+		return t.Value
+	}
+	if strings.Contains(strings.ReplaceAll(t.Value, "''", ""), "'") {
+		return `"` + t.Value + `"`
+	}
+	return "'" + t.Value + "'"
+}
+
 func (t *Token) equals(other *Token) bool {
 	return t.Value == other.Value && t.Kind == other.Kind
 }